@@ -0,0 +1,159 @@
+package cigExchange
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// Constants defining the audited operations
+const (
+	AuditOperationCreate = "create"
+	AuditOperationUpdate = "update"
+	AuditOperationDelete = "delete"
+)
+
+// AuditLog is a struct to represent a change of an audited table row.
+// Rows are written by the gorm callbacks in the transaction of the change
+type AuditLog struct {
+	ID        string         `json:"id" gorm:"column:id;primary_key"`
+	Table     string         `json:"table" gorm:"column:table_name"`
+	RecordID  string         `json:"record_id" gorm:"column:record_id"`
+	Operation string         `json:"operation" gorm:"column:operation"`
+	ActorID   string         `json:"actor_id" gorm:"column:actor_id"`
+	Columns   pq.StringArray `json:"columns" gorm:"column:columns;type:text[]"`
+	CreatedAt time.Time      `json:"created_at" gorm:"column:created_at"`
+}
+
+// TableName returns table name for struct
+func (*AuditLog) TableName() string {
+	return "audit_log"
+}
+
+// BeforeCreate generates new unique UUIDs for new db records
+func (*AuditLog) BeforeCreate(scope *gorm.Scope) error {
+
+	scope.SetColumn("ID", RandomUUID())
+	return nil
+}
+
+// CreateAuditLogIndexes creates the audit_log table indexes
+func CreateAuditLogIndexes() *APIError {
+
+	query := `CREATE INDEX IF NOT EXISTS audit_log_record_idx ON public.audit_log (table_name, record_id, created_at);`
+	db := GetDB().Exec(query)
+	if db.Error != nil {
+		return NewDatabaseError("Failed to create audit log index", db.Error)
+	}
+	return nil
+}
+
+var (
+	auditedTablesMutex sync.RWMutex
+	auditedTables      = make(map[string]bool)
+)
+
+// selfAuditedTables are never audited by the gorm callbacks: the audit tables themselves
+// and offering, its changes are recorded with the field diff in offering_audit
+var selfAuditedTables = map[string]bool{
+	"audit_log":      true,
+	"offering":       true,
+	"offering_audit": true,
+}
+
+func init() {
+
+	// Comma separated audited table names, e.g. "user,organisation,media"
+	SetAuditedTables(strings.Split(os.Getenv("AUDIT_TABLES"), ",")...)
+}
+
+// SetAuditedTables replaces the set of tables audited by the gorm callbacks, no tables disables auditing.
+// Initial set is read from the AUDIT_TABLES env variable, tables with their own audit are ignored
+func SetAuditedTables(tables ...string) {
+
+	enabled := make(map[string]bool)
+	for _, table := range tables {
+		table = strings.TrimSpace(table)
+		if len(table) > 0 && !selfAuditedTables[table] {
+			enabled[table] = true
+		}
+	}
+
+	auditedTablesMutex.Lock()
+	auditedTables = enabled
+	auditedTablesMutex.Unlock()
+}
+
+// IsTableAudited returns true if changes of the table are audited
+func IsTableAudited(table string) bool {
+
+	auditedTablesMutex.RLock()
+	defer auditedTablesMutex.RUnlock()
+	return auditedTables[table]
+}
+
+// registerDBAuditCallbacks registers gorm callbacks writing audit rows for the audited tables.
+// The actor is taken from the query context, see GetDBWithContext and ContextWithActor.
+// Bulk updates and deletes without the primary key are not audited, they have no single record id
+func registerDBAuditCallbacks(db *gorm.DB) {
+
+	audit := func(operation string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			if scope.HasError() || scope.DB().RowsAffected == 0 || !IsTableAudited(scope.TableName()) || scope.PrimaryKeyZero() {
+				return
+			}
+
+			auditLog := &AuditLog{
+				Table:     scope.TableName(),
+				RecordID:  fmt.Sprint(scope.PrimaryKeyValue()),
+				Operation: operation,
+				ActorID:   ActorFromContext(scopeContext(scope)),
+				Columns:   auditedColumns(scope, operation),
+			}
+
+			// NewDB uses the connection of the scope, the row is written in the same transaction
+			if err := scope.NewDB().Create(auditLog).Error; err != nil {
+				scope.Err(fmt.Errorf("audit log: %v", err))
+			}
+		}
+	}
+
+	callback := db.Callback()
+	callback.Create().After("gorm:create").Register("cig:audit_create", audit(AuditOperationCreate))
+	callback.Update().After("gorm:update").Register("cig:audit_update", audit(AuditOperationUpdate))
+	callback.Delete().After("gorm:delete").Register("cig:audit_delete", audit(AuditOperationDelete))
+}
+
+// auditedColumns returns the sorted changed column names, updates with a map list the map columns only
+func auditedColumns(scope *gorm.Scope, operation string) []string {
+
+	columns := make([]string, 0)
+	switch operation {
+	case AuditOperationDelete:
+		return columns
+	case AuditOperationUpdate:
+		if attrs, ok := scope.InstanceGet("gorm:update_attrs"); ok {
+			if updateMap, ok := attrs.(map[string]interface{}); ok {
+				for column := range updateMap {
+					columns = append(columns, column)
+				}
+				sort.Strings(columns)
+				return columns
+			}
+		}
+	}
+
+	for _, field := range scope.Fields() {
+		if field.IsNormal && !field.IsIgnored && !field.IsBlank {
+			columns = append(columns, field.DBName)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
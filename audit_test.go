@@ -0,0 +1,32 @@
+package cigExchange
+
+import (
+	"testing"
+)
+
+func TestSetAuditedTables(t *testing.T) {
+
+	defer SetAuditedTables()
+
+	// offering has its own audit and isn't audited twice
+	SetAuditedTables(" user", "organisation ", "", "offering", "audit_log", "offering_audit")
+
+	expected := map[string]bool{
+		"user":           true,
+		"organisation":   true,
+		"media":          false,
+		"offering":       false,
+		"audit_log":      false,
+		"offering_audit": false,
+	}
+	for table, audited := range expected {
+		if got := IsTableAudited(table); got != audited {
+			t.Errorf("%s: expected %v, got %v", table, audited, got)
+		}
+	}
+
+	SetAuditedTables()
+	if IsTableAudited("user") {
+		t.Error("auditing is not disabled")
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,37 +29,106 @@ const (
 	PlatformTrading = "trading"
 )
 
+// IsValidPlatform returns true for the p2p and trading platforms
+func IsValidPlatform(platform string) bool {
+	return platform == PlatformP2P || platform == PlatformTrading
+}
+
+// ValidatePlatform returns required field error for missing platform and invalid field error for unknown platform
+func ValidatePlatform(platform string) *cigExchange.APIError {
+
+	if len(platform) == 0 {
+		return cigExchange.NewRequiredFieldError([]string{"platform"})
+	}
+
+	// user must use p2p or trading platform
+	if !IsValidPlatform(platform) {
+		return cigExchange.NewInvalidFieldError("platform", "Invalid platform parameter")
+	}
+	return nil
+}
+
 // Expiration time is one month
 const tokenExpirationTimeInMin = 60 * 24 * 31
 
+// Access tokens of "remember me" logins are short lived and renewed with the refresh token
+const accessTokenExpiration = 15 * time.Minute
+
+// Refresh token subject claim, access tokens have no subject
+const refreshTokenSubject = "refresh"
+
+// OTP codes expire after 5 minutes
+const otpExpiration = 5 * time.Minute
+
+// Failed OTP verifications are counted per user across the sent codes, a new code doesn't reset the counter.
+// Counter expires 30 minutes after the first failure, reaching the limit locks the verification out
+// for 30 minutes from the last failure, so the lockout outlives the codes sent during it.
+// Successful verification resets the counter
+const otpAttemptsExpiration = 30 * time.Minute
+
+// Signup responses are cached for replayed requests with the same Idempotency-Key for one day
+const idempotencyExpiration = 24 * time.Hour
+
 type userResponse struct {
 	UUID string `json:"uuid"`
 }
 
 type verificationCodeRequest struct {
-	UUID string `json:"uuid"`
-	Type string `json:"type"`
-	Code string `json:"code"`
+	UUID     string `json:"uuid"`
+	Type     string `json:"type"`
+	Code     string `json:"code"`
+	Remember bool   `json:"remember"`
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 // Constants for JwtResponse status
 const (
-	JWTResponseStatusFinished = "success"
-	JWTResponseStatusWebAuthn = "web authn"
+	JWTResponseStatusFinished             = "success"
+	JWTResponseStatusWebAuthn             = "web authn"
+	JWTResponseStatusWebAuthnRegistration = "web authn registration"
 )
 
 // JwtResponse structure
 type JwtResponse struct {
-	JWT    string `json:"jwt"`
-	Status string `json:"status"`
+	JWT          string     `json:"jwt"`
+	Status       string     `json:"status"`
+	IssuedAt     *time.Time `json:"issued_at,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	RefreshToken string     `json:"refresh_token,omitempty"`
+}
+
+// newJwtResponse creates finished JwtResponse with the token issue and expiry times
+func newJwtResponse(tokenString string, issuedAt, expiresAt int64) *JwtResponse {
+
+	issued := time.Unix(issuedAt, 0).UTC()
+	expires := time.Unix(expiresAt, 0).UTC()
+	return &JwtResponse{
+		JWT:       tokenString,
+		Status:    JWTResponseStatusFinished,
+		IssuedAt:  &issued,
+		ExpiresAt: &expires,
+	}
 }
 
 type infoResponse struct {
-	UserUUID         string `json:"user_id"`
-	Role             string `json:"role"`
+	UserUUID         string              `json:"user_id"`
+	Role             string              `json:"role"`
+	Platform         string              `json:"platform"`
+	OrganisationUUID string              `json:"organisation_id"`
+	OrganisationRole string              `json:"organisation_role"`
+	UserEmail        string              `json:"email"`
+	Organisations    []*infoOrganisation `json:"organisations"`
+}
+
+// infoOrganisation is a structure to represent the user organisation in the info response
+type infoOrganisation struct {
 	OrganisationUUID string `json:"organisation_id"`
-	OrganisationRole string `json:"organisation_role"`
-	UserEmail        string `json:"email"`
+	Name             string `json:"name"`
+	Role             string `json:"role"`
+	IsHome           bool   `json:"is_home"`
 }
 
 // UserRequest is a structure to represent the signup api request
@@ -71,6 +142,7 @@ type UserRequest struct {
 	ReferenceKey     string `json:"reference_key"`
 	Platform         string `json:"platform"`
 	WebAuthn         bool   `json:"webauthn"`
+	Captcha          string `json:"captcha"`
 }
 
 // ConvertRequestToUser convert UserRequest struct to User
@@ -81,6 +153,7 @@ func (user *UserRequest) ConvertRequestToUser() *models.User {
 	mUser.Role = models.UserRoleUser
 	mUser.Name = user.Name
 	mUser.LastName = user.LastName
+	mUser.Platform = user.Platform
 
 	mUser.LoginEmail = &models.Contact{Type: models.ContactTypeEmail, Level: models.ContactLevelPrimary, Value1: user.Email}
 	mUser.LoginPhone = &models.Contact{Type: models.ContactTypePhone, Level: models.ContactLevelSecondary, Value1: user.PhoneCountryCode, Value2: user.PhoneNumber}
@@ -98,6 +171,7 @@ type organisationRequest struct {
 	ReferenceKey     string `json:"reference_key"`
 	OrganisationName string `json:"organisation_name"`
 	WebAuthn         bool   `json:"webauthn"`
+	Captcha          string `json:"captcha"`
 }
 
 func (request *organisationRequest) convertRequestToUserAndOrganisation() (*models.User, *models.Organisation) {
@@ -121,11 +195,16 @@ func (request *organisationRequest) convertRequestToUserAndOrganisation() (*mode
 // UserAPI handles JWT auth and user management api calls
 type UserAPI struct {
 	SkipPrefix string
+	// MaxBodyBytes limits the request body size, cigExchange.DefaultMaxBodyBytes if not set
+	MaxBodyBytes int64
+	// SkipCaptcha returns true for requests of trusted clients not required to pass the signup captcha
+	SkipCaptcha func(r *http.Request) bool
 }
 
 type token struct {
 	UserUUID         string
 	OrganisationUUID string
+	SessionID        string `json:",omitempty"`
 	jwt.StandardClaims
 }
 
@@ -135,14 +214,63 @@ const (
 	keyJWT key = iota
 )
 
-// GenerateJWTString generates JWT token string based on user and organisation UUIDS
+// sessionExpiration is the session lifetime, "remember me" access tokens are renewed within the session
+const sessionExpiration = time.Minute * tokenExpirationTimeInMin
+
+// GenerateJWTString generates JWT token string based on user and organisation UUIDS.
+// New session without device metadata is created for the token
 func GenerateJWTString(userUUID, organisationUUID string) (string, *token, *cigExchange.APIError) {
+
+	session, apiError := newSession(userUUID, organisationUUID, nil)
+	if apiError != nil {
+		return "", nil, apiError
+	}
+	return generateAccessToken(session)
+}
+
+// newSession creates new session evicting the oldest user sessions above the limit
+func newSession(userUUID, organisationUUID string, info *cigExchange.ActivityInformation) (*cigExchange.Session, *cigExchange.APIError) {
+
+	apiError := cigExchange.LimitSessions(userUUID)
+	if apiError != nil {
+		return nil, apiError
+	}
+	return cigExchange.NewSession(userUUID, organisationUUID, info), nil
+}
+
+// generateAccessToken generates JWT access token for the session and saves it in the session
+func generateAccessToken(session *cigExchange.Session) (string, *token, *cigExchange.APIError) {
+
+	expiration := sessionExpiration
+	if session.Remember {
+		expiration = accessTokenExpiration
+	}
+
+	tokenString, tk, apiError := signJWT(session, "", expiration)
+	if apiError != nil {
+		return "", nil, apiError
+	}
+
+	// save token in redis session
+	session.Token = tokenString
+	apiError = session.Save(sessionExpiration)
+	if apiError != nil {
+		return "", nil, apiError
+	}
+
+	return tokenString, tk, nil
+}
+
+// signJWT generates JWT token string for the session with the expiration
+func signJWT(session *cigExchange.Session, subject string, expiration time.Duration) (string, *token, *cigExchange.APIError) {
 	tk := &token{
-		userUUID,
-		organisationUUID,
+		session.UserUUID,
+		session.OrganisationUUID,
+		session.ID,
 		jwt.StandardClaims{
 			IssuedAt:  time.Now().Unix(),
-			ExpiresAt: time.Now().Add(time.Minute * tokenExpirationTimeInMin).Unix(),
+			ExpiresAt: time.Now().Add(expiration).Unix(),
+			Subject:   subject,
 		},
 	}
 	token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), tk)
@@ -151,17 +279,120 @@ func GenerateJWTString(userUUID, organisationUUID string) (string, *token, *cigE
 		apiError := cigExchange.NewTokenError("Token generation failed", err)
 		return "", nil, apiError
 	}
+	return tokenString, tk, nil
+}
 
-	// save token in redis
-	redisKey := tk.UserUUID + "|" + tk.OrganisationUUID
+// TokenPair is a structure to represent the access token with the optional refresh token
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	access       *token
+}
 
-	redisCmd := cigExchange.GetRedis().Set(redisKey, tokenString, time.Minute*tokenExpirationTimeInMin)
-	if redisCmd.Err() != nil {
-		apiError := cigExchange.NewRedisError("Set token failure", redisCmd.Err())
-		return "", nil, apiError
+// GenerateTokenPair creates new session with device metadata from info and generates the access token.
+// "Remember me" logins get short lived access token and long lived refresh token,
+// without remember the single long lived access token is generated as before
+func GenerateTokenPair(userUUID, organisationUUID string, remember bool, info *cigExchange.ActivityInformation) (*TokenPair, *cigExchange.APIError) {
+
+	session, apiError := newSession(userUUID, organisationUUID, info)
+	if apiError != nil {
+		return nil, apiError
 	}
+	session.Remember = remember
 
-	return tokenString, tk, nil
+	accessString, tk, apiError := generateAccessToken(session)
+	if apiError != nil {
+		return nil, apiError
+	}
+	tokenPair := &TokenPair{AccessToken: accessString, access: tk}
+
+	if remember {
+		refreshString, _, apiError := signJWT(session, refreshTokenSubject, sessionExpiration)
+		if apiError != nil {
+			return nil, apiError
+		}
+
+		err := cigExchange.GetStore().Set(cigExchange.SessionRefreshRedisKey(userUUID, session.ID), refreshString, sessionExpiration)
+		if err != nil {
+			return nil, cigExchange.NewRedisError("Set refresh token failure", err)
+		}
+		tokenPair.RefreshToken = refreshString
+	}
+
+	return tokenPair, nil
+}
+
+// RefreshTokenHandler handles POST api/users/refresh endpoint
+func (userAPI *UserAPI) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	// create user activity record and print error with defer
+	info := cigExchange.PrepareActivityInformation(r)
+	defer CreateUserActivity(info, models.ActivityTypeRefreshToken)
+	defer cigExchange.PrintAPIError(info)
+
+	reqStruct := &refreshTokenRequest{}
+	if apiError := cigExchange.CheckJSONContentType(r); apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	// decode refreshTokenRequest object from request body
+	apiError := cigExchange.DecodeStrict(r.Body, reqStruct)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+	if len(reqStruct.RefreshToken) == 0 {
+		info.APIError = cigExchange.NewRequiredFieldError([]string{"refresh_token"})
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	tk := &token{}
+	parsed, err := jwt.ParseWithClaims(reqStruct.RefreshToken, tk, func(token *jwt.Token) (interface{}, error) {
+		return []byte(os.Getenv("TOKEN_PASSWORD")), nil
+	})
+	if err != nil || !parsed.Valid || tk.Subject != refreshTokenSubject || len(tk.SessionID) == 0 {
+		info.APIError = cigExchange.NewAccessForbiddenError("Refresh token is not valid.")
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	// check refresh token in redis
+	issuedRefreshToken, err := cigExchange.GetStore().Get(cigExchange.SessionRefreshRedisKey(tk.UserUUID, tk.SessionID))
+	if err != nil || issuedRefreshToken != reqStruct.RefreshToken {
+		info.APIError = cigExchange.NewAccessForbiddenError("Refresh token is not valid (not issued by the server).")
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	// organisation of the session can be switched after the refresh token was issued
+	session, apiError := cigExchange.GetSession(tk.UserUUID, tk.SessionID)
+	if apiError != nil {
+		info.APIError = cigExchange.NewAccessForbiddenError("Session is expired.")
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	accessString, access, apiError := generateAccessToken(session)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	info.LoggedInUser = &cigExchange.LoggedInUser{
+		UserUUID:         access.UserUUID,
+		OrganisationUUID: access.OrganisationUUID,
+		SessionID:        access.SessionID,
+		CreationDate:     time.Unix(access.IssuedAt, 0),
+		ExpirationDate:   time.Unix(access.ExpiresAt, 0),
+	}
+
+	resp := newJwtResponse(accessString, access.IssuedAt, access.ExpiresAt)
+	cigExchange.Respond(w, resp)
 }
 
 // GetContextValues extracts the userID and organisationID from the request context
@@ -170,7 +401,7 @@ func GetContextValues(r *http.Request) (loggedInUser *cigExchange.LoggedInUser,
 	// extract the entire token struct
 	tk, ok := r.Context().Value(keyJWT).(*token)
 	if !ok {
-		fmt.Println("GetContextValues: no context value exists")
+		cigExchange.Logger().Warn("GetContextValues: no context value exists")
 		err = fmt.Errorf("Invalid access token")
 		return
 	}
@@ -178,10 +409,11 @@ func GetContextValues(r *http.Request) (loggedInUser *cigExchange.LoggedInUser,
 	loggedInUser = &cigExchange.LoggedInUser{}
 	loggedInUser.UserUUID = tk.UserUUID
 	loggedInUser.OrganisationUUID = tk.OrganisationUUID
+	loggedInUser.SessionID = tk.SessionID
 	issued := time.Unix(tk.IssuedAt, 0)
 	expires := time.Unix(tk.ExpiresAt, 0)
 	if issued.IsZero() || expires.IsZero() {
-		fmt.Println("GetContextValues: broken context value")
+		cigExchange.Logger().Warn("GetContextValues: broken context value", "user_id", tk.UserUUID)
 		err = fmt.Errorf("Invalid access token")
 		return
 	}
@@ -192,10 +424,11 @@ func GetContextValues(r *http.Request) (loggedInUser *cigExchange.LoggedInUser,
 	return
 }
 
-// JwtAuthenticationHandler handles auth for endpoints
+// JwtAuthenticationHandler handles auth for endpoints.
+// Request bodies of all endpoints, including the skipped ones, are limited to MaxBodyBytes
 func (userAPI *UserAPI) JwtAuthenticationHandler(next http.Handler) http.Handler {
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return cigExchange.MaxBodyBytes(userAPI.MaxBodyBytes)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		// current request path
 		requestPath := r.URL.Path
@@ -206,11 +439,15 @@ func (userAPI *UserAPI) JwtAuthenticationHandler(next http.Handler) http.Handler
 			return
 		}
 
+		// record validation outcome, failure unless the request is passed further
+		outcome := cigExchange.MetricOutcomeFailure
+		defer func() { cigExchange.GetMetrics().JWTValidated(outcome) }()
+
 		tokenHeader := r.Header.Get("Authorization") // Grab the token from the header
 
 		if tokenHeader == "" { // Token is missing, returns with error code 403 Unauthorized
 			apiError := cigExchange.NewAccessForbiddenError("Missing auth token.")
-			fmt.Println(apiError.ToString())
+			cigExchange.LogAPIError("JwtAuthentication: request rejected", apiError)
 			cigExchange.RespondWithAPIError(w, apiError)
 			return
 		}
@@ -219,7 +456,7 @@ func (userAPI *UserAPI) JwtAuthenticationHandler(next http.Handler) http.Handler
 		splitted := strings.Split(tokenHeader, " ")
 		if len(splitted) != 2 {
 			apiError := cigExchange.NewAccessForbiddenError("Invalid/Malformed auth token.")
-			fmt.Println(apiError.ToString())
+			cigExchange.LogAPIError("JwtAuthentication: request rejected", apiError)
 			cigExchange.RespondWithAPIError(w, apiError)
 			return
 		}
@@ -233,39 +470,95 @@ func (userAPI *UserAPI) JwtAuthenticationHandler(next http.Handler) http.Handler
 
 		if err != nil { // Malformed token, returns with http code 403 as usual
 			apiError := cigExchange.NewAccessForbiddenError("Malformed authentication token.")
-			fmt.Println(apiError.ToString())
+			cigExchange.LogAPIError("JwtAuthentication: request rejected", apiError)
 			cigExchange.RespondWithAPIError(w, apiError)
 			return
 		}
 
 		if !token.Valid { // Token is invalid, maybe not signed on this server
 			apiError := cigExchange.NewAccessForbiddenError("Token is not valid.")
-			fmt.Println(apiError.ToString())
+			cigExchange.LogAPIError("JwtAuthentication: request rejected", apiError)
 			cigExchange.RespondWithAPIError(w, apiError)
 			return
 		}
 
-		// check token in redis
-		redisKey := tk.UserUUID + "|" + tk.OrganisationUUID
-		redisCmd := cigExchange.GetRedis().Get(redisKey)
-		if redisCmd.Err() != nil {
-			apiError := cigExchange.NewAccessForbiddenError("Token is not valid (not issued by the server).")
-			fmt.Println(apiError.ToString())
+		// refresh tokens can't be used as access tokens
+		if tk.Subject == refreshTokenSubject {
+			apiError := cigExchange.NewAccessForbiddenError("Token is not valid.")
+			cigExchange.LogAPIError("JwtAuthentication: request rejected", apiError)
 			cigExchange.RespondWithAPIError(w, apiError)
 			return
 		}
-		if redisCmd.Val() != tokenPart {
+
+		// check token in redis session, tokens issued before sessions are stored by user and organisation
+		issuedToken := ""
+		if len(tk.SessionID) > 0 {
+			session, apiError := cigExchange.GetSession(tk.UserUUID, tk.SessionID)
+			if apiError != nil {
+				apiError = cigExchange.NewAccessForbiddenError("Token is not valid (not issued by the server).")
+				cigExchange.LogAPIError("JwtAuthentication: request rejected", apiError)
+				cigExchange.RespondWithAPIError(w, apiError)
+				return
+			}
+			issuedToken = session.Token
+		} else {
+			redisKey := tk.UserUUID + "|" + tk.OrganisationUUID
+			value, err := cigExchange.GetStore().Get(redisKey)
+			if err != nil {
+				apiError := cigExchange.NewAccessForbiddenError("Token is not valid (not issued by the server).")
+				cigExchange.LogAPIError("JwtAuthentication: request rejected", apiError)
+				cigExchange.RespondWithAPIError(w, apiError)
+				return
+			}
+			issuedToken = value
+		}
+		if issuedToken != tokenPart {
 			apiError := cigExchange.NewAccessForbiddenError("Token is corrupted (not issued by the server).")
-			fmt.Println(apiError.ToString())
+			cigExchange.LogAPIError("JwtAuthentication: request rejected", apiError)
 			cigExchange.RespondWithAPIError(w, apiError)
 			return
 		}
 
 		// Everything went well, proceed with the request and set the caller to the user retrieved from the parsed token
 		ctx := context.WithValue(r.Context(), keyJWT, tk)
+		ctx = cigExchange.ContextWithActor(ctx, tk.UserUUID)
 
 		r = r.WithContext(ctx)
+		outcome = cigExchange.MetricOutcomeSuccess
 		// proceed in the middleware chain!
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// RecoverHandler recovers handler panics, logs the stack, records the panic activity and responds with 500.
+// It should wrap the whole handler chain
+func (userAPI *UserAPI) RecoverHandler(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// aborted response is handled by net/http
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			cigExchange.Logger().Error("RecoverHandler: handler panic",
+				"panic", fmt.Sprint(recovered),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"stack", string(debug.Stack()),
+			)
+
+			info := cigExchange.PrepareActivityInformation(r)
+			info.APIError = cigExchange.NewInternalServerError(cigExchange.ReasonHandlerPanic, "Request processing failed")
+			CreateUserActivity(info, models.ActivityTypePanic)
+			cigExchange.RespondWithAPIError(w, info.APIError)
+		}()
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -281,10 +574,10 @@ func (userAPI *UserAPI) CreateUserHandlerPingdom(w http.ResponseWriter, r *http.
 
 	userReq := &UserRequest{}
 	// decode user object from request body
-	err := json.NewDecoder(reader).Decode(userReq)
-	if err != nil {
-		fmt.Printf("PingdomSignup: error decoding request body: %v", err.Error())
-		cigExchange.RespondWithAPIError(w, cigExchange.NewRequestDecodingError(err))
+	apiError := cigExchange.DecodeStrict(reader, userReq)
+	if apiError != nil {
+		cigExchange.LogAPIError("PingdomSignup: error decoding request body", apiError)
+		cigExchange.RespondWithAPIError(w, apiError)
 		return
 	}
 
@@ -295,57 +588,77 @@ func (userAPI *UserAPI) CreateUserHandlerPingdom(w http.ResponseWriter, r *http.
 	// call the original api call
 	userAPI.CreateUserHandler(w, r)
 
-	user, apiError := models.GetUserByEmail(userReq.Email, false)
+	user, apiError := models.GetUserByEmailCtx(r.Context(), userReq.Email, false)
 	if apiError != nil {
-		fmt.Printf("PingdomSignup: error during user lookup: %v", apiError.ToString())
+		cigExchange.LogAPIError("PingdomSignup: error during user lookup", apiError)
 		return
 	}
 
 	// user should be unverified
 	if user.Status != models.UserStatusUnverified {
-		fmt.Printf("PingdomSignup: error during user lookup: unexpected user status [active]")
+		cigExchange.Logger().Error("PingdomSignup: error during user lookup: unexpected user status", "status", user.Status)
 		return
 	}
 
 	// delete user and all associated objects
 	apiError = models.DeleteUnverifiedUser(user)
 	if apiError != nil {
-		fmt.Printf("PingdomSignup: error during user deletion: %v", apiError.ToString())
+		cigExchange.LogAPIError("PingdomSignup: error during user deletion", apiError)
 		return
 	}
 }
 
 // CreateUserHandler handles POST api/users/signup endpoint
+// Requests with Idempotency-Key header are processed only once
 func (userAPI *UserAPI) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 
+	key, apiError := cigExchange.GetIdempotencyKey(r, "", cigExchange.KeyIdempotencySignUp)
+	if apiError != nil {
+		cigExchange.LogAPIError("Idempotency: request rejected", apiError)
+		cigExchange.RespondWithAPIError(w, apiError)
+		return
+	}
+	cigExchange.WithIdempotency(key, idempotencyExpiration, w, func(w http.ResponseWriter) {
+		userAPI.createUser(w, r)
+	})
+}
+
+func (userAPI *UserAPI) createUser(w http.ResponseWriter, r *http.Request) {
+
 	// create user activity record and print error with defer
 	info := cigExchange.PrepareActivityInformation(r)
 	defer CreateUserActivity(info, models.ActivityTypeSignUp)
 	defer cigExchange.PrintAPIError(info)
+	defer func() { cigExchange.GetMetrics().SignUp(cigExchange.MetricOutcome(info.APIError)) }()
 
 	resp := &userResponse{}
 	resp.UUID = cigExchange.RandomUUID()
 
 	userReq := &UserRequest{}
 
+	if apiError := cigExchange.CheckJSONContentType(r); apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
 	// decode user object from request body
-	err := json.NewDecoder(r.Body).Decode(userReq)
-	if err != nil {
-		info.APIError = cigExchange.NewRequestDecodingError(err)
+	apiError := cigExchange.DecodeStrict(r.Body, userReq)
+	if apiError != nil {
+		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
-	// check that we received 'platform' parameter
-	if len(userReq.Platform) == 0 {
-		info.APIError = cigExchange.NewRequiredFieldError([]string{"platform"})
+	if apiError := userAPI.verifyCaptcha(r, userReq.Captcha); apiError != nil {
+		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
-	// user must use p2p or trading platform
-	if userReq.Platform != PlatformP2P && userReq.Platform != PlatformTrading {
-		info.APIError = cigExchange.NewInvalidFieldError("platform", "Invalid platform parameter")
+	// check 'platform' parameter
+	if apiError := ValidatePlatform(userReq.Platform); apiError != nil {
+		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
@@ -360,7 +673,7 @@ func (userAPI *UserAPI) CreateUserHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	// try to create user
-	createdUser, apiError := models.CreateUser(user, userReq.ReferenceKey)
+	createdUser, apiError := models.CreateUserCtx(r.Context(), user, userReq.ReferenceKey)
 	if apiError != nil {
 		info.APIError = apiError
 		if info.APIError.ShouldSilenceError() {
@@ -373,7 +686,7 @@ func (userAPI *UserAPI) CreateUserHandler(w http.ResponseWriter, r *http.Request
 
 	// handle web authn
 	if userReq.WebAuthn {
-		response, apiError := beginWebAuthnRegistration(createdUser)
+		response, apiError := beginWebAuthnRegistration(createdUser, false)
 		if apiError != nil {
 			info.APIError = apiError
 			cigExchange.RespondWithAPIError(w, info.APIError)
@@ -385,12 +698,23 @@ func (userAPI *UserAPI) CreateUserHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	// send welcome email async
-	cigExchange.SendWelcomeEmailAsync(userReq.Email)
+	if !cigExchange.IsWelcomeEmailOnVerify() {
+		cigExchange.SendWelcomeEmailAsync(userReq.Email)
+	}
 
 	resp.UUID = createdUser.ID
 	cigExchange.Respond(w, resp)
 }
 
+// verifyCaptcha verifies the signup captcha unless the request is from a trusted client
+func (userAPI *UserAPI) verifyCaptcha(r *http.Request, token string) *cigExchange.APIError {
+
+	if userAPI.SkipCaptcha != nil && userAPI.SkipCaptcha(r) {
+		return nil
+	}
+	return cigExchange.VerifyCaptcha(token, cigExchange.ClientIP(r))
+}
+
 // CreateUserWebAuthnHandler handles POST api/users/signup/{user_id}/webauthn endpoint
 func (userAPI *UserAPI) CreateUserWebAuthnHandler(w http.ResponseWriter, r *http.Request) {
 
@@ -407,27 +731,33 @@ func (userAPI *UserAPI) CreateUserWebAuthnHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	user, apiError := models.GetUser(userID)
+	user, apiError := models.GetUserCtx(r.Context(), userID)
 	if apiError != nil {
 		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
-	// get redis key
+	// get redis key, enrollment after the login verification uses a separate key
+	enrollment := false
 	rediskey := cigExchange.GenerateRedisKey(user.ID, cigExchange.KeyWebAuthnRegister)
 
 	// get session id json
-	redisCmd := cigExchange.GetRedis().Get(rediskey)
-	if redisCmd.Err() != nil {
-		info.APIError = cigExchange.NewRedisError("Get session failure", redisCmd.Err())
+	sessionJSON, err := cigExchange.GetStore().Get(rediskey)
+	if err == cigExchange.ErrKeyNotFound {
+		enrollment = true
+		rediskey = cigExchange.GenerateRedisKey(user.ID, cigExchange.KeyWebAuthnEnroll)
+		sessionJSON, err = cigExchange.GetStore().Get(rediskey)
+	}
+	if err != nil {
+		info.APIError = cigExchange.NewRedisError("Get session failure", err)
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
 	sessionData := webauthn.SessionData{}
-	if err := json.Unmarshal([]byte(redisCmd.Val()), &sessionData); err != nil {
-		info.APIError = cigExchange.NewRedisError("Get session failure. Can't parse redis value", redisCmd.Err())
+	if err := json.Unmarshal([]byte(sessionJSON), &sessionData); err != nil {
+		info.APIError = cigExchange.NewRedisError("Get session failure. Can't parse redis value", err)
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
@@ -455,8 +785,13 @@ func (userAPI *UserAPI) CreateUserWebAuthnHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	// send welcome email async
-	if user.LoginEmail != nil && len(user.LoginEmail.Value1) > 0 {
+	// registration session can be used only once
+	if _, err := cigExchange.GetStore().Del(rediskey); err != nil {
+		cigExchange.LogAPIError("CreateUserWebAuthn", cigExchange.NewRedisError("Delete session failure", err))
+	}
+
+	// send welcome email async, enrolled users got it at signup
+	if !enrollment && !cigExchange.IsWelcomeEmailOnVerify() && user.LoginEmail != nil && len(user.LoginEmail.Value1) > 0 {
 		cigExchange.SendWelcomeEmailAsync(user.LoginEmail.Value1)
 	}
 
@@ -468,7 +803,9 @@ type registrationOptions struct {
 	UUID string `json:"uuid"`
 }
 
-func beginWebAuthnRegistration(createdUser *models.User) (*registrationOptions, *cigExchange.APIError) {
+// beginWebAuthnRegistration stores the registration session and returns the registration options.
+// Enrollment is the registration of the existing user required to use WebAuthn by the organisation
+func beginWebAuthnRegistration(createdUser *models.User, enrollment bool) (*registrationOptions, *cigExchange.APIError) {
 	// generate session data and public key
 	options, sessionData, err := cigExchange.GetWebAuthn().BeginRegistration(createdUser)
 	if err != nil {
@@ -477,6 +814,9 @@ func beginWebAuthnRegistration(createdUser *models.User) (*registrationOptions,
 
 	// get redis key uuid_web_authn
 	rediskey := cigExchange.GenerateRedisKey(createdUser.ID, cigExchange.KeyWebAuthnRegister)
+	if enrollment {
+		rediskey = cigExchange.GenerateRedisKey(createdUser.ID, cigExchange.KeyWebAuthnEnroll)
+	}
 	expiration := 5 * time.Minute
 
 	// marshal session data for storing in redis
@@ -485,9 +825,9 @@ func beginWebAuthnRegistration(createdUser *models.User) (*registrationOptions,
 		return nil, cigExchange.NewRequestDecodingError(err)
 	}
 
-	redisCmd := cigExchange.GetRedis().Set(rediskey, string(session), expiration)
-	if redisCmd.Err() != nil {
-		return nil, cigExchange.NewRedisError("Set web authn failure", redisCmd.Err())
+	err = cigExchange.GetStore().Set(rediskey, string(session), expiration)
+	if err != nil {
+		return nil, cigExchange.NewRedisError("Set web authn failure", err)
 	}
 
 	// fill response struct
@@ -499,18 +839,44 @@ func beginWebAuthnRegistration(createdUser *models.User) (*registrationOptions,
 }
 
 // CreateOrganisationHandler handles POST api/organisations/signup endpoint
+// Requests with Idempotency-Key header are processed only once
 func (userAPI *UserAPI) CreateOrganisationHandler(w http.ResponseWriter, r *http.Request) {
 
+	key, apiError := cigExchange.GetIdempotencyKey(r, "", cigExchange.KeyIdempotencyOrganisationSignUp)
+	if apiError != nil {
+		cigExchange.LogAPIError("Idempotency: request rejected", apiError)
+		cigExchange.RespondWithAPIError(w, apiError)
+		return
+	}
+	cigExchange.WithIdempotency(key, idempotencyExpiration, w, func(w http.ResponseWriter) {
+		userAPI.createOrganisation(w, r)
+	})
+}
+
+func (userAPI *UserAPI) createOrganisation(w http.ResponseWriter, r *http.Request) {
+
 	// create user activity record and print error with defer
 	info := cigExchange.PrepareActivityInformation(r)
 	defer CreateUserActivity(info, models.ActivityTypeOrganisationSignUp)
 	defer cigExchange.PrintAPIError(info)
 
 	orgRequest := &organisationRequest{}
+	if apiError := cigExchange.CheckJSONContentType(r); apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
 	// decode organisation request object from request body
-	err := json.NewDecoder(r.Body).Decode(orgRequest)
-	if err != nil {
-		info.APIError = cigExchange.NewRequestDecodingError(err)
+	apiError := cigExchange.DecodeStrict(r.Body, orgRequest)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	if apiError := userAPI.verifyCaptcha(r, orgRequest.Captcha); apiError != nil {
+		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
@@ -523,7 +889,7 @@ func (userAPI *UserAPI) CreateOrganisationHandler(w http.ResponseWriter, r *http
 	resp.UUID = cigExchange.RandomUUID()
 
 	// check user
-	apiError := user.TrimFieldsAndValidate()
+	apiError = user.TrimFieldsAndValidate()
 	if apiError != nil {
 		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
@@ -531,7 +897,7 @@ func (userAPI *UserAPI) CreateOrganisationHandler(w http.ResponseWriter, r *http
 	}
 
 	// query user by email. Email checked in TrimFieldsAndValidate.
-	existingUser, apiError := models.GetUserByEmail(user.LoginEmail.Value1, true)
+	existingUser, apiError := models.GetUserByEmailCtx(r.Context(), user.LoginEmail.Value1, true)
 	if apiError != nil {
 		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
@@ -551,27 +917,21 @@ func (userAPI *UserAPI) CreateOrganisationHandler(w http.ResponseWriter, r *http
 	}
 
 	// get organisation by reference key
-	orgRefWhere := &models.Organisation{
-		ReferenceKey: organisation.ReferenceKey,
-	}
-	orgRef := &models.Organisation{}
-	db := cigExchange.GetDB().Where(orgRefWhere).First(orgRef)
-	if db.Error != nil {
+	orgRef, apiError := models.GetOrganisationByReferenceKeyCtx(r.Context(), organisation.ReferenceKey)
+	if apiError != nil {
 		// handle database error
-		if !db.RecordNotFound() {
-			info.APIError = cigExchange.NewDatabaseError("Organization lookup failed", db.Error)
+		if len(apiError.Errors) == 0 || apiError.Errors[0].Reason != cigExchange.ReasonOrganisationDoesntExist {
+			info.APIError = apiError
 			cigExchange.RespondWithAPIError(w, info.APIError)
 			return
 		}
 		// organisation with reference key doesn't exist
 		orgRef = nil
-	} else {
-		if orgRef.Name != organisation.Name {
-			// reference key already in use by another organisation
-			info.APIError = cigExchange.NewInvalidFieldError("reference_key", "Organisation reference key already in use")
-			cigExchange.RespondWithAPIError(w, info.APIError)
-			return
-		}
+	} else if orgRef.Name != organisation.Name {
+		// reference key already in use by another organisation
+		info.APIError = cigExchange.NewInvalidFieldError("reference_key", "Organisation reference key already in use")
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
 	}
 
 	// check that organisation doesn't exist
@@ -579,7 +939,7 @@ func (userAPI *UserAPI) CreateOrganisationHandler(w http.ResponseWriter, r *http
 		Name: organisation.Name,
 	}
 	org := &models.Organisation{}
-	db = cigExchange.GetDB().Where(orgWhere).First(org)
+	db := cigExchange.GetDB().Where(orgWhere).First(org)
 	if db.Error != nil {
 		// handle database error
 		if !db.RecordNotFound() {
@@ -627,6 +987,25 @@ func (userAPI *UserAPI) CreateOrganisationHandler(w http.ResponseWriter, r *http
 		}
 	}
 
+	// the caller becomes the organisation admin, existing organisation must not have other members
+	if org != nil {
+		orgUsers, apiError := models.GetOrganisationUsersForOrganisation(org.ID)
+		if apiError != nil {
+			info.APIError = apiError
+			cigExchange.RespondWithAPIError(w, info.APIError)
+			return
+		}
+		userID := ""
+		if existingUser != nil {
+			userID = existingUser.ID
+		}
+		if hasOtherOrganisationMembers(orgUsers, userID) {
+			info.APIError = cigExchange.NewAccessRightsError("Organisation already exists. Please ask admin of the organisation to invite you")
+			cigExchange.RespondWithAPIError(w, info.APIError)
+			return
+		}
+	}
+
 	// existingUser and org can be nil at this point
 
 	// organisation doesn't exists
@@ -643,7 +1022,7 @@ func (userAPI *UserAPI) CreateOrganisationHandler(w http.ResponseWriter, r *http
 	// user doesn't exists
 	if existingUser == nil {
 		// try to create user with reference key
-		existingUser, apiError = models.CreateUser(user, org.ReferenceKey)
+		existingUser, apiError = models.CreateUserCtx(r.Context(), user, org.ReferenceKey)
 		if apiError != nil {
 			info.APIError = apiError
 			if apiError.ShouldSilenceError() {
@@ -674,7 +1053,7 @@ func (userAPI *UserAPI) CreateOrganisationHandler(w http.ResponseWriter, r *http
 		orgUser = &models.OrganisationUser{
 			UserID:           existingUser.ID,
 			OrganisationID:   org.ID,
-			OrganisationRole: models.OrganisationRoleUser,
+			OrganisationRole: models.OrganisationRoleAdmin,
 			IsHome:           false,
 			Status:           models.OrganisationUserStatusUnverified,
 		}
@@ -684,11 +1063,21 @@ func (userAPI *UserAPI) CreateOrganisationHandler(w http.ResponseWriter, r *http
 			cigExchange.RespondWithAPIError(w, info.APIError)
 			return
 		}
+	} else if orgUser.Status == models.OrganisationUserStatusUnverified && orgUser.OrganisationRole != models.OrganisationRoleAdmin {
+		// organisation creator is designated as admin, the role is granted on verification.
+		// The caller is the only organisation member, checked above
+		orgUser.OrganisationRole = models.OrganisationRoleAdmin
+		apiError = orgUser.Update()
+		if apiError != nil {
+			info.APIError = apiError
+			cigExchange.RespondWithAPIError(w, info.APIError)
+			return
+		}
 	}
 
 	// handle web authn
 	if orgRequest.WebAuthn {
-		response, apiError := beginWebAuthnRegistration(existingUser)
+		response, apiError := beginWebAuthnRegistration(existingUser, false)
 		if apiError != nil {
 			info.APIError = apiError
 			cigExchange.RespondWithAPIError(w, info.APIError)
@@ -700,12 +1089,25 @@ func (userAPI *UserAPI) CreateOrganisationHandler(w http.ResponseWriter, r *http
 	}
 
 	// send welcome email async
-	cigExchange.SendWelcomeEmailAsync(orgRequest.Email)
+	if !cigExchange.IsWelcomeEmailOnVerify() {
+		cigExchange.SendWelcomeEmailAsync(orgRequest.Email)
+	}
 
 	resp.UUID = existingUser.ID
 	cigExchange.Respond(w, resp)
 }
 
+// hasOtherOrganisationMembers returns true if any organisation membership belongs to another user
+func hasOtherOrganisationMembers(orgUsers []*models.OrganisationUser, userID string) bool {
+
+	for _, orgUser := range orgUsers {
+		if orgUser.UserID != userID {
+			return true
+		}
+	}
+	return false
+}
+
 // GetUserHandler handles POST api/users/signin endpoint
 func (userAPI *UserAPI) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 
@@ -713,31 +1115,28 @@ func (userAPI *UserAPI) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 	info := cigExchange.PrepareActivityInformation(r)
 	defer CreateUserActivity(info, models.ActivityTypeSignIn)
 	defer cigExchange.PrintAPIError(info)
+	defer func() { cigExchange.GetMetrics().SignIn("otp", cigExchange.MetricOutcome(info.APIError)) }()
 
 	resp := &userResponse{}
 	resp.UUID = cigExchange.RandomUUID()
 
 	userReq := &UserRequest{}
-	// decode user object from request body
-	err := json.NewDecoder(r.Body).Decode(userReq)
-	if err != nil {
-		info.APIError = cigExchange.NewRequestDecodingError(err)
+	if apiError := cigExchange.CheckJSONContentType(r); apiError != nil {
+		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
-	var apiError *cigExchange.APIError
-	user := &models.User{}
-	// login using email or phone number
-	if len(userReq.Email) > 0 {
-		user, apiError = models.GetUserByEmail(userReq.Email, false)
-	} else if len(userReq.PhoneCountryCode) > 0 && len(userReq.PhoneNumber) > 0 {
-		user, apiError = models.GetUserByMobile(userReq.PhoneCountryCode, userReq.PhoneNumber)
-	} else {
-		// neither email or phone specified
-		apiError = cigExchange.NewRequiredFieldError([]string{"email", "phone_number", "phone_country_code"})
+	// decode user object from request body
+	apiError := cigExchange.DecodeStrict(r.Body, userReq)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
 	}
 
+	// login using email or phone number
+	user, apiError := models.GetUserByEmailOrPhoneCtx(r.Context(), userReq.Email, userReq.PhoneCountryCode, userReq.PhoneNumber)
 	if apiError != nil {
 		info.APIError = apiError
 		if apiError.ShouldSilenceError() {
@@ -759,6 +1158,7 @@ func (userAPI *UserAPI) GetUserWebAuthnHandler(w http.ResponseWriter, r *http.Re
 	info := cigExchange.PrepareActivityInformation(r)
 	defer CreateUserActivity(info, models.ActivityTypeSignUpWebAuth)
 	defer cigExchange.PrintAPIError(info)
+	defer func() { cigExchange.GetMetrics().SignIn("webauthn", cigExchange.MetricOutcome(info.APIError)) }()
 
 	userID := mux.Vars(r)["user_id"]
 
@@ -768,7 +1168,7 @@ func (userAPI *UserAPI) GetUserWebAuthnHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	user, apiError := models.GetUser(userID)
+	user, apiError := models.GetUserCtx(r.Context(), userID)
 	if apiError != nil {
 		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
@@ -779,28 +1179,28 @@ func (userAPI *UserAPI) GetUserWebAuthnHandler(w http.ResponseWriter, r *http.Re
 	rediskey := cigExchange.GenerateRedisKey(user.ID, cigExchange.KeyWebAuthnLogin)
 
 	// get session id json
-	redisCmd := cigExchange.GetRedis().Get(rediskey)
-	if redisCmd.Err() != nil {
-		info.APIError = cigExchange.NewRedisError("Get login session failure", redisCmd.Err())
+	sessionJSON, err := cigExchange.GetStore().Get(rediskey)
+	if err != nil {
+		info.APIError = cigExchange.NewRedisError("Get login session failure", err)
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
 	sessionData := webauthn.SessionData{}
-	if err := json.Unmarshal([]byte(redisCmd.Val()), &sessionData); err != nil {
-		info.APIError = cigExchange.NewRedisError("Get session failure. Can't parse redis value", redisCmd.Err())
+	if err := json.Unmarshal([]byte(sessionJSON), &sessionData); err != nil {
+		info.APIError = cigExchange.NewRedisError("Get session failure. Can't parse redis value", err)
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
-	_, err := cigExchange.GetWebAuthn().FinishLogin(user, sessionData, r)
+	_, err = cigExchange.GetWebAuthn().FinishLogin(user, sessionData, r)
 	if err != nil {
 		info.APIError = cigExchange.NewInternalServerError("Web Auth finish registration failed", err.Error())
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
-	organisationUser, apiError := selectHomeOrganisation(user)
+	organisationUser, apiError := selectHomeOrganisation(r.Context(), user)
 	if apiError != nil {
 		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
@@ -808,13 +1208,14 @@ func (userAPI *UserAPI) GetUserWebAuthnHandler(w http.ResponseWriter, r *http.Re
 	}
 
 	// verification passed, generate jwt and return it
-	tokenString, token, apiError := GenerateJWTString(user.ID, organisationUser.OrganisationID)
+	tokenPair, apiError := GenerateTokenPair(user.ID, organisationUser.OrganisationID, false, info)
 
 	if apiError != nil {
 		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
+	tokenString, token := tokenPair.AccessToken, tokenPair.access
 
 	loggedInUser := &cigExchange.LoggedInUser{}
 	loggedInUser.UserUUID = token.UserUUID
@@ -824,10 +1225,7 @@ func (userAPI *UserAPI) GetUserWebAuthnHandler(w http.ResponseWriter, r *http.Re
 
 	info.LoggedInUser = loggedInUser
 
-	resp := &JwtResponse{
-		JWT:    tokenString,
-		Status: JWTResponseStatusFinished,
-	}
+	resp := newJwtResponse(tokenString, token.IssuedAt, token.ExpiresAt)
 	cigExchange.Respond(w, resp)
 	CreateUserActivity(info, models.ActivityTypeSessionLength)
 }
@@ -841,15 +1239,22 @@ func (userAPI *UserAPI) SendCodeHandler(w http.ResponseWriter, r *http.Request)
 	defer cigExchange.PrintAPIError(info)
 
 	reqStruct := &verificationCodeRequest{}
+	defer func() { cigExchange.GetMetrics().OTPSent(reqStruct.Type, cigExchange.MetricOutcome(info.APIError)) }()
+	if apiError := cigExchange.CheckJSONContentType(r); apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
 	// decode verificationCodeRequest object from request body
-	err := json.NewDecoder(r.Body).Decode(reqStruct)
-	if err != nil {
-		info.APIError = cigExchange.NewRequestDecodingError(err)
+	apiError := cigExchange.DecodeStrict(r.Body, reqStruct)
+	if apiError != nil {
+		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
-	user, apiError := models.GetUser(reqStruct.UUID)
+	user, apiError := models.GetUserCtx(r.Context(), reqStruct.UUID)
 	if apiError != nil {
 		info.APIError = apiError
 		if apiError.ShouldSilenceError() {
@@ -875,15 +1280,31 @@ func (userAPI *UserAPI) SendCodeHandler(w http.ResponseWriter, r *http.Request)
 			cigExchange.RespondWithAPIError(w, info.APIError)
 			return
 		}
+		// in "DEV" environment with ALLOW_OTP_IN_RESPONSE the fixed phone code is used instead of Twilio
+		if cigExchange.IsOTPInResponseAllowed() {
+			rediskey := cigExchange.GenerateRedisKey(reqStruct.UUID, cigExchange.KeySignUpPhone)
+
+			err := cigExchange.GetStore().Set(rediskey, cigExchange.DevPhoneOTPCode, otpExpiration)
+			if err != nil {
+				info.APIError = cigExchange.NewRedisError("Set code failure", err)
+				cigExchange.RespondWithAPIError(w, info.APIError)
+				return
+			}
+
+			resp := make(map[string]string, 0)
+			resp["code"] = cigExchange.DevPhoneOTPCode
+			cigExchange.Respond(w, resp)
+			return
+		}
 		// process the send OTP async so that client won't see any delays
-		go func() {
+		ctx := context.WithoutCancel(r.Context())
+		cigExchange.RunAsync(func() {
 			twilioClient := cigExchange.GetTwilio()
-			_, err = twilioClient.ReceiveOTP(user.LoginPhone.Value1, user.LoginPhone.Value2)
+			_, err := twilioClient.ReceiveOTPCtx(ctx, user.LoginPhone.Value1, user.LoginPhone.Value2)
 			if err != nil {
-				fmt.Println("SendCode: twillio error:")
-				fmt.Println(err.Error())
+				cigExchange.Logger().Error("SendCode: twilio error", "user_id", user.ID, "error", err.Error())
 			}
-		}()
+		})
 	} else if reqStruct.Type == "email" {
 		if user.LoginEmail == nil {
 			info.APIError = cigExchange.NewInvalidFieldError("type", "User doesn't have email")
@@ -891,30 +1312,29 @@ func (userAPI *UserAPI) SendCodeHandler(w http.ResponseWriter, r *http.Request)
 			return
 		}
 		rediskey := cigExchange.GenerateRedisKey(reqStruct.UUID, cigExchange.KeySignUp)
-		expiration := 5 * time.Minute
 
 		code := cigExchange.RandCode(6)
-		redisCmd := cigExchange.GetRedis().Set(rediskey, code, expiration)
-		if redisCmd.Err() != nil {
-			info.APIError = cigExchange.NewRedisError("Set code failure", redisCmd.Err())
+		err := cigExchange.GetStore().Set(rediskey, code, otpExpiration)
+		if err != nil {
+			info.APIError = cigExchange.NewRedisError("Set code failure", err)
 			cigExchange.RespondWithAPIError(w, info.APIError)
 			return
 		}
 		// process the send OTP async so that client won't see any delays
-		go func() {
+		ctx := context.WithoutCancel(r.Context())
+		cigExchange.RunAsync(func() {
 			parameters := map[string]string{
 				"pincode": code,
 			}
-			err = cigExchange.SendEmail(cigExchange.EmailTypePinCode, user.LoginEmail.Value1, parameters)
+			err := cigExchange.SendEmailCtx(ctx, cigExchange.EmailTypePinCode, user.LoginEmail.Value1, parameters)
 			if err != nil {
-				fmt.Println("SendCode: email sending error:")
-				fmt.Println(err.Error())
+				cigExchange.Logger().Error("SendCode: email sending error", "user_id", user.ID, "error", err.Error())
 				return
 			}
-		}()
+		})
 
-		// in "DEV" environment we return the email signup code for testing purposes
-		if cigExchange.IsDevEnv() {
+		// in "DEV" environment with ALLOW_OTP_IN_RESPONSE we return the email signup code for testing purposes
+		if cigExchange.IsOTPInResponseAllowed() {
 			resp := make(map[string]string, 0)
 			resp["code"] = code
 			cigExchange.Respond(w, resp)
@@ -942,16 +1362,23 @@ func (userAPI *UserAPI) VerifyCodeHandler(w http.ResponseWriter, r *http.Request
 	secureErrorResponse.NewNestedError(cigExchange.ReasonFieldInvalid, "Invalid code")
 
 	reqStruct := &verificationCodeRequest{}
+	defer func() { cigExchange.GetMetrics().OTPVerified(reqStruct.Type, cigExchange.MetricOutcome(info.APIError)) }()
+	if apiError := cigExchange.CheckJSONContentType(r); apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
 	// decode verificationCodeRequest object from request body
-	err := json.NewDecoder(r.Body).Decode(reqStruct)
-	if err != nil {
-		info.APIError = cigExchange.NewRequestDecodingError(err)
+	apiError := cigExchange.DecodeStrict(r.Body, reqStruct)
+	if apiError != nil {
+		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
-	user, apiError := models.GetUser(reqStruct.UUID)
-	if err != nil {
+	user, apiError := models.GetUserCtx(r.Context(), reqStruct.UUID)
+	if apiError != nil {
 		info.APIError = apiError
 		if apiError.ShouldSilenceError() {
 			cigExchange.RespondWithAPIError(w, secureErrorResponse)
@@ -968,6 +1395,14 @@ func (userAPI *UserAPI) VerifyCodeHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// block verification after too many failed attempts
+	apiError = checkOTPAttempts(user.ID)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
 	// verify code
 	if reqStruct.Type == "phone" {
 		if user.LoginPhone == nil {
@@ -975,12 +1410,31 @@ func (userAPI *UserAPI) VerifyCodeHandler(w http.ResponseWriter, r *http.Request
 			cigExchange.RespondWithAPIError(w, info.APIError)
 			return
 		}
-		twilioClient := cigExchange.GetTwilio()
-		_, err := twilioClient.VerifyOTP(reqStruct.Code, user.LoginPhone.Value1, user.LoginPhone.Value2)
-		if err != nil {
-			info.APIError = cigExchange.NewTwilioError("Verify OTP", err)
-			cigExchange.RespondWithAPIError(w, info.APIError)
-			return
+		// in "DEV" environment with ALLOW_OTP_IN_RESPONSE the code is verified against redis instead of Twilio
+		if cigExchange.IsOTPInResponseAllowed() {
+			rediskey := cigExchange.GenerateRedisKey(reqStruct.UUID, cigExchange.KeySignUpPhone)
+
+			valid, apiError := consumeCode(rediskey, reqStruct.Code)
+			if apiError != nil {
+				info.APIError = apiError
+				cigExchange.RespondWithAPIError(w, info.APIError)
+				return
+			}
+			if !valid {
+				registerFailedOTPAttempt(user.ID)
+				info.APIError = secureErrorResponse
+				cigExchange.RespondWithAPIError(w, secureErrorResponse)
+				return
+			}
+		} else {
+			twilioClient := cigExchange.GetTwilio()
+			_, err := twilioClient.VerifyOTPCtx(r.Context(), reqStruct.Code, user.LoginPhone.Value1, user.LoginPhone.Value2)
+			if err != nil {
+				registerFailedOTPAttempt(user.ID)
+				info.APIError = cigExchange.NewTwilioError("Verify OTP", err)
+				cigExchange.RespondWithAPIError(w, info.APIError)
+				return
+			}
 		}
 
 	} else if reqStruct.Type == "email" {
@@ -991,13 +1445,27 @@ func (userAPI *UserAPI) VerifyCodeHandler(w http.ResponseWriter, r *http.Request
 		}
 		rediskey := cigExchange.GenerateRedisKey(reqStruct.UUID, cigExchange.KeySignUp)
 
-		redisCmd := cigExchange.GetRedis().Get(rediskey)
-		if redisCmd.Err() != nil {
-			info.APIError = cigExchange.NewRedisError("Get code failure", redisCmd.Err())
+		valid, apiError := consumeCode(rediskey, reqStruct.Code)
+		if apiError != nil {
+			info.APIError = apiError
 			cigExchange.RespondWithAPIError(w, info.APIError)
 			return
 		}
-		if redisCmd.Val() != reqStruct.Code {
+		if !valid {
+			registerFailedOTPAttempt(user.ID)
+			info.APIError = secureErrorResponse
+			cigExchange.RespondWithAPIError(w, secureErrorResponse)
+			return
+		}
+	} else if reqStruct.Type == "totp" {
+		valid, apiError := verifyTOTPCode(user, reqStruct.Code)
+		if apiError != nil {
+			info.APIError = apiError
+			cigExchange.RespondWithAPIError(w, info.APIError)
+			return
+		}
+		if !valid {
+			registerFailedOTPAttempt(user.ID)
 			info.APIError = secureErrorResponse
 			cigExchange.RespondWithAPIError(w, secureErrorResponse)
 			return
@@ -1008,6 +1476,51 @@ func (userAPI *UserAPI) VerifyCodeHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// code is valid, reset failed attempts counter
+	resetOTPAttempts(user.ID)
+
+	// mark the login contact verified, TOTP is enabled by verified users only
+	if reqStruct.Type != "totp" {
+		verifiedContact := user.LoginEmail
+		if reqStruct.Type == "phone" {
+			verifiedContact = user.LoginPhone
+		}
+		apiError = verifiedContact.MarkVerified()
+		if apiError != nil {
+			info.APIError = apiError
+			cigExchange.RespondWithAPIError(w, info.APIError)
+			return
+		}
+	}
+
+	// organisations can require web authn for all members
+	webAuthnRequired, apiError := models.RequiresWebAuthnCtx(r.Context(), user.ID)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+	if webAuthnRequired && len(user.LoginWebAuthn) == 0 {
+		// security key has to be registered with api/users/signup/{user_id}/webauthn, then the user signs in again
+		options, apiError := beginWebAuthnRegistration(user, true)
+		if apiError != nil {
+			info.APIError = apiError
+			cigExchange.RespondWithAPIError(w, info.APIError)
+			return
+		}
+
+		registrationResponse := struct {
+			*registrationOptions
+			Status string `json:"status"`
+		}{
+			options,
+			JWTResponseStatusWebAuthnRegistration,
+		}
+
+		cigExchange.Respond(w, registrationResponse)
+		return
+	}
+
 	// web authn autorization
 	if len(user.LoginWebAuthn) > 0 {
 		// generate session data and public key
@@ -1030,9 +1543,9 @@ func (userAPI *UserAPI) VerifyCodeHandler(w http.ResponseWriter, r *http.Request
 			return
 		}
 
-		redisCmd := cigExchange.GetRedis().Set(rediskey, string(session), expiration)
-		if redisCmd.Err() != nil {
-			info.APIError = cigExchange.NewRedisError("Set web authn failure", redisCmd.Err())
+		err = cigExchange.GetStore().Set(rediskey, string(session), expiration)
+		if err != nil {
+			info.APIError = cigExchange.NewRedisError("Set web authn failure", err)
 			cigExchange.RespondWithAPIError(w, info.APIError)
 			return
 		}
@@ -1050,7 +1563,7 @@ func (userAPI *UserAPI) VerifyCodeHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	organisationUser, apiError := selectHomeOrganisation(user)
+	organisationUser, apiError := selectHomeOrganisation(r.Context(), user)
 	if apiError != nil {
 		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
@@ -1058,13 +1571,14 @@ func (userAPI *UserAPI) VerifyCodeHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	// verification passed, generate jwt and return it
-	tokenString, token, apiError := GenerateJWTString(user.ID, organisationUser.OrganisationID)
+	tokenPair, apiError := GenerateTokenPair(user.ID, organisationUser.OrganisationID, reqStruct.Remember, info)
 
 	if apiError != nil {
 		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
+	token := tokenPair.access
 
 	loggedInUser := &cigExchange.LoggedInUser{}
 	loggedInUser.UserUUID = token.UserUUID
@@ -1074,20 +1588,122 @@ func (userAPI *UserAPI) VerifyCodeHandler(w http.ResponseWriter, r *http.Request
 
 	info.LoggedInUser = loggedInUser
 
-	resp := &JwtResponse{
-		JWT:    tokenString,
-		Status: JWTResponseStatusFinished,
-	}
+	resp := newJwtResponse(tokenPair.AccessToken, token.IssuedAt, token.ExpiresAt)
+	resp.RefreshToken = tokenPair.RefreshToken
 	cigExchange.Respond(w, resp)
 	CreateUserActivity(info, models.ActivityTypeSessionLength)
 }
 
-func selectHomeOrganisation(user *models.User) (*models.OrganisationUser, *cigExchange.APIError) {
+// checkOTPAttempts returns error if the user reached the failed OTP verifications limit
+func checkOTPAttempts(userID string) *cigExchange.APIError {
+
+	rediskey := cigExchange.GenerateRedisKey(userID, cigExchange.KeyOTPAttempts)
+
+	value, err := cigExchange.GetStore().Get(rediskey)
+	if err != nil {
+		// no failed attempts yet
+		if err == cigExchange.ErrKeyNotFound {
+			return nil
+		}
+		return cigExchange.NewRedisError("Get otp attempts failure", err)
+	}
 
-	// get OrganisationUsers related to user
+	attempts, err := strconv.Atoi(value)
+	if err != nil {
+		return cigExchange.NewRedisError("Get otp attempts failure. Can't parse redis value", err)
+	}
+
+	if attempts >= cigExchange.GetOTPMaxAttempts() {
+		return cigExchange.NewTooManyRequestsError("Too many failed attempts, try again later")
+	}
+	return nil
+}
+
+// consumeCode compares the code with the code stored under rediskey and removes the stored code.
+// The code is valid only for the call that removed it, so concurrent replays of one code fail.
+// Missing or expired code is invalid
+func consumeCode(rediskey, code string) (bool, *cigExchange.APIError) {
+
+	storedCode, err := cigExchange.GetStore().Get(rediskey)
+	if err != nil {
+		if err == cigExchange.ErrKeyNotFound {
+			return false, nil
+		}
+		return false, cigExchange.NewRedisError("Get code failure", err)
+	}
+	if !cigExchange.CompareCodes(storedCode, code) {
+		return false, nil
+	}
+
+	// the code can be used only once
+	removed, err := cigExchange.GetStore().Del(rediskey)
+	if err != nil {
+		return false, cigExchange.NewRedisError("Delete code failure", err)
+	}
+	return removed == 1, nil
+}
+
+// registerFailedOTPAttempt increments the user failed OTP verifications counter
+func registerFailedOTPAttempt(userID string) {
+
+	rediskey := cigExchange.GenerateRedisKey(userID, cigExchange.KeyOTPAttempts)
+
+	attempts, err := cigExchange.GetStore().IncrWithExpire(rediskey, otpAttemptsExpiration)
+	if err != nil {
+		cigExchange.LogAPIError("OTP attempts", cigExchange.NewRedisError("Increment otp attempts failure", err))
+		return
+	}
+
+	// lockout lasts the full period after the last failure
+	if attempts >= int64(cigExchange.GetOTPMaxAttempts()) {
+		err = cigExchange.GetStore().Expire(rediskey, otpAttemptsExpiration)
+		if err != nil {
+			cigExchange.LogAPIError("OTP attempts", cigExchange.NewRedisError("Expire otp attempts failure", err))
+		}
+	}
+}
+
+// resetOTPAttempts removes the user failed OTP verifications counter
+func resetOTPAttempts(userID string) {
+
+	rediskey := cigExchange.GenerateRedisKey(userID, cigExchange.KeyOTPAttempts)
+
+	_, err := cigExchange.GetStore().Del(rediskey)
+	if err != nil {
+		cigExchange.LogAPIError("OTP attempts", cigExchange.NewRedisError("Delete otp attempts failure", err))
+	}
+}
+
+// skipSuspendedOrganisation returns the selected membership unless its organisation is suspended.
+// Otherwise the first active membership of not suspended organisation or empty membership is returned
+func skipSuspendedOrganisation(ctx context.Context, selected *models.OrganisationUser, orgUsers []*models.OrganisationUser) (*models.OrganisationUser, *cigExchange.APIError) {
+
+	suspended, apiError := models.IsOrganisationSuspendedCtx(ctx, selected.OrganisationID)
+	if apiError != nil || !suspended {
+		return selected, apiError
+	}
+
+	for _, orgUser := range orgUsers {
+		if orgUser.Status != models.OrganisationUserStatusActive {
+			continue
+		}
+		suspended, apiError = models.IsOrganisationSuspendedCtx(ctx, orgUser.OrganisationID)
+		if apiError != nil {
+			return selected, apiError
+		}
+		if !suspended {
+			return orgUser, nil
+		}
+	}
+	return &models.OrganisationUser{}, nil
+}
+
+func selectHomeOrganisation(ctx context.Context, user *models.User) (*models.OrganisationUser, *cigExchange.APIError) {
+
+	// get OrganisationUsers related to user, oldest first so the default home organisation is stable
 	organisationUser := &models.OrganisationUser{}
 	orgUsers := make([]*models.OrganisationUser, 0)
-	db := cigExchange.GetDB().Model(user).Related(&orgUsers, "UserID")
+	db := cigExchange.GetDBWithContext(ctx).Where(&models.OrganisationUser{UserID: user.ID}).Order("created_at").Order("id").Find(&orgUsers)
 	if db.Error != nil {
 		// organization can be missed
 		if !db.RecordNotFound() {
@@ -1109,44 +1725,67 @@ func selectHomeOrganisation(user *models.User) (*models.OrganisationUser, *cigEx
 		if len(organisationUser.ID) == 0 {
 			organisationUser = orgUsers[0]
 			organisationUser.IsHome = true
-			organisationUser.Update()
+			apiError := organisationUser.Update()
+			if apiError != nil {
+				return organisationUser, apiError
+			}
 		}
 
 		// activate organisationUsers
 		for _, orgUser := range orgUsers {
-			role := models.OrganisationRoleUser
-			// search for organisation admin
-			orgUserWhere := &models.OrganisationUser{
-				OrganisationID:   orgUser.OrganisationID,
-				OrganisationRole: models.OrganisationRoleAdmin,
-				Status:           models.OrganisationUserStatusActive,
+			// do not activate invitations automatically... (OrganisationUserStatusInvited)
+			// user still needs to follow the email link and accept invitation explicitely
+			if orgUser.Status != models.OrganisationUserStatusUnverified {
+				continue
 			}
-			orgUserAdmin := &models.OrganisationUser{}
-			db := cigExchange.GetDB().Where(orgUserWhere).First(orgUserAdmin)
-			if db.Error != nil {
-				if !db.RecordNotFound() {
-					return organisationUser, cigExchange.NewDatabaseError("Organization user links lookup failed", db.Error)
+
+			// only the designated organisation creator becomes admin, reference key signups are regular users
+			role := models.OrganisationRoleUser
+			if orgUser.OrganisationRole == models.OrganisationRoleAdmin {
+				// search for organisation admin
+				orgUserWhere := &models.OrganisationUser{
+					OrganisationID:   orgUser.OrganisationID,
+					OrganisationRole: models.OrganisationRoleAdmin,
+					Status:           models.OrganisationUserStatusActive,
+				}
+				orgUserAdmin := &models.OrganisationUser{}
+				db := cigExchange.GetDBWithContext(ctx).Where(orgUserWhere).First(orgUserAdmin)
+				if db.Error != nil {
+					if !db.RecordNotFound() {
+						return organisationUser, cigExchange.NewDatabaseError("Organization user links lookup failed", db.Error)
+					}
+					role = models.OrganisationRoleAdmin
 				}
-				role = models.OrganisationRoleAdmin
 			}
 
-			// do not activate invitations automatically... (OrganisationUserStatusInvited)
-			// user still needs to follow the email link and accept invitation explicitely
-			if orgUser.Status == models.OrganisationUserStatusUnverified {
-				orgUser.Status = models.OrganisationUserStatusActive
-				orgUser.OrganisationRole = role
-				orgUser.Update()
+			orgUser.Status = models.OrganisationUserStatusActive
+			orgUser.OrganisationRole = role
+			apiError := orgUser.Update()
+			if apiError != nil {
+				return organisationUser, apiError
 			}
 		}
+
+		// suspended organisation can't be signed in to, use another active membership or none.
+		// Home organisation stays unchanged
+		var apiError *cigExchange.APIError
+		organisationUser, apiError = skipSuspendedOrganisation(ctx, organisationUser, orgUsers)
+		if apiError != nil {
+			return organisationUser, apiError
+		}
 	}
 
 	// user is verified
 	if user.Status != models.UserStatusVerified {
-		user.Status = models.UserStatusVerified
-		apiError := user.Save()
+		apiError := user.MarkVerified()
 		if apiError != nil {
 			return organisationUser, apiError
 		}
+
+		// welcome email is deferred until the first successful verification
+		if cigExchange.IsWelcomeEmailOnVerify() && user.LoginEmail != nil && len(user.LoginEmail.Value1) > 0 {
+			cigExchange.SendWelcomeEmailAsync(user.LoginEmail.Value1)
+		}
 	}
 
 	return organisationUser, nil
@@ -1170,22 +1809,16 @@ func (userAPI *UserAPI) GetInfo(w http.ResponseWriter, r *http.Request) {
 	info.LoggedInUser = loggedInUser
 
 	// get user
-	user, apiError := models.GetUser(loggedInUser.UserUUID)
+	user, apiError := models.GetUserCtx(r.Context(), loggedInUser.UserUUID)
 	if apiError != nil {
 		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
-	orgUser := &models.OrganisationUser{}
+	// check the logged in organisation membership, admins can be logged in to any organisation
 	if len(loggedInUser.OrganisationUUID) > 0 {
-		// find organisation user
-		searchOrgUser := &models.OrganisationUser{
-			OrganisationID: loggedInUser.OrganisationUUID,
-			UserID:         loggedInUser.UserUUID,
-		}
-
-		orgUser, apiError = searchOrgUser.Find()
+		apiError = RequireOrgMembershipCtx(r.Context(), loggedInUser.UserUUID, loggedInUser.OrganisationUUID)
 		if apiError != nil {
 			info.APIError = apiError
 			cigExchange.RespondWithAPIError(w, info.APIError)
@@ -1193,16 +1826,57 @@ func (userAPI *UserAPI) GetInfo(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// get all user organisations for the organisation switcher
+	organisations, apiError := models.GetOrganisationsCtx(r.Context(), loggedInUser.UserUUID)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	orgUsers := make([]*models.OrganisationUser, 0)
+	db := cigExchange.GetDB().Where(&models.OrganisationUser{UserID: loggedInUser.UserUUID}).Find(&orgUsers)
+	if db.Error != nil && !db.RecordNotFound() {
+		info.APIError = cigExchange.NewDatabaseError("OrganisationUser lookup failed", db.Error)
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+	orgUsersMap := make(map[string]*models.OrganisationUser)
+	for _, ou := range orgUsers {
+		orgUsersMap[ou.OrganisationID] = ou
+	}
+
+	infoOrganisations := make([]*infoOrganisation, 0)
+	for _, organisation := range organisations {
+		ou, ok := orgUsersMap[organisation.ID]
+		if !ok {
+			continue
+		}
+		infoOrganisations = append(infoOrganisations, &infoOrganisation{
+			OrganisationUUID: organisation.ID,
+			Name:             organisation.Name,
+			Role:             ou.OrganisationRole,
+			IsHome:           ou.IsHome,
+		})
+	}
+
 	email := ""
 	if user.LoginEmail != nil {
 		email = user.LoginEmail.Value1
 	}
+	// admins logged in to other organisations have no organisation role
+	orgRole := ""
+	if orgUser, ok := orgUsersMap[loggedInUser.OrganisationUUID]; ok {
+		orgRole = orgUser.OrganisationRole
+	}
 	resp := &infoResponse{
 		UserUUID:         loggedInUser.UserUUID,
 		Role:             user.Role,
+		Platform:         user.Platform,
 		OrganisationUUID: loggedInUser.OrganisationUUID,
-		OrganisationRole: orgUser.OrganisationRole,
+		OrganisationRole: orgRole,
 		UserEmail:        email,
+		Organisations:    infoOrganisations,
 	}
 	cigExchange.Respond(w, resp)
 }
@@ -1236,67 +1910,95 @@ func (userAPI *UserAPI) ChangeOrganisationHandler(w http.ResponseWriter, r *http
 			cigExchange.RespondWithAPIError(w, info.APIError)
 			return
 		}
-		resp := &JwtResponse{
-			JWT:    splitted[1],
-			Status: JWTResponseStatusFinished,
-		}
+		resp := newJwtResponse(splitted[1], loggedInUser.CreationDate.Unix(), loggedInUser.ExpirationDate.Unix())
 		cigExchange.Respond(w, resp)
 		return
 	}
 
-	// check admin
-	userRole, apiError := models.GetUserRole(loggedInUser.UserUUID)
+	// check that user belongs to organisation, admins can switch to any organisation
+	apiError := RequireOrgMembershipCtx(r.Context(), loggedInUser.UserUUID, organisationID)
 	if apiError != nil {
 		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
-	// skip check for admin
-	if userRole != models.UserRoleAdmin {
-		// find organisation user
-		searchOrgUser := &models.OrganisationUser{
-			OrganisationID: organisationID,
-			UserID:         loggedInUser.UserUUID,
+	// verification passed, switch the session organisation and generate new jwt for it.
+	// Previous session token is replaced
+	var session *cigExchange.Session
+	if len(loggedInUser.SessionID) > 0 {
+		session, apiError = cigExchange.GetSession(loggedInUser.UserUUID, loggedInUser.SessionID)
+		if apiError != nil {
+			info.APIError = apiError
+			cigExchange.RespondWithAPIError(w, info.APIError)
+			return
 		}
-
-		orgUser, apiError := searchOrgUser.Find()
+		session.OrganisationUUID = organisationID
+	} else {
+		session, apiError = newSession(loggedInUser.UserUUID, organisationID, info)
 		if apiError != nil {
 			info.APIError = apiError
 			cigExchange.RespondWithAPIError(w, info.APIError)
 			return
 		}
+	}
+
+	tokenString, token, apiError := generateAccessToken(session)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
 
-		// check that user belong to organisation
-		if orgUser.UserID != loggedInUser.UserUUID {
-			info.APIError = cigExchange.NewInvalidFieldError("organisation_id", "User don't belong to organisation")
+	// remove previous token issued before sessions from redis
+	if len(loggedInUser.SessionID) == 0 {
+		redisKey := loggedInUser.UserUUID + "|" + loggedInUser.OrganisationUUID
+		_, err := cigExchange.GetStore().Del(redisKey)
+		if err != nil {
+			info.APIError = cigExchange.NewRedisError("Del token failure", err)
 			cigExchange.RespondWithAPIError(w, info.APIError)
 			return
 		}
 	}
 
-	// verification passed, generate jwt and return it
-	tokenString, _, apiError := GenerateJWTString(loggedInUser.UserUUID, organisationID)
+	resp := newJwtResponse(tokenString, token.IssuedAt, token.ExpiresAt)
+	cigExchange.Respond(w, resp)
+}
+
+// SetHomeOrganisationHandler handles POST api/users/home/{organisation_id} endpoint
+func (userAPI *UserAPI) SetHomeOrganisationHandler(w http.ResponseWriter, r *http.Request) {
+
+	// create user activity record and print error with defer
+	info := cigExchange.PrepareActivityInformation(r)
+	defer CreateUserActivity(info, models.ActivityTypeSetHomeOrganisation)
+	defer cigExchange.PrintAPIError(info)
+
+	organisationID := mux.Vars(r)["organisation_id"]
+
+	// load context user info
+	loggedInUser, err := GetContextValues(r)
+	if err != nil {
+		info.APIError = cigExchange.NewRoutingError(err)
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+	info.LoggedInUser = loggedInUser
+
+	apiError := RequireOrgMembershipCtx(r.Context(), loggedInUser.UserUUID, organisationID)
 	if apiError != nil {
 		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
-	// remove previous token from redis
-	redisKey := loggedInUser.UserUUID + "|" + loggedInUser.OrganisationUUID
-	intRedisCmd := cigExchange.GetRedis().Del(redisKey)
-	if intRedisCmd.Err() != nil {
-		info.APIError = cigExchange.NewRedisError("Del token failure", intRedisCmd.Err())
+	apiError = models.SetHomeOrganisation(loggedInUser.UserUUID, organisationID)
+	if apiError != nil {
+		info.APIError = apiError
 		cigExchange.RespondWithAPIError(w, info.APIError)
 		return
 	}
 
-	resp := &JwtResponse{
-		JWT:    tokenString,
-		Status: JWTResponseStatusFinished,
-	}
-	cigExchange.Respond(w, resp)
+	w.WriteHeader(204)
 }
 
 // PingJWT handles GET api/ping-jwt endpoint
@@ -1330,7 +2032,7 @@ func CreateUserActivity(info *cigExchange.ActivityInformation, activityType stri
 
 	activity, apiErr := convertToUserActivity(info, activityType)
 	if apiErr != nil {
-		fmt.Println(apiErr.ToString())
+		cigExchange.LogAPIError("UserActivity: record failed", apiErr)
 		return apiErr
 	}
 
@@ -1338,7 +2040,7 @@ func CreateUserActivity(info *cigExchange.ActivityInformation, activityType stri
 	err := cigExchange.GetDB().Create(activity).Error
 	if err != nil {
 		apiErr = cigExchange.NewDatabaseError("Create user activity call failed", err)
-		fmt.Println(apiErr.ToString())
+		cigExchange.LogAPIError("UserActivity: record failed", apiErr)
 		return apiErr
 	}
 	return nil
@@ -1349,13 +2051,13 @@ func UpdateUserActivity(info *cigExchange.ActivityInformation, activityType stri
 
 	activity, apiErr := convertToUserActivity(info, activityType)
 	if apiErr != nil {
-		fmt.Println(apiErr.ToString())
+		cigExchange.LogAPIError("UserActivity: record failed", apiErr)
 		return apiErr
 	}
 
 	activitySave, apiErr := activity.FindSessionActivity()
 	if apiErr != nil {
-		fmt.Println(apiErr.ToString())
+		cigExchange.LogAPIError("UserActivity: record failed", apiErr)
 		return apiErr
 	}
 
@@ -1363,7 +2065,7 @@ func UpdateUserActivity(info *cigExchange.ActivityInformation, activityType stri
 	err := cigExchange.GetDB().Save(activitySave).Error
 	if err != nil {
 		apiErr = cigExchange.NewDatabaseError("Update user activity call failed", err)
-		fmt.Println(apiErr.ToString())
+		cigExchange.LogAPIError("UserActivity: record failed", apiErr)
 		return apiErr
 	}
 	return nil
@@ -1442,7 +2144,7 @@ func CreateCustomUserActivity(info *cigExchange.ActivityInformation, infoMap map
 		jsonBytes, err := json.Marshal(info.LoggedInUser)
 		if err != nil {
 			apiErr := cigExchange.NewJSONEncodingError(cigExchange.MessageJSONEncoding, err)
-			fmt.Println(apiErr.ToString())
+			cigExchange.LogAPIError("UserActivity: record failed", apiErr)
 			return apiErr
 		}
 
@@ -1453,7 +2155,7 @@ func CreateCustomUserActivity(info *cigExchange.ActivityInformation, infoMap map
 	jsonBytes, err := json.Marshal(infoMap)
 	if err != nil {
 		apiErr := cigExchange.NewJSONEncodingError(cigExchange.MessageJSONEncoding, err)
-		fmt.Println(apiErr.ToString())
+		cigExchange.LogAPIError("UserActivity: record failed", apiErr)
 		return apiErr
 	}
 	jsonStr := string(jsonBytes)
@@ -1463,7 +2165,7 @@ func CreateCustomUserActivity(info *cigExchange.ActivityInformation, infoMap map
 	err = cigExchange.GetDB().Create(activity).Error
 	if err != nil {
 		apiErr := cigExchange.NewDatabaseError("Create user activity  call failed", err)
-		fmt.Println(apiErr.ToString())
+		cigExchange.LogAPIError("UserActivity: record failed", apiErr)
 		return apiErr
 	}
 	return nil
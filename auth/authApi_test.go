@@ -0,0 +1,237 @@
+package auth
+
+import (
+	cigExchange "cig-exchange-libs"
+	"cig-exchange-libs/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// requireDB skips the test unless the database from the environment is reachable and migrates it
+func requireDB(t *testing.T) {
+
+	t.Helper()
+	if cigExchange.GetDB() == nil || cigExchange.GetDB().DB() == nil || cigExchange.GetDB().DB().Ping() != nil {
+		t.Skip("database is not available")
+	}
+	if apiError := models.Migrate(); apiError != nil {
+		t.Fatalf("migration failed: %v", apiError.ToString())
+	}
+}
+
+// newJSONRequest creates the POST request with the json body
+func newJSONRequest(path, body string) *http.Request {
+
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+func TestHasOtherOrganisationMembers(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		orgUsers []*models.OrganisationUser
+		userID   string
+		expected bool
+	}{
+		{"no members", nil, "user", false},
+		{"only caller", []*models.OrganisationUser{{UserID: "user"}}, "user", false},
+		{"reference key member", []*models.OrganisationUser{{UserID: "user"}, {UserID: "other", OrganisationRole: models.OrganisationRoleUser}}, "user", true},
+		{"new user", []*models.OrganisationUser{{UserID: "other"}}, "", true},
+	}
+
+	for _, test := range tests {
+		if got := hasOtherOrganisationMembers(test.orgUsers, test.userID); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestConsumeCodeReplay(t *testing.T) {
+
+	cigExchange.SetStore(cigExchange.NewMemoryStore())
+	defer cigExchange.SetStore(nil)
+
+	rediskey := cigExchange.GenerateRedisKey("user", cigExchange.KeySignUp)
+	cigExchange.GetStore().Set(rediskey, "123456", time.Minute)
+
+	valid, apiError := consumeCode(rediskey, "654321")
+	if apiError != nil || valid {
+		t.Fatalf("wrong code accepted: %v %v", valid, apiError)
+	}
+
+	valid, apiError = consumeCode(rediskey, "123456")
+	if apiError != nil || !valid {
+		t.Fatalf("valid code rejected: %v %v", valid, apiError)
+	}
+
+	// replayed code is already consumed
+	valid, apiError = consumeCode(rediskey, "123456")
+	if apiError != nil || valid {
+		t.Fatalf("replayed code accepted: %v %v", valid, apiError)
+	}
+}
+
+func TestVerifyCodeHandlerUnknownUser(t *testing.T) {
+
+	requireDB(t)
+	cigExchange.SetStore(cigExchange.NewMemoryStore())
+	defer cigExchange.SetStore(nil)
+
+	body := `{"uuid":"` + cigExchange.RandomUUID() + `","type":"email","code":"123456"}`
+	w := httptest.NewRecorder()
+	(&UserAPI{}).VerifyCodeHandler(w, newJSONRequest("/api/users/verify_otp", body))
+
+	// missing user gets the same response as the invalid code
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected %d, got %d %s", http.StatusUnauthorized, w.Code, w.Body.String())
+	}
+}
+
+func TestSelectHomeOrganisationOldestFirst(t *testing.T) {
+
+	requireDB(t)
+	user := &models.User{Name: "Home", LastName: "Test", Role: models.UserRoleUser, Status: models.UserStatusVerified}
+	records := []interface{}{user}
+
+	// the newer link is inserted first so the insertion order doesn't decide
+	now := time.Now()
+	orgUsers := make([]*models.OrganisationUser, 0)
+	for _, createdAt := range []time.Time{now, now.Add(-time.Hour)} {
+		organisation := &models.Organisation{Name: "Home test", ReferenceKey: cigExchange.RandomUUID()}
+		orgUser := &models.OrganisationUser{
+			OrganisationRole: models.OrganisationRoleUser,
+			Status:           models.OrganisationUserStatusActive,
+			CreatedAt:        createdAt,
+		}
+		orgUsers = append(orgUsers, orgUser)
+		records = append(records, organisation, orgUser)
+	}
+
+	db := cigExchange.GetDB()
+	defer func() {
+		for _, record := range records {
+			db.Unscoped().Delete(record)
+		}
+	}()
+	for i, record := range records {
+		if orgUser, ok := record.(*models.OrganisationUser); ok {
+			orgUser.UserID = user.ID
+			orgUser.OrganisationID = records[i-1].(*models.Organisation).ID
+		}
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("create %T failed: %v", record, err)
+		}
+	}
+
+	home, apiError := selectHomeOrganisation(context.Background(), user)
+	if apiError != nil {
+		t.Fatalf("select failed: %v", apiError.ToString())
+	}
+	if home.ID != orgUsers[1].ID || !home.IsHome {
+		t.Fatalf("expected oldest organisation %v as home, got %v", orgUsers[1].ID, home.ID)
+	}
+
+	// the stored home organisation is kept on the next login
+	home, apiError = selectHomeOrganisation(context.Background(), user)
+	if apiError != nil || home.ID != orgUsers[1].ID {
+		t.Errorf("home organisation changed to %v %v", home.ID, apiError)
+	}
+}
+
+// createTestRecord creates the record and removes it after the test
+func createTestRecord(t *testing.T, record interface{}) {
+
+	t.Helper()
+	if err := cigExchange.GetDB().Create(record).Error; err != nil {
+		t.Fatalf("create %T failed: %v", record, err)
+	}
+	t.Cleanup(func() {
+		cigExchange.GetDB().Unscoped().Delete(record)
+	})
+}
+
+func TestSelectHomeOrganisationGrantsAdminToCreator(t *testing.T) {
+
+	requireDB(t)
+
+	// createMember creates the organisation membership of a new user
+	createMember := func(organisationID, role, status string) (*models.User, *models.OrganisationUser) {
+		user := &models.User{Name: "Admin", LastName: "Test", Role: models.UserRoleUser, Status: models.UserStatusVerified}
+		createTestRecord(t, user)
+		orgUser := &models.OrganisationUser{OrganisationID: organisationID, UserID: user.ID, OrganisationRole: role, Status: status}
+		createTestRecord(t, orgUser)
+		return user, orgUser
+	}
+
+	newOrganisation := &models.Organisation{Name: "Admin test", ReferenceKey: cigExchange.RandomUUID()}
+	createTestRecord(t, newOrganisation)
+	existingOrganisation := &models.Organisation{Name: "Admin test", ReferenceKey: cigExchange.RandomUUID()}
+	createTestRecord(t, existingOrganisation)
+	createMember(existingOrganisation.ID, models.OrganisationRoleAdmin, models.OrganisationUserStatusActive)
+
+	tests := []struct {
+		name           string
+		organisationID string
+		role           string
+		status         string
+		expectedRole   string
+		expectedStatus string
+	}{
+		// self signup creator of the new organisation
+		{"creator", newOrganisation.ID, models.OrganisationRoleAdmin, models.OrganisationUserStatusUnverified, models.OrganisationRoleAdmin, models.OrganisationUserStatusActive},
+		// organisation has an active admin already
+		{"joining user", existingOrganisation.ID, models.OrganisationRoleAdmin, models.OrganisationUserStatusUnverified, models.OrganisationRoleUser, models.OrganisationUserStatusActive},
+		{"reference key user", existingOrganisation.ID, models.OrganisationRoleUser, models.OrganisationUserStatusUnverified, models.OrganisationRoleUser, models.OrganisationUserStatusActive},
+		// invitations are accepted explicitly
+		{"invited user", existingOrganisation.ID, models.OrganisationRoleUser, models.OrganisationUserStatusInvited, models.OrganisationRoleUser, models.OrganisationUserStatusInvited},
+	}
+
+	for _, test := range tests {
+		user, orgUser := createMember(test.organisationID, test.role, test.status)
+		if _, apiError := selectHomeOrganisation(context.Background(), user); apiError != nil {
+			t.Fatalf("%s: select failed: %v", test.name, apiError.ToString())
+		}
+
+		stored := &models.OrganisationUser{}
+		if err := cigExchange.GetDB().Where("id = ?", orgUser.ID).First(stored).Error; err != nil {
+			t.Fatalf("%s: fetch failed: %v", test.name, err)
+		}
+		if stored.OrganisationRole != test.expectedRole || stored.Status != test.expectedStatus {
+			t.Errorf("%s: expected %s %s, got %s %s", test.name, test.expectedRole, test.expectedStatus, stored.OrganisationRole, stored.Status)
+		}
+	}
+}
+
+func TestOTPAttemptsLockout(t *testing.T) {
+
+	cigExchange.SetStore(cigExchange.NewMemoryStore())
+	defer cigExchange.SetStore(nil)
+
+	for i := 0; i < cigExchange.GetOTPMaxAttempts(); i++ {
+		if apiError := checkOTPAttempts("user"); apiError != nil {
+			t.Fatalf("attempt %d rejected: %v", i+1, apiError.ToString())
+		}
+		registerFailedOTPAttempt("user")
+	}
+
+	apiError := checkOTPAttempts("user")
+	if apiError == nil || apiError.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected lockout, got %v", apiError)
+	}
+
+	// attempts are counted per user
+	if apiError := checkOTPAttempts("other"); apiError != nil {
+		t.Errorf("other user locked out: %v", apiError.ToString())
+	}
+
+	resetOTPAttempts("user")
+	if apiError := checkOTPAttempts("user"); apiError != nil {
+		t.Errorf("reset user locked out: %v", apiError.ToString())
+	}
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	cigExchange "cig-exchange-libs"
+	"cig-exchange-libs/models"
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// CheckUserRole returns access forbidden error unless the logged in user has the role
+func CheckUserRole(r *http.Request, role string) *cigExchange.APIError {
+
+	// load context user info
+	loggedInUser, err := GetContextValues(r)
+	if err != nil {
+		return cigExchange.NewRoutingError(err)
+	}
+
+	userRole, apiError := models.GetUserRoleCtx(r.Context(), loggedInUser.UserUUID)
+	if apiError != nil {
+		return apiError
+	}
+	if userRole != role {
+		return cigExchange.NewAccessForbiddenError("User role '" + role + "' is required")
+	}
+	return nil
+}
+
+// CheckOrgRole returns access forbidden error unless the logged in user is an active member with the role in the logged in organisation
+// and the organisation isn't suspended. Platform admins pass any organisation role check
+func CheckOrgRole(r *http.Request, role string) *cigExchange.APIError {
+
+	// load context user info
+	loggedInUser, err := GetContextValues(r)
+	if err != nil {
+		return cigExchange.NewRoutingError(err)
+	}
+
+	userRole, apiError := models.GetUserRoleCtx(r.Context(), loggedInUser.UserUUID)
+	if apiError != nil {
+		return apiError
+	}
+	if userRole == models.UserRoleAdmin {
+		return nil
+	}
+
+	if len(loggedInUser.OrganisationUUID) == 0 {
+		return cigExchange.NewAccessForbiddenError("User is not logged in to an organisation")
+	}
+
+	apiError = checkOrganisationNotSuspended(r.Context(), loggedInUser.OrganisationUUID)
+	if apiError != nil {
+		return apiError
+	}
+
+	searchOrgUser := &models.OrganisationUser{
+		OrganisationID: loggedInUser.OrganisationUUID,
+		UserID:         loggedInUser.UserUUID,
+	}
+	orgUser, apiError := searchOrgUser.FindCtx(r.Context())
+	if apiError != nil {
+		if len(apiError.Errors) > 0 && apiError.Errors[0].Reason == cigExchange.ReasonOrganisationUserDoesntExist {
+			return cigExchange.NewAccessForbiddenError("User doesn't belong to the organisation")
+		}
+		return apiError
+	}
+	// the role of invited or unverified members is kept but not granted
+	if orgUser.Status != models.OrganisationUserStatusActive {
+		return cigExchange.NewAccessForbiddenError("User is not an active member of the organisation")
+	}
+	if orgUser.OrganisationRole != role {
+		return cigExchange.NewAccessForbiddenError("Organisation role '" + role + "' is required")
+	}
+	return nil
+}
+
+// RequireUserRole returns middleware responding with 403 unless the logged in user has the role.
+// Must be used after JwtAuthenticationHandler
+func RequireUserRole(role string) func(http.Handler) http.Handler {
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			if apiError := CheckUserRole(r, role); apiError != nil {
+				cigExchange.LogAPIError("RequireUserRole: request rejected", apiError)
+				cigExchange.RespondWithAPIError(w, apiError)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireOrgRole returns middleware responding with 403 unless the logged in user has the role in the logged in organisation.
+// Must be used after JwtAuthenticationHandler
+func RequireOrgRole(role string) func(http.Handler) http.Handler {
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			if apiError := CheckOrgRole(r, role); apiError != nil {
+				cigExchange.LogAPIError("RequireOrgRole: request rejected", apiError)
+				cigExchange.RespondWithAPIError(w, apiError)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireOrgMembership returns access forbidden error unless the user is an active member of the organisation
+// and the organisation isn't suspended. Platform admins are members of all organisations
+func RequireOrgMembership(userUUID, orgUUID string) *cigExchange.APIError {
+	return RequireOrgMembershipCtx(context.Background(), userUUID, orgUUID)
+}
+
+// RequireOrgMembershipCtx checks the organisation membership with the context, see RequireOrgMembership
+func RequireOrgMembershipCtx(ctx context.Context, userUUID, orgUUID string) *cigExchange.APIError {
+
+	if len(orgUUID) == 0 {
+		return cigExchange.NewInvalidFieldError("organisation_id", "OrganisationID is invalid")
+	}
+
+	userRole, apiError := models.GetUserRoleCtx(ctx, userUUID)
+	if apiError != nil {
+		return apiError
+	}
+	if userRole == models.UserRoleAdmin {
+		return nil
+	}
+
+	searchOrgUser := &models.OrganisationUser{
+		OrganisationID: orgUUID,
+		UserID:         userUUID,
+	}
+	orgUser, apiError := searchOrgUser.FindCtx(ctx)
+	if apiError != nil {
+		if len(apiError.Errors) > 0 && apiError.Errors[0].Reason == cigExchange.ReasonOrganisationUserDoesntExist {
+			return cigExchange.NewAccessForbiddenError("User doesn't belong to the organisation")
+		}
+		return apiError
+	}
+	if orgUser.Status != models.OrganisationUserStatusActive {
+		return cigExchange.NewAccessForbiddenError("User is not an active member of the organisation")
+	}
+	return checkOrganisationNotSuspended(ctx, orgUUID)
+}
+
+// checkOrganisationNotSuspended returns access forbidden error if the organisation is suspended
+func checkOrganisationNotSuspended(ctx context.Context, orgUUID string) *cigExchange.APIError {
+
+	suspended, apiError := models.IsOrganisationSuspendedCtx(ctx, orgUUID)
+	if apiError != nil {
+		return apiError
+	}
+	if suspended {
+		return cigExchange.NewAccessForbiddenError("Organisation is suspended")
+	}
+	return nil
+}
+
+// RequireOrgMembershipHandler returns middleware responding with 403 unless the logged in user
+// is an active member of the organisation from the routeVar route variable.
+// Must be used after JwtAuthenticationHandler
+func RequireOrgMembershipHandler(routeVar string) func(http.Handler) http.Handler {
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			loggedInUser, err := GetContextValues(r)
+			if err != nil {
+				apiError := cigExchange.NewRoutingError(err)
+				cigExchange.LogAPIError("RequireOrgMembership: request rejected", apiError)
+				cigExchange.RespondWithAPIError(w, apiError)
+				return
+			}
+
+			apiError := RequireOrgMembershipCtx(r.Context(), loggedInUser.UserUUID, mux.Vars(r)[routeVar])
+			if apiError != nil {
+				cigExchange.LogAPIError("RequireOrgMembership: request rejected", apiError)
+				cigExchange.RespondWithAPIError(w, apiError)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
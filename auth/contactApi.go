@@ -0,0 +1,176 @@
+package auth
+
+import (
+	cigExchange "cig-exchange-libs"
+	"cig-exchange-libs/models"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// GetContactsHandler handles GET api/me/contacts endpoint
+func (userAPI *UserAPI) GetContactsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// create user activity record and print error with defer
+	info := cigExchange.PrepareActivityInformation(r)
+	defer CreateUserActivity(info, models.ActivityTypeGetUserContacts)
+	defer cigExchange.PrintAPIError(info)
+
+	// load context user info
+	loggedInUser, err := GetContextValues(r)
+	if err != nil {
+		info.APIError = cigExchange.NewRoutingError(err)
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+	info.LoggedInUser = loggedInUser
+
+	contacts, apiError := models.GetContactsCtx(r.Context(), loggedInUser.UserUUID)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	cigExchange.Respond(w, contacts)
+}
+
+// CreateContactHandler handles POST api/me/contacts endpoint
+func (userAPI *UserAPI) CreateContactHandler(w http.ResponseWriter, r *http.Request) {
+
+	// create user activity record and print error with defer
+	info := cigExchange.PrepareActivityInformation(r)
+	defer CreateUserActivity(info, models.ActivityTypeCreateUserContact)
+	defer cigExchange.PrintAPIError(info)
+
+	// load context user info
+	loggedInUser, err := GetContextValues(r)
+	if err != nil {
+		info.APIError = cigExchange.NewRoutingError(err)
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+	info.LoggedInUser = loggedInUser
+
+	if apiError := cigExchange.CheckJSONContentType(r); apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	// read request body
+	contact := &models.Contact{}
+	original, _, apiError := cigExchange.ReadAndParseRequest(r.Body, contact)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	index, apiError := cigExchange.ParseIndex(original)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	// additional contacts are secondary and unverified
+	contact.Level = models.ContactLevelSecondary
+	contact.VerifiedAt = nil
+
+	apiError = contact.Create(loggedInUser.UserUUID, index)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	cigExchange.Respond(w, &models.ContactWithIndex{Contact: contact, Index: index})
+}
+
+// UpdateContactHandler handles PATCH api/me/contacts/{contact_id} endpoint
+func (userAPI *UserAPI) UpdateContactHandler(w http.ResponseWriter, r *http.Request) {
+
+	// create user activity record and print error with defer
+	info := cigExchange.PrepareActivityInformation(r)
+	defer CreateUserActivity(info, models.ActivityTypeUpdateUserContact)
+	defer cigExchange.PrintAPIError(info)
+
+	contactID := mux.Vars(r)["contact_id"]
+
+	// load context user info
+	loggedInUser, err := GetContextValues(r)
+	if err != nil {
+		info.APIError = cigExchange.NewRoutingError(err)
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+	info.LoggedInUser = loggedInUser
+
+	if apiError := cigExchange.CheckJSONContentType(r); apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	// read request body
+	contact := &models.Contact{}
+	original, filtered, apiError := cigExchange.ReadAndParseRequest(r.Body, contact)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	index, apiError := cigExchange.ParseIndex(original)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	// contact id can't be changed by the client, Contact.Update refuses type and level changes
+	// and clears the verification status when the value changes
+	filtered["id"] = contactID
+	contact.ID = contactID
+
+	apiError = contact.Update(loggedInUser.UserUUID, filtered, index)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	cigExchange.Respond(w, &models.ContactWithIndex{Contact: contact, Index: index})
+}
+
+// DeleteContactHandler handles DELETE api/me/contacts/{contact_id} endpoint
+func (userAPI *UserAPI) DeleteContactHandler(w http.ResponseWriter, r *http.Request) {
+
+	// create user activity record and print error with defer
+	info := cigExchange.PrepareActivityInformation(r)
+	defer CreateUserActivity(info, models.ActivityTypeDeleteUserContact)
+	defer cigExchange.PrintAPIError(info)
+
+	contactID := mux.Vars(r)["contact_id"]
+
+	// load context user info
+	loggedInUser, err := GetContextValues(r)
+	if err != nil {
+		info.APIError = cigExchange.NewRoutingError(err)
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+	info.LoggedInUser = loggedInUser
+
+	// login contacts are refused by Contact.Delete
+	contact := &models.Contact{ID: contactID}
+	apiError := contact.Delete(loggedInUser.UserUUID)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	w.WriteHeader(204)
+}
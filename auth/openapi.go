@@ -0,0 +1,248 @@
+package auth
+
+import (
+	cigExchange "cig-exchange-libs"
+	"cig-exchange-libs/models"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// openAPIRoute describes the handler route in the OpenAPI spec.
+// Request and Response are sample values of the body types, nil Request means no body, nil Response means 204
+type openAPIRoute struct {
+	Method   string
+	Path     string
+	Summary  string
+	Request  interface{}
+	Response interface{}
+	Public   bool
+}
+
+// openAPIRoutes lists the UserAPI handlers, update it together with the handlers.
+// WebAuthn bodies are the webauthn protocol objects and are not described
+var openAPIRoutes = []openAPIRoute{
+	{http.MethodPost, "/api/users/signup", "Sign up the user", &UserRequest{}, &userResponse{}, true},
+	{http.MethodPost, "/api/users/signup/{user_id}/webauthn", "Finish the WebAuthn registration", json.RawMessage{}, nil, true},
+	{http.MethodPost, "/api/organisations/signup", "Sign up the organisation and its admin", &organisationRequest{}, &userResponse{}, true},
+	{http.MethodPost, "/api/users/signin", "Sign in the user", &UserRequest{}, &userResponse{}, true},
+	{http.MethodPost, "/api/users/signin/{user_id}/webauthn", "Finish the WebAuthn login", json.RawMessage{}, &JwtResponse{}, true},
+	{http.MethodPost, "/api/users/send_otp", "Send the OTP code", &verificationCodeRequest{}, nil, true},
+	{http.MethodPost, "/api/users/verify_otp", "Verify the OTP or TOTP code and issue the tokens", &verificationCodeRequest{}, &JwtResponse{}, true},
+	{http.MethodPost, "/api/users/refresh", "Issue a new access token for the refresh token", &refreshTokenRequest{}, &JwtResponse{}, true},
+	{http.MethodGet, "/api/me/info", "Logged in user information", nil, &infoResponse{}, false},
+	{http.MethodPost, "/api/users/switch/{organisation_id}", "Switch to the organisation", nil, &JwtResponse{}, false},
+	{http.MethodPost, "/api/users/home/{organisation_id}", "Set the home organisation", nil, nil, false},
+	{http.MethodGet, "/api/ping-jwt", "Check the access token", nil, nil, false},
+	{http.MethodGet, "/api/me/sessions", "List the user sessions", nil, []*cigExchange.Session{}, false},
+	{http.MethodDelete, "/api/me/sessions/{session_id}", "Revoke the session", nil, nil, false},
+	{http.MethodGet, "/api/me/contacts", "List the user contacts", nil, []*models.ContactWithIndex{}, false},
+	{http.MethodPost, "/api/me/contacts", "Create the user contact", &models.ContactWithIndex{}, &models.ContactWithIndex{}, false},
+	{http.MethodPatch, "/api/me/contacts/{contact_id}", "Update the user contact", &models.ContactWithIndex{}, &models.ContactWithIndex{}, false},
+	{http.MethodDelete, "/api/me/contacts/{contact_id}", "Delete the user contact", nil, nil, false},
+	{http.MethodPost, "/api/me/totp", "Generate the TOTP secret, the current code is required if TOTP is enabled", &totpConfirmRequest{}, &totpResponse{}, false},
+	{http.MethodPost, "/api/me/totp/confirm", "Confirm the TOTP code and enable TOTP", &totpConfirmRequest{}, nil, false},
+}
+
+// openAPIComponents are model types described in the spec without an auth route
+var openAPIComponents = []interface{}{&models.Offering{}}
+
+// openAPIFieldTypes overrides the jsonb field types, other jsonb fields are multilang strings
+var openAPIFieldTypes = map[string]reflect.Type{
+	"Offering.map": reflect.TypeOf(models.GeoPoint{}),
+}
+
+var openAPIPathParamRegexp = regexp.MustCompile(`{([a-z_]+)}`)
+
+// OpenAPISpec returns the OpenAPI 3 spec of the auth endpoints with the request and response schemas
+func OpenAPISpec() map[string]interface{} {
+
+	schemas := make(map[string]interface{})
+	errorSchema := openAPISchema(schemas, reflect.TypeOf(cigExchange.APIError{}))
+
+	paths := make(map[string]interface{})
+	for _, route := range openAPIRoutes {
+
+		operation := map[string]interface{}{
+			"summary": route.Summary,
+		}
+
+		parameters := make([]interface{}, 0)
+		for _, match := range openAPIPathParamRegexp.FindAllStringSubmatch(route.Path, -1) {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if route.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  openAPIJSONContent(openAPISchema(schemas, reflect.TypeOf(route.Request))),
+			}
+		}
+
+		responses := map[string]interface{}{
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content":     openAPIJSONContent(errorSchema),
+			},
+		}
+		if route.Response != nil {
+			responses["200"] = map[string]interface{}{
+				"description": "Success",
+				"content":     openAPIJSONContent(openAPISchema(schemas, reflect.TypeOf(route.Response))),
+			}
+		} else {
+			responses["204"] = map[string]interface{}{"description": "Success"}
+		}
+		operation["responses"] = responses
+
+		if !route.Public {
+			operation["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+		}
+
+		pathItem, ok := paths[route.Path].(map[string]interface{})
+		if !ok {
+			pathItem = make(map[string]interface{})
+			paths[route.Path] = pathItem
+		}
+		pathItem[strings.ToLower(route.Method)] = operation
+	}
+
+	for _, component := range openAPIComponents {
+		openAPISchema(schemas, reflect.TypeOf(component))
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "CIG Exchange API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+	}
+}
+
+// OpenAPIHandler handles GET openapi.json endpoint.
+// The spec is public, serve it under SkipPrefix or outside JwtAuthenticationHandler
+func (userAPI *UserAPI) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	cigExchange.Respond(w, OpenAPISpec())
+}
+
+// openAPIJSONContent returns the application/json content with the schema
+func openAPIJSONContent(schema map[string]interface{}) map[string]interface{} {
+
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+// openAPISchema returns the schema of the go type from its json encoding.
+// Structs are added to schemas by the type name and referenced
+func openAPISchema(schemas map[string]interface{}, t reflect.Type) map[string]interface{} {
+
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var schema map[string]interface{}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		schema = map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(json.RawMessage{}):
+		schema = map[string]interface{}{}
+	case t == reflect.TypeOf(postgres.Jsonb{}):
+		return openAPISchema(schemas, reflect.TypeOf(cigExchange.MultilangString{}))
+	case t.Kind() == reflect.String:
+		schema = map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema = map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema = map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		schema = map[string]interface{}{"type": "array", "items": openAPISchema(schemas, t.Elem())}
+	case t.Kind() == reflect.Map:
+		schema = map[string]interface{}{"type": "object", "additionalProperties": openAPISchema(schemas, t.Elem())}
+	case t.Kind() == reflect.Struct:
+		// structs are referenced, nullable can't be combined with $ref
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; ok {
+			return ref
+		}
+		properties := make(map[string]interface{})
+		// placeholder stops the recursion of self referencing types
+		schemas[t.Name()] = properties
+		openAPIProperties(schemas, t, properties)
+		schemas[t.Name()] = map[string]interface{}{"type": "object", "properties": properties}
+		return ref
+	default:
+		schema = map[string]interface{}{}
+	}
+
+	if nullable && len(schema) > 0 {
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+// openAPIProperties adds the json encoded fields of the struct to properties, embedded structs are flattened
+func openAPIProperties(schemas map[string]interface{}, t reflect.Type, properties map[string]interface{}) {
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if field.Anonymous && len(name) == 0 {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				openAPIProperties(schemas, embedded, properties)
+				continue
+			}
+		}
+		if len(field.PkgPath) > 0 {
+			// unexported field
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+
+		if override, ok := openAPIFieldTypes[t.Name()+"."+name]; ok {
+			properties[name] = openAPISchema(schemas, override)
+			continue
+		}
+		properties[name] = openAPISchema(schemas, field.Type)
+	}
+}
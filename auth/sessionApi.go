@@ -0,0 +1,66 @@
+package auth
+
+import (
+	cigExchange "cig-exchange-libs"
+	"cig-exchange-libs/models"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// GetSessionsHandler handles GET api/me/sessions endpoint
+func (userAPI *UserAPI) GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// create user activity record and print error with defer
+	info := cigExchange.PrepareActivityInformation(r)
+	defer CreateUserActivity(info, models.ActivityTypeGetUserSessions)
+	defer cigExchange.PrintAPIError(info)
+
+	// load context user info
+	loggedInUser, err := GetContextValues(r)
+	if err != nil {
+		info.APIError = cigExchange.NewRoutingError(err)
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+	info.LoggedInUser = loggedInUser
+
+	sessions, apiError := cigExchange.ListSessions(loggedInUser.UserUUID)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	cigExchange.Respond(w, sessions)
+}
+
+// DeleteSessionHandler handles DELETE api/me/sessions/{session_id} endpoint
+func (userAPI *UserAPI) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+
+	// create user activity record and print error with defer
+	info := cigExchange.PrepareActivityInformation(r)
+	defer CreateUserActivity(info, models.ActivityTypeDeleteUserSession)
+	defer cigExchange.PrintAPIError(info)
+
+	sessionID := mux.Vars(r)["session_id"]
+
+	// load context user info
+	loggedInUser, err := GetContextValues(r)
+	if err != nil {
+		info.APIError = cigExchange.NewRoutingError(err)
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+	info.LoggedInUser = loggedInUser
+
+	// sessions are stored by user, other users sessions can't be revoked
+	apiError := cigExchange.RevokeSession(loggedInUser.UserUUID, sessionID)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	cigExchange "cig-exchange-libs"
+	"cig-exchange-libs/models"
+	"net/http"
+	"time"
+)
+
+// totpUsedExpiration covers the accepted codes window, older steps are rejected by the validation after it
+const totpUsedExpiration = 90 * time.Second
+
+type totpResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+type totpConfirmRequest struct {
+	Code string `json:"code"`
+}
+
+// EnableTOTPHandler handles POST api/me/totp endpoint.
+// Responds with a new TOTP secret and otpauth url for the QR code, the secret is enabled by ConfirmTOTPHandler.
+// Users with enabled TOTP send the current code in the totpConfirmRequest body
+func (userAPI *UserAPI) EnableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+
+	// create user activity record and print error with defer
+	info := cigExchange.PrepareActivityInformation(r)
+	defer CreateUserActivity(info, models.ActivityTypeEnableTOTP)
+	defer cigExchange.PrintAPIError(info)
+
+	// load context user info
+	loggedInUser, err := GetContextValues(r)
+	if err != nil {
+		info.APIError = cigExchange.NewRoutingError(err)
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+	info.LoggedInUser = loggedInUser
+
+	user, apiError := models.GetUserCtx(r.Context(), loggedInUser.UserUUID)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	// new secret disables the enabled TOTP, so the current code is required
+	if user.TOTPEnabled {
+		apiError = verifyCurrentTOTPCode(r, user)
+		if apiError != nil {
+			info.APIError = apiError
+			cigExchange.RespondWithAPIError(w, info.APIError)
+			return
+		}
+	}
+
+	secret, url, apiError := user.GenerateTOTP()
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	cigExchange.Respond(w, &totpResponse{
+		Secret:     secret,
+		OTPAuthURL: url,
+	})
+}
+
+// ConfirmTOTPHandler handles POST api/me/totp/confirm endpoint
+func (userAPI *UserAPI) ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+
+	// create user activity record and print error with defer
+	info := cigExchange.PrepareActivityInformation(r)
+	defer CreateUserActivity(info, models.ActivityTypeConfirmTOTP)
+	defer cigExchange.PrintAPIError(info)
+
+	// load context user info
+	loggedInUser, err := GetContextValues(r)
+	if err != nil {
+		info.APIError = cigExchange.NewRoutingError(err)
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+	info.LoggedInUser = loggedInUser
+
+	if apiError := cigExchange.CheckJSONContentType(r); apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	reqStruct := &totpConfirmRequest{}
+	apiError := cigExchange.DecodeStrict(r.Body, reqStruct)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	user, apiError := models.GetUserCtx(r.Context(), loggedInUser.UserUUID)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	apiError = user.ConfirmTOTP(reqStruct.Code)
+	if apiError != nil {
+		info.APIError = apiError
+		cigExchange.RespondWithAPIError(w, info.APIError)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// verifyCurrentTOTPCode decodes totpConfirmRequest and checks the code of the enabled TOTP secret.
+// Failed codes count as failed OTP attempts
+func verifyCurrentTOTPCode(r *http.Request, user *models.User) *cigExchange.APIError {
+
+	if apiError := cigExchange.CheckJSONContentType(r); apiError != nil {
+		return apiError
+	}
+
+	reqStruct := &totpConfirmRequest{}
+	apiError := cigExchange.DecodeStrict(r.Body, reqStruct)
+	if apiError != nil {
+		return apiError
+	}
+	if len(reqStruct.Code) == 0 {
+		return cigExchange.NewInvalidFieldError("code", "Current TOTP code is required")
+	}
+
+	apiError = checkOTPAttempts(user.ID)
+	if apiError != nil {
+		return apiError
+	}
+
+	valid, apiError := verifyTOTPCode(user, reqStruct.Code)
+	if apiError != nil {
+		return apiError
+	}
+	if !valid {
+		registerFailedOTPAttempt(user.ID)
+		return cigExchange.NewInvalidFieldError("code", "Invalid code")
+	}
+	resetOTPAttempts(user.ID)
+	return nil
+}
+
+// verifyTOTPCode validates the user TOTP code, codes can be used only once.
+// The last accepted time step is stored, so neither the same code nor an older code of the window can be replayed (RFC 6238 5.2)
+func verifyTOTPCode(user *models.User, code string) (bool, *cigExchange.APIError) {
+
+	if !user.TOTPEnabled {
+		return false, cigExchange.NewInvalidFieldError("type", "User doesn't have TOTP enabled")
+	}
+
+	step, valid, apiError := user.ValidateTOTPStep(code)
+	if apiError != nil || !valid {
+		return false, apiError
+	}
+
+	return claimTOTPStep(user.ID, step)
+}
+
+// claimTOTPStep stores the time step of the user TOTP code as the last accepted one,
+// returns false if the same or a later step was accepted before.
+// The step key lives until the step leaves the accepted window
+func claimTOTPStep(userID string, step int64) (bool, *cigExchange.APIError) {
+
+	rediskey := cigExchange.GenerateRedisKey(userID, cigExchange.KeyTOTPUsed)
+	claimed, err := cigExchange.GetStore().SetIfGreater(rediskey, step, totpUsedExpiration)
+	if err != nil {
+		return false, cigExchange.NewRedisError("Set used totp step failure", err)
+	}
+	return claimed, nil
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	cigExchange "cig-exchange-libs"
+	"testing"
+)
+
+func TestClaimTOTPStepReplay(t *testing.T) {
+
+	cigExchange.SetStore(cigExchange.NewMemoryStore())
+	defer cigExchange.SetStore(nil)
+
+	claimed, apiError := claimTOTPStep("user", 100)
+	if apiError != nil || !claimed {
+		t.Fatalf("first use rejected: %v %v", claimed, apiError)
+	}
+
+	// the same step is replayed
+	claimed, apiError = claimTOTPStep("user", 100)
+	if apiError != nil || claimed {
+		t.Fatalf("replayed step accepted: %v %v", claimed, apiError)
+	}
+
+	// an older code of the window is rejected after a newer one was used
+	claimed, apiError = claimTOTPStep("user", 99)
+	if apiError != nil || claimed {
+		t.Fatalf("older step accepted: %v %v", claimed, apiError)
+	}
+
+	claimed, apiError = claimTOTPStep("user", 101)
+	if apiError != nil || !claimed {
+		t.Fatalf("next step rejected: %v %v", claimed, apiError)
+	}
+
+	// steps are claimed per user
+	claimed, apiError = claimTOTPStep("other", 100)
+	if apiError != nil || !claimed {
+		t.Fatalf("other user step rejected: %v %v", claimed, apiError)
+	}
+}
@@ -2,9 +2,15 @@ package cigExchange
 
 import (
 	"cig-exchange-libs/twilio"
+	"crypto/tls"
 	"fmt"
-	"math/rand"
+	"net"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/duo-labs/webauthn/webauthn"
@@ -17,21 +23,50 @@ import (
 
 var (
 	db             *gorm.DB
-	redisD         *redis.Client
+	readDB         *gorm.DB
+	redisD         redis.UniversalClient
 	twilioOTP      *twilio.OTP
 	web            *webauthn.WebAuthn
 	mandrillClient *gochimp.MandrillAPI
 )
 var isDevEnvironment bool
+var welcomeEmailOnVerify bool
+var allowOTPInResponse bool
 
-func init() {
+// default number of failed OTP verifications before the lockout
+const defaultOTPMaxAttempts = 5
+
+var otpMaxAttempts = defaultOTPMaxAttempts
+
+// default number of days soft deleted records are kept before the purge
+const defaultSoftDeleteRetentionDays = 90
+
+var softDeleteRetentionDays = defaultSoftDeleteRetentionDays
+
+// default offering rating scale, from the best to the worst rating
+const defaultOfferingRatingScale = "AAA,AA,A,BBB,BB,B,CCC,CC,C,D"
+
+var offeringRatingScale []string
+
+// proxies allowed to set the client IP forwarding headers
+var trustedProxies []*net.IPNet
+
+// maximum number of concurrent sessions per user, 0 means unlimited
+var maxSessionsPerUser = 0
+
+// default postgres statement timeout in seconds
+const defaultDBStatementTimeoutSeconds = 30
 
-	// Random init
-	rand.Seed(time.Now().UnixNano())
+var dbStatementTimeoutSeconds = defaultDBStatementTimeoutSeconds
+
+func init() {
 
 	err := godotenv.Load()
+
+	// Structured logger level can be set in .env, so the loading error is logged after
+	logger = newJSONLogger(os.Stdout, os.Getenv("LOG_LEVEL"))
 	if err != nil {
-		fmt.Print(err)
+		logger.Warn(".env loading failed", "error", err)
 	}
 
 	// Determine environment type
@@ -39,6 +74,88 @@ func init() {
 		isDevEnvironment = true
 	}
 
+	// Returning OTP codes in api responses requires explicit opt-in on top of dev environment
+	if isDevEnvironment && os.Getenv("ALLOW_OTP_IN_RESPONSE") == "true" {
+		allowOTPInResponse = true
+		logger.Warn("ALLOW_OTP_IN_RESPONSE is enabled: OTP codes are returned in api responses, this must never be enabled in production")
+	}
+
+	// Failed OTP verifications limit
+	otpMaxAttempts = getEnvPositiveInt("OTP_MAX_ATTEMPTS", defaultOTPMaxAttempts)
+
+	// Soft deleted records retention window
+	softDeleteRetentionDays = getEnvPositiveInt("SOFT_DELETE_RETENTION_DAYS", defaultSoftDeleteRetentionDays)
+
+	// Concurrent sessions limit, 0 or missing means unlimited
+	if len(os.Getenv("MAX_SESSIONS_PER_USER")) > 0 && os.Getenv("MAX_SESSIONS_PER_USER") != "0" {
+		maxSessionsPerUser = getEnvPositiveInt("MAX_SESSIONS_PER_USER", 0)
+	}
+
+	// Postgres statement timeout, 0 disables the timeout
+	if os.Getenv("DB_STATEMENT_TIMEOUT_SECONDS") == "0" {
+		dbStatementTimeoutSeconds = 0
+	} else {
+		dbStatementTimeoutSeconds = getEnvPositiveInt("DB_STATEMENT_TIMEOUT_SECONDS", defaultDBStatementTimeoutSeconds)
+	}
+
+	// Offering rating scale, comma separated ratings from the best to the worst
+	offeringRatingScale = parseRatingScale(os.Getenv("OFFERING_RATING_SCALE"))
+	if len(offeringRatingScale) == 0 {
+		offeringRatingScale = parseRatingScale(defaultOfferingRatingScale)
+	}
+
+	// Trusted proxies, comma separated IPs or CIDRs
+	trustedProxies = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+
+	// Send welcome email after the user verification instead of at signup
+	if os.Getenv("WELCOME_EMAIL_ON_VERIFY") == "true" {
+		welcomeEmailOnVerify = true
+	}
+
+	// Captcha verification on signup, disabled if CAPTCHA_SECRET is not set
+	captchaSecret = os.Getenv("CAPTCHA_SECRET")
+	if len(os.Getenv("CAPTCHA_VERIFY_URL")) > 0 {
+		captchaVerifyURL = os.Getenv("CAPTCHA_VERIFY_URL")
+	}
+
+	// Email domain blocklist and allowlist, comma separated domains or wildcard patterns.
+	// EMAIL_DOMAIN_BLOCKLIST_FILE adds the domains from the file, one per line
+	blocklist := strings.Split(os.Getenv("EMAIL_DOMAIN_BLOCKLIST"), ",")
+	if blocklistFile := os.Getenv("EMAIL_DOMAIN_BLOCKLIST_FILE"); len(blocklistFile) > 0 {
+		fileDomains, err := ReadEmailDomainsFile(blocklistFile)
+		if err != nil {
+			logger.Warn("email domain blocklist file reading failed", "file", blocklistFile, "error", err)
+		}
+		blocklist = append(blocklist, fileDomains...)
+	}
+	SetEmailDomainLists(blocklist, strings.Split(os.Getenv("EMAIL_DOMAIN_ALLOWLIST"), ","))
+
+	// Email domain MX lookup on validation, off by default as it adds DNS latency
+	if os.Getenv("EMAIL_MX_CHECK") == "true" {
+		emailMXCheck = true
+		emailMXTimeout = time.Duration(getEnvPositiveInt("EMAIL_MX_TIMEOUT_MS", int(defaultEmailMXTimeout/time.Millisecond))) * time.Millisecond
+	}
+
+	// Secrets encryption key, base64 encoded 32 bytes.
+	// Invalid keys stop the startup, data written with a wrong key can't be read back
+	if len(os.Getenv("ENCRYPTION_KEY")) > 0 {
+		encryptionKey, err = parseEncryptionKey(os.Getenv("ENCRYPTION_KEY"))
+		if err != nil {
+			panic(fmt.Sprintf("Invalid ENCRYPTION_KEY: %v", err))
+		}
+	}
+
+	// Blind index key, base64 encoded 32 bytes, must differ from ENCRYPTION_KEY
+	if len(os.Getenv("BLIND_INDEX_KEY")) > 0 {
+		blindIndexKey, err = parseEncryptionKey(os.Getenv("BLIND_INDEX_KEY"))
+		if err != nil {
+			panic(fmt.Sprintf("Invalid BLIND_INDEX_KEY: %v", err))
+		}
+		if os.Getenv("BLIND_INDEX_KEY") == os.Getenv("ENCRYPTION_KEY") {
+			panic("BLIND_INDEX_KEY must differ from ENCRYPTION_KEY")
+		}
+	}
+
 	// Twilio Init
 	twilioAPIKey := os.Getenv("TWILIO_APIKEY")
 	twilioOTP = twilio.NewOTP(twilioAPIKey)
@@ -47,7 +164,7 @@ func init() {
 	mandrillKey := os.Getenv("MANDRILL_KEY")
 	mandrillClient, err = gochimp.NewMandrill(mandrillKey)
 	if err != nil {
-		fmt.Print(err)
+		logger.Error("mandrill client init failed", "error", err)
 	}
 
 	// WebAuthn init
@@ -63,49 +180,303 @@ func init() {
 		RPID:          rpID,        // Generally the FQDN for your site
 	})
 	if err != nil {
-		fmt.Println(err)
+		logger.Error("webauthn init failed", "error", err)
 	}
 
 	// PostgreSQL Init
+	// DATABASE_URL is used verbatim if set and takes precedence over the DB_* variables,
+	// it should set statement_timeout itself
 	username := os.Getenv("DB_USER")
+	password := os.Getenv("DB_PASSWORD")
 	dbName := os.Getenv("DB_NAME")
-	dbHost := os.Getenv("DB_HOST")
 	dbPort := os.Getenv("DB_PORT")
+	dbSSLMode := os.Getenv("DB_SSLMODE")
+	dbSSLRootCert := os.Getenv("DB_SSLROOTCERT")
+	dbStatementTimeout := time.Duration(dbStatementTimeoutSeconds) * time.Second
+
+	dbURI := os.Getenv("DATABASE_URL")
+	if len(dbURI) == 0 {
+		dbURI = postgresDSN(os.Getenv("DB_HOST"), dbPort, username, password, dbName, dbSSLMode, dbSSLRootCert, dbStatementTimeout)
+	}
+	db = openDB(dbURI)
+
+	// Optional read replica for the read heavy queries, uses the primary credentials
+	replicaHost := os.Getenv("DB_REPLICA_HOST")
+	if len(replicaHost) > 0 {
+		replicaPort := os.Getenv("DB_REPLICA_PORT")
+		if len(replicaPort) == 0 {
+			replicaPort = dbPort
+		}
+		readDB = openDB(postgresDSN(replicaHost, replicaPort, username, password, dbName, dbSSLMode, dbSSLRootCert, dbStatementTimeout))
+	}
+
+	// Redis Init
+
+	client := newRedisClient(os.Getenv("REDIS_MODE"))
+
+	logger.Info("connecting to redis")
+	pong, err := client.Ping().Result()
+	if err != nil {
+		logger.Error("redis ping failed", "error", err)
+	} else {
+		logger.Info("redis connected", "ping", pong)
+	}
+	redisD = client
+}
+
+// openDB connects to postgres retrying once if the database is still starting
+func openDB(dbURI string) *gorm.DB {
 
-	dbURI := fmt.Sprintf("host=%s user=%s dbname=%s sslmode=require port=%s", dbHost, username, dbName, dbPort)
-	fmt.Println(dbURI)
+	logger.Info("connecting to database", "dsn", redactDSN(dbURI))
 
 	conn, err := gorm.Open("postgres", dbURI)
 	if err != nil {
-		fmt.Println(err)
 		reconnectTimeoutSeconds := 15
-		fmt.Printf("Database container can be still starting... reconnecting in %d seconds\n", reconnectTimeoutSeconds)
+		logger.Warn("database connection failed, the container can be still starting", "error", err, "reconnect_seconds", reconnectTimeoutSeconds)
 		time.Sleep(time.Second * time.Duration(reconnectTimeoutSeconds))
 		conn, err = gorm.Open("postgres", dbURI)
 		if err != nil {
-			fmt.Printf("Failed to reconnect: %v\n", err.Error())
+			logger.Error("database reconnection failed", "error", err)
 		}
 	}
 
-	db = conn
+	if conn != nil {
+		registerDBMetricsCallbacks(conn)
+		registerDBContextCallbacks(conn)
+		registerDBTracingCallbacks(conn)
+		registerDBAuditCallbacks(conn)
+	}
+	return conn
+}
 
-	// Redis Init
+// getEnvPositiveInt reads positive integer environment variable, defaultValue is used if it's missing or invalid
+func getEnvPositiveInt(name string, defaultValue int) int {
+
+	valueStr := os.Getenv(name)
+	if len(valueStr) == 0 {
+		return defaultValue
+	}
+
+	value, err := strconv.Atoi(valueStr)
+	if err != nil || value <= 0 {
+		logger.Warn("invalid environment variable value, using default", "name", name, "value", valueStr, "default", defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+// default postgres ssl mode
+const defaultDBSSLMode = "require"
+
+// postgres ssl modes supported by the driver
+var dbSSLModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+// postgresDSN builds postgres connection url with escaped components, empty password is omitted.
+// sslMode defaults to require, sslRootCert is the optional CA certificate path for verify-ca and verify-full.
+// Non zero statementTimeout is set as the connection statement_timeout
+func postgresDSN(host, port, user, password, dbName, sslMode, sslRootCert string, statementTimeout time.Duration) string {
 
-	redisHost := os.Getenv("REDIS_HOST")
-	redisPort := os.Getenv("REDIS_PORT")
-	client := redis.NewClient(&redis.Options{
-		Addr:     redisHost + ":" + redisPort,
-		Password: "", // no password set
-		DB:       0,  // use default DB
+	sslMode = strings.ToLower(strings.TrimSpace(sslMode))
+	if len(sslMode) == 0 {
+		sslMode = defaultDBSSLMode
+	} else if !slices.Contains(dbSSLModes, sslMode) {
+		logger.Warn("invalid DB_SSLMODE value, using default", "value", sslMode, "default", defaultDBSSLMode)
+		sslMode = defaultDBSSLMode
+	}
+
+	query := url.Values{}
+	query.Set("sslmode", sslMode)
+	if len(sslRootCert) > 0 {
+		query.Set("sslrootcert", sslRootCert)
+	}
+	if statementTimeout > 0 {
+		// unknown parameters are sent to the server as run-time parameters
+		query.Set("statement_timeout", strconv.FormatInt(statementTimeout.Milliseconds(), 10))
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.User(user),
+		Host:     host,
+		Path:     "/" + dbName,
+		RawQuery: query.Encode(),
+	}
+	if len(password) > 0 {
+		dsn.User = url.UserPassword(user, password)
+	}
+	if len(port) > 0 {
+		dsn.Host = net.JoinHostPort(host, port)
+	}
+	return dsn.String()
+}
+
+// redactDSN hides the password of the postgres connection url for logging
+func redactDSN(dsn string) string {
+
+	parsed, err := url.Parse(dsn)
+	if err != nil || len(parsed.Scheme) == 0 {
+		// key=value connection strings aren't logged, they can contain the password
+		return "postgres connection string"
+	}
+	return parsed.Redacted()
+}
+
+// Constants defining redis client modes
+const (
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+)
+
+// newRedisClient creates redis client for the mode, single node client is the default:
+// single uses REDIS_HOST and REDIS_PORT,
+// sentinel uses REDIS_MASTER_NAME and comma separated REDIS_SENTINEL_ADDRS,
+// cluster uses comma separated REDIS_CLUSTER_ADDRS
+func newRedisClient(mode string) redis.UniversalClient {
+
+	password := os.Getenv("REDIS_PASSWORD") // empty for no password
+	tlsConfig := redisTLSConfig()
+
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case RedisModeSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    os.Getenv("REDIS_MASTER_NAME"),
+			SentinelAddrs: splitAddrs(os.Getenv("REDIS_SENTINEL_ADDRS")),
+			Password:      password,
+			DB:            0, // use default DB
+			TLSConfig:     tlsConfig,
+		})
+	case RedisModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     splitAddrs(os.Getenv("REDIS_CLUSTER_ADDRS")),
+			Password:  password,
+			TLSConfig: tlsConfig,
+		})
+	case "", RedisModeSingle:
+	default:
+		logger.Warn("invalid REDIS_MODE value, using default", "value", mode, "default", RedisModeSingle)
+	}
+
+	return redis.NewClient(&redis.Options{
+		Addr:      os.Getenv("REDIS_HOST") + ":" + os.Getenv("REDIS_PORT"),
+		Password:  password,
+		DB:        0, // use default DB
+		TLSConfig: tlsConfig,
 	})
+}
 
-	fmt.Println("connecting to Redis...")
-	pong, err := client.Ping().Result()
-	if err != nil {
-		fmt.Print(err)
+// splitAddrs splits comma separated host:port addresses
+func splitAddrs(addrs string) []string {
+
+	result := make([]string, 0)
+	for _, addr := range strings.Split(addrs, ",") {
+		addr = strings.TrimSpace(addr)
+		if len(addr) > 0 {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
+// ScanRedisKeys returns all redis keys matching the pattern.
+// Cluster keys are scanned on every master node
+func ScanRedisKeys(match string) ([]string, error) {
+
+	if cluster, ok := GetRedis().(*redis.ClusterClient); ok {
+		keys := make([]string, 0)
+		var mutex sync.Mutex
+		err := cluster.ForEachMaster(func(client *redis.Client) error {
+			nodeKeys, err := scanRedisKeys(client, match)
+			mutex.Lock()
+			keys = append(keys, nodeKeys...)
+			mutex.Unlock()
+			return err
+		})
+		return keys, err
+	}
+	return scanRedisKeys(GetRedis(), match)
+}
+
+// scanRedisKeys iterates the SCAN cursor of the single node
+func scanRedisKeys(client redis.Cmdable, match string) ([]string, error) {
+
+	keys := make([]string, 0)
+	cursor := uint64(0)
+	for {
+		pageKeys, nextCursor, err := client.Scan(cursor, match, 100).Result()
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, pageKeys...)
+
+		cursor = nextCursor
+		if cursor == 0 {
+			return keys, nil
+		}
 	}
-	fmt.Println(pong)
-	redisD = client
+}
+
+// redisTLSConfig returns redis TLS config if REDIS_TLS is enabled, REDIS_TLS_SKIP_VERIFY disables certificate verification
+func redisTLSConfig() *tls.Config {
+
+	if os.Getenv("REDIS_TLS") != "true" {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if os.Getenv("REDIS_TLS_SKIP_VERIFY") == "true" {
+		logger.Warn("REDIS_TLS_SKIP_VERIFY is enabled: redis server certificate is not verified")
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig
+}
+
+// parseTrustedProxies parses comma separated IPs and CIDRs, invalid entries are skipped
+func parseTrustedProxies(value string) []*net.IPNet {
+
+	proxies := make([]*net.IPNet, 0)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				logger.Warn("invalid trusted proxy", "value", entry)
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			logger.Warn("invalid trusted proxy", "value", entry)
+			continue
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies
+}
+
+// parseRatingScale splits comma separated ratings
+func parseRatingScale(scale string) []string {
+
+	ratings := make([]string, 0)
+	for _, rating := range strings.Split(scale, ",") {
+		rating = strings.TrimSpace(rating)
+		if len(rating) > 0 {
+			ratings = append(ratings, rating)
+		}
+	}
+	return ratings
 }
 
 // GetDB returns a gorm database object singletone
@@ -113,8 +484,19 @@ func GetDB() *gorm.DB {
 	return db
 }
 
-// GetRedis returns a redis client object singletone
-func GetRedis() *redis.Client {
+// GetReadDB returns a gorm database object of the read replica if DB_REPLICA_HOST is set, the primary otherwise.
+// Use it only for read only queries that tolerate the replication lag, writes must use GetDB
+func GetReadDB() *gorm.DB {
+
+	if readDB != nil {
+		return readDB
+	}
+	return db
+}
+
+// GetRedis returns a redis client object singletone.
+// The client is a single node, sentinel failover or cluster client depending on REDIS_MODE
+func GetRedis() redis.UniversalClient {
 	return redisD
 }
 
@@ -138,6 +520,37 @@ func IsDevEnv() bool {
 	return isDevEnvironment
 }
 
+// IsOTPInResponseAllowed returns true if OTP codes can be returned in api responses.
+// Requires both dev environment and ALLOW_OTP_IN_RESPONSE=true
+func IsOTPInResponseAllowed() bool {
+	return isDevEnvironment && allowOTPInResponse
+}
+
+// GetOTPMaxAttempts returns the number of failed OTP verifications allowed before the lockout
+func GetOTPMaxAttempts() int {
+	return otpMaxAttempts
+}
+
+// GetSoftDeleteRetention returns how long soft deleted records are kept before the purge
+func GetSoftDeleteRetention() time.Duration {
+	return time.Duration(softDeleteRetentionDays) * 24 * time.Hour
+}
+
+// GetMaxSessionsPerUser returns the concurrent sessions limit per user, 0 means unlimited
+func GetMaxSessionsPerUser() int {
+	return maxSessionsPerUser
+}
+
+// GetOfferingRatingScale returns allowed offering ratings ordered from the best to the worst
+func GetOfferingRatingScale() []string {
+	return offeringRatingScale
+}
+
+// IsWelcomeEmailOnVerify returns true if welcome email is sent after the user verification
+func IsWelcomeEmailOnVerify() bool {
+	return welcomeEmailOnVerify
+}
+
 // GetServerURL return Dev or Prod urls.
 // TODO: Need to add staging and prod local urls
 func GetServerURL() string {
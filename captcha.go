@@ -0,0 +1,62 @@
+package cigExchange
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// default captcha verification endpoint, reCAPTCHA uses https://www.google.com/recaptcha/api/siteverify
+const defaultCaptchaVerifyURL = "https://hcaptcha.com/siteverify"
+
+var (
+	captchaSecret    string
+	captchaVerifyURL = defaultCaptchaVerifyURL
+	captchaClient    = &http.Client{Timeout: 10 * time.Second}
+)
+
+// IsCaptchaEnabled returns true if CAPTCHA_SECRET is set
+func IsCaptchaEnabled() bool {
+	return len(captchaSecret) > 0
+}
+
+// VerifyCaptcha verifies the captcha response token with the provider.
+// hCaptcha and reCAPTCHA share the verification API, the provider is chosen with CAPTCHA_VERIFY_URL.
+// Returns nil if captcha is disabled
+func VerifyCaptcha(token, remoteIP string) *APIError {
+
+	if !IsCaptchaEnabled() {
+		return nil
+	}
+
+	token = strings.TrimSpace(token)
+	if len(token) == 0 {
+		return NewInvalidFieldError("captcha", "Captcha is required")
+	}
+
+	form := url.Values{}
+	form.Set("secret", captchaSecret)
+	form.Set("response", token)
+	if len(remoteIP) > 0 {
+		form.Set("remoteip", remoteIP)
+	}
+
+	resp, err := captchaClient.PostForm(captchaVerifyURL, form)
+	if err != nil {
+		return NewCaptchaError("Captcha verification request failed", err)
+	}
+	defer resp.Body.Close()
+
+	result := &struct {
+		Success bool `json:"success"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return NewCaptchaError("Captcha verification response parsing failed", err)
+	}
+	if !result.Success {
+		return NewInvalidFieldError("captcha", "Captcha verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+// Command migrate applies the database migrations.
+// Database connection is configured with the same environment variables as the library
+package main
+
+import (
+	cigExchange "cig-exchange-libs"
+	"cig-exchange-libs/models"
+	"os"
+)
+
+func main() {
+
+	apiError := models.Migrate()
+	if apiError != nil {
+		cigExchange.LogAPIError("migrate: migrations failed", apiError)
+		os.Exit(1)
+	}
+
+	// contacts created before BLIND_INDEX_KEY was set are hashed on every run
+	apiError = models.BackfillContactEmailHashes()
+	if apiError != nil {
+		cigExchange.LogAPIError("migrate: contact email hashes backfill failed", apiError)
+		os.Exit(1)
+	}
+
+	// contacts stored before ENCRYPTION_KEY and BLIND_INDEX_KEY were set are encrypted on every run
+	apiError = models.EncryptContactValues()
+	if apiError != nil {
+		cigExchange.LogAPIError("migrate: contact values encryption failed", apiError)
+		os.Exit(1)
+	}
+}
@@ -1,10 +1,12 @@
 package cigExchange
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"reflect"
 	"sort"
+	"strings"
 
 	"github.com/jinzhu/gorm/dialects/postgres"
 )
@@ -22,6 +24,46 @@ type MultilangString struct {
 	De string `json:"de"`
 }
 
+// ParseMultilangString decodes jsonb value to MultilangString.
+// Returns error for values other than object with "en", "it", "fr", "de" string fields
+func ParseMultilangString(fieldName string, raw json.RawMessage) (*MultilangString, *APIError) {
+
+	mString := &MultilangString{}
+
+	// empty value
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return mString, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(mString); err != nil {
+		return mString, NewInvalidFieldError(fieldName, "Field '"+fieldName+"' must be an object with 'en', 'it', 'fr', 'de' string fields")
+	}
+	return mString, nil
+}
+
+// DecodeStrict decodes JSON body into v and rejects unknown fields.
+// Returns invalid field error naming the unknown field, so misspelled fields are not silently ignored
+func DecodeStrict(body io.Reader, v interface{}) *APIError {
+
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err == nil {
+		return nil
+	}
+
+	// encoding/json has no typed error for unknown fields
+	const unknownFieldPrefix = "json: unknown field "
+	if strings.HasPrefix(err.Error(), unknownFieldPrefix) {
+		field := strings.Trim(strings.TrimPrefix(err.Error(), unknownFieldPrefix), `"`)
+		return NewInvalidFieldError(field, "Unknown field '"+field+"'")
+	}
+	return NewRequestDecodingError(err)
+}
+
 // ReadAndParseRequest fills 'model', 'original' and 'filtered' with data from body
 func ReadAndParseRequest(body io.ReadCloser, model MultilangModel) (original, filtered map[string]interface{}, apiError *APIError) {
 
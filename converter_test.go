@@ -0,0 +1,45 @@
+package cigExchange
+
+import (
+	"strings"
+	"testing"
+)
+
+type decodeStrictRequest struct {
+	Name     string `json:"name"`
+	LastName string `json:"lastname"`
+}
+
+func TestDecodeStrictUnknownField(t *testing.T) {
+
+	request := &decodeStrictRequest{}
+	apiError := DecodeStrict(strings.NewReader(`{"name":"John","last_name":"Doe"}`), request)
+	if apiError == nil {
+		t.Fatal("misspelled field accepted")
+	}
+	if apiError.Code != 400 || len(apiError.Errors) != 1 {
+		t.Fatalf("expected single bad request error, got %v", apiError.ToString())
+	}
+	nestedError := apiError.Errors[0]
+	if nestedError.Reason != ReasonFieldInvalid || nestedError.Field != "last_name" {
+		t.Errorf("expected invalid field last_name, got %+v", nestedError)
+	}
+}
+
+func TestDecodeStrictValidBody(t *testing.T) {
+
+	// encoding/json matches the field names case insensitively
+	request := &decodeStrictRequest{}
+	if apiError := DecodeStrict(strings.NewReader(`{"name":"John","lastName":"Doe"}`), request); apiError != nil {
+		t.Fatalf("unexpected error: %v", apiError.ToString())
+	}
+	if request.Name != "John" || request.LastName != "Doe" {
+		t.Errorf("unexpected request %+v", request)
+	}
+
+	// malformed json isn't reported as unknown field
+	apiError := DecodeStrict(strings.NewReader(`{"name":`), request)
+	if apiError == nil || len(apiError.Errors) == 0 || apiError.Errors[0].Reason != ReasonJSONFailure {
+		t.Errorf("expected json failure, got %v", apiError)
+	}
+}
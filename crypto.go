@@ -0,0 +1,165 @@
+package cigExchange
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrEncryptionKeyMissing is returned if ENCRYPTION_KEY is not set
+var ErrEncryptionKeyMissing = errors.New("encryption key is not set")
+
+// ErrBlindIndexKeyMissing is returned if BLIND_INDEX_KEY is not set
+var ErrBlindIndexKeyMissing = errors.New("blind index key is not set")
+
+// AES-256 key of the secrets encryption
+var encryptionKey []byte
+
+// HMAC key of the blind indexes, must differ from the encryption key
+var blindIndexKey []byte
+
+// prefix of the EncryptedString column values, values without it are plaintext
+const encryptedValuePrefix = "enc:v1:"
+
+// parseEncryptionKey decodes the base64 encoded 32 bytes key
+func parseEncryptionKey(value string) ([]byte, error) {
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes")
+	}
+	return key, nil
+}
+
+// EncryptString encrypts the value with AES-GCM using ENCRYPTION_KEY.
+// Returns base64 encoded nonce and ciphertext, every call uses a random nonce
+func EncryptString(plaintext string) (string, error) {
+
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString decrypts the value encrypted with EncryptString
+func DecryptString(ciphertext string) (string, error) {
+
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("ciphertext is too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// newGCM creates the AES-GCM cipher of the encryption key
+func newGCM() (cipher.AEAD, error) {
+
+	if len(encryptionKey) == 0 {
+		return nil, ErrEncryptionKeyMissing
+	}
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptedString is a string column encrypted at rest with EncryptString.
+// Values are encrypted on write and decrypted on read transparently, plaintext values
+// written before the column was encrypted are read as is until they are saved again.
+// Encrypted columns can't be searched, use BlindIndex for the exact match lookups
+type EncryptedString string
+
+// Value encrypts the string for db, empty string is stored as is
+func (value EncryptedString) Value() (driver.Value, error) {
+
+	if len(value) == 0 {
+		return "", nil
+	}
+	ciphertext, err := EncryptString(string(value))
+	if err != nil {
+		return nil, err
+	}
+	return encryptedValuePrefix + ciphertext, nil
+}
+
+// Scan decrypts the db value
+func (value *EncryptedString) Scan(src interface{}) error {
+
+	var stored string
+	switch v := src.(type) {
+	case nil:
+		stored = ""
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("EncryptedString: unsupported type %T", src)
+	}
+
+	if !IsEncryptedValue(stored) {
+		*value = EncryptedString(stored)
+		return nil
+	}
+	plaintext, err := DecryptString(strings.TrimPrefix(stored, encryptedValuePrefix))
+	if err != nil {
+		return err
+	}
+	*value = EncryptedString(plaintext)
+	return nil
+}
+
+// IsEncryptedValue returns true if the db value is written by EncryptedString
+func IsEncryptedValue(stored string) bool {
+	return strings.HasPrefix(stored, encryptedValuePrefix)
+}
+
+// IsEncryptionEnabled returns true if ENCRYPTION_KEY and BLIND_INDEX_KEY are set.
+// Searchable values are encrypted only with both keys, they are looked up by the blind index
+func IsEncryptionEnabled() bool {
+	return len(encryptionKey) > 0 && len(blindIndexKey) > 0
+}
+
+// BlindIndex returns the HMAC-SHA256 of the value with BLIND_INDEX_KEY as hex string.
+// The same value always has the same index, so encrypted values can be looked up by the index column
+func BlindIndex(value string) (string, error) {
+
+	if len(blindIndexKey) == 0 {
+		return "", ErrBlindIndexKeyMissing
+	}
+	mac := hmac.New(sha256.New, blindIndexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
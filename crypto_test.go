@@ -0,0 +1,141 @@
+package cigExchange
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// setTestKeys replaces the encryption keys, the returned function restores them
+func setTestKeys(encryption, blindIndex []byte) func() {
+
+	defaultEncryptionKey, defaultBlindIndexKey := encryptionKey, blindIndexKey
+	encryptionKey, blindIndexKey = encryption, blindIndex
+	return func() {
+		encryptionKey, blindIndexKey = defaultEncryptionKey, defaultBlindIndexKey
+	}
+}
+
+func TestEncryptDecryptString(t *testing.T) {
+
+	defer setTestKeys(bytes.Repeat([]byte{1}, 32), nil)()
+
+	first, err := EncryptString("secret value")
+	if err != nil {
+		t.Fatalf("encryption failed: %v", err)
+	}
+	second, _ := EncryptString("secret value")
+	if first == second || strings.Contains(first, "secret") {
+		t.Errorf("ciphertext %q is not randomized", first)
+	}
+
+	for _, ciphertext := range []string{first, second} {
+		if plaintext, err := DecryptString(ciphertext); err != nil || plaintext != "secret value" {
+			t.Errorf("expected secret value, got %q %v", plaintext, err)
+		}
+	}
+}
+
+func TestDecryptStringWrongKey(t *testing.T) {
+
+	restore := setTestKeys(bytes.Repeat([]byte{1}, 32), nil)
+	defer restore()
+
+	ciphertext, err := EncryptString("secret value")
+	if err != nil {
+		t.Fatalf("encryption failed: %v", err)
+	}
+
+	encryptionKey = bytes.Repeat([]byte{2}, 32)
+	if plaintext, err := DecryptString(ciphertext); err == nil {
+		t.Errorf("decrypted with the wrong key: %q", plaintext)
+	}
+
+	encryptionKey = nil
+	if _, err := DecryptString(ciphertext); err != ErrEncryptionKeyMissing {
+		t.Errorf("expected ErrEncryptionKeyMissing, got %v", err)
+	}
+}
+
+func TestEncryptedStringValueScan(t *testing.T) {
+
+	defer setTestKeys(bytes.Repeat([]byte{1}, 32), nil)()
+
+	stored, err := EncryptedString("secret value").Value()
+	if err != nil {
+		t.Fatalf("encryption failed: %v", err)
+	}
+	if !IsEncryptedValue(stored.(string)) {
+		t.Fatalf("stored value %q has no prefix", stored)
+	}
+
+	var value EncryptedString
+	if err := value.Scan([]byte(stored.(string))); err != nil || value != "secret value" {
+		t.Errorf("expected secret value, got %q %v", value, err)
+	}
+
+	// plaintext written before the encryption is read as is
+	for _, legacy := range []interface{}{"legacy value", []byte("legacy value")} {
+		if err := value.Scan(legacy); err != nil || value != "legacy value" {
+			t.Errorf("expected legacy value, got %q %v", value, err)
+		}
+	}
+	if err := value.Scan(nil); err != nil || value != "" {
+		t.Errorf("expected empty value, got %q %v", value, err)
+	}
+	if stored, _ := EncryptedString("").Value(); stored != "" {
+		t.Errorf("empty value is encrypted: %v", stored)
+	}
+}
+
+func TestIsEncryptionEnabled(t *testing.T) {
+
+	key := bytes.Repeat([]byte{1}, 32)
+	otherKey := bytes.Repeat([]byte{2}, 32)
+	tests := []struct {
+		name       string
+		encryption []byte
+		blindIndex []byte
+		expected   bool
+	}{
+		{"no keys", nil, nil, false},
+		{"only encryption key", key, nil, false},
+		{"only blind index key", nil, otherKey, false},
+		{"both keys", key, otherKey, true},
+	}
+
+	for _, test := range tests {
+		restore := setTestKeys(test.encryption, test.blindIndex)
+		if got := IsEncryptionEnabled(); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+		restore()
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+
+	restore := setTestKeys(nil, bytes.Repeat([]byte{2}, 32))
+	defer restore()
+
+	first, err := BlindIndex("john@example.com")
+	if err != nil {
+		t.Fatalf("blind index failed: %v", err)
+	}
+	if second, _ := BlindIndex("john@example.com"); second != first {
+		t.Errorf("index is not deterministic: %q %q", first, second)
+	}
+	if other, _ := BlindIndex("jane@example.com"); other == first {
+		t.Error("different values have the same index")
+	}
+
+	blindIndexKey = bytes.Repeat([]byte{3}, 32)
+	if otherKey, _ := BlindIndex("john@example.com"); otherKey == first {
+		t.Error("different keys have the same index")
+	}
+
+	blindIndexKey = nil
+	if _, err := BlindIndex("john@example.com"); err != ErrBlindIndexKeyMissing {
+		t.Errorf("expected ErrBlindIndexKeyMissing, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package cigExchange
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+)
+
+// scope key of the query context
+const contextScopeKey = "cig:context"
+
+// GetDBWithContext returns a gorm database object carrying the context.
+// Queries create child spans of the context span and aren't executed once the context is done
+func GetDBWithContext(ctx context.Context) *gorm.DB {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return GetDB().Set(contextScopeKey, ctx)
+}
+
+// GetReadDBWithContext returns a read replica gorm database object carrying the context, see GetReadDB
+func GetReadDBWithContext(ctx context.Context) *gorm.DB {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return GetReadDB().Set(contextScopeKey, ctx)
+}
+
+// scopeContext returns the context set by GetDBWithContext
+func scopeContext(scope *gorm.Scope) context.Context {
+
+	if value, ok := scope.Get(contextScopeKey); ok {
+		if ctx, ok := value.(context.Context); ok && ctx != nil {
+			return ctx
+		}
+	}
+	return context.Background()
+}
+
+// registerDBContextCallbacks registers gorm callbacks aborting queries of cancelled or expired contexts.
+// gorm v1 can't interrupt running queries, the context is checked before the query is sent
+func registerDBContextCallbacks(db *gorm.DB) {
+
+	checkContext := func(scope *gorm.Scope) {
+		if err := scopeContext(scope).Err(); err != nil {
+			scope.Err(err)
+		}
+	}
+
+	callback := db.Callback()
+	callback.Create().Before("gorm:begin_transaction").Register("cig:context_create", checkContext)
+	callback.Query().Before("gorm:query").Register("cig:context_query", checkContext)
+	callback.Update().Before("gorm:begin_transaction").Register("cig:context_update", checkContext)
+	callback.Delete().Before("gorm:begin_transaction").Register("cig:context_delete", checkContext)
+}
+
+// WithTransaction runs fn in a database transaction.
+// The transaction is committed if fn returns nil and rolled back if fn returns an error or panics
+func WithTransaction(fn func(tx *gorm.DB) *APIError) *APIError {
+	return WithTransactionCtx(context.Background(), fn)
+}
+
+// WithTransactionCtx runs fn in a database transaction carrying the context, see WithTransaction
+func WithTransactionCtx(ctx context.Context, fn func(tx *gorm.DB) *APIError) *APIError {
+
+	tx := GetDBWithContext(ctx).Begin()
+	if tx.Error != nil {
+		return NewDatabaseError("Begin transaction failed", tx.Error)
+	}
+
+	// rollback on error and panic, the panic is propagated
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	apiError := fn(tx)
+	if apiError != nil {
+		return apiError
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return NewDatabaseError("Commit transaction failed", err)
+	}
+	committed = true
+	return nil
+}
@@ -0,0 +1,143 @@
+package cigExchange
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default MX lookup timeout
+const defaultEmailMXTimeout = 2 * time.Second
+
+var (
+	emailDomainsMutex     sync.RWMutex
+	emailDomainsBlocklist []string
+	emailDomainsAllowlist []string
+
+	emailMXCheck   bool
+	emailMXTimeout = defaultEmailMXTimeout
+)
+
+// ValidateEmail checks the email address format and the domain lists.
+// Allowlisted domains are accepted, blocklisted domains are rejected, see SetEmailDomainLists.
+// If EMAIL_MX_CHECK is enabled, domains that can't receive mail are rejected
+func ValidateEmail(email string) *APIError {
+
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return NewInvalidFieldError("email", "Invalid email address")
+	}
+
+	domain := strings.ToLower(email[at+1:])
+	if isEmailDomainBlocked(domain) {
+		return NewInvalidFieldError("email", "Email domain is not allowed")
+	}
+	if emailMXCheck && !canReceiveMail(domain) {
+		return NewInvalidFieldError("email", "Email domain can't receive mail")
+	}
+	return nil
+}
+
+// canReceiveMail looks up the domain mail servers, domains without MX records fall back to the address records.
+// The check is best effort, lookup timeouts and server failures accept the domain
+func canReceiveMail(domain string) bool {
+
+	ctx, cancel := context.WithTimeout(context.Background(), emailMXTimeout)
+	defer cancel()
+
+	records, err := net.DefaultResolver.LookupMX(ctx, domain)
+	if err == nil {
+		// null MX record explicitly refuses mail
+		if len(records) == 1 && records[0].Host == "." {
+			return false
+		}
+		return len(records) > 0
+	}
+	if !isDNSNotFound(err) {
+		return true
+	}
+
+	_, err = net.DefaultResolver.LookupHost(ctx, domain)
+	return err == nil || !isDNSNotFound(err)
+}
+
+// isDNSNotFound returns true if the lookup failed because the name or records don't exist
+func isDNSNotFound(err error) bool {
+
+	var dnsError *net.DNSError
+	return errors.As(err, &dnsError) && dnsError.IsNotFound
+}
+
+// SetEmailDomainLists replaces the email domain lists, empty lists disable the check.
+// Entries are domains or wildcard patterns, e.g. "mailinator.com" or "*.mailinator.com".
+// Allowlist takes precedence, so "example.com" can be allowed while "*.com" is blocked
+func SetEmailDomainLists(blocklist, allowlist []string) {
+
+	emailDomainsMutex.Lock()
+	emailDomainsBlocklist = normalizeDomainPatterns(blocklist)
+	emailDomainsAllowlist = normalizeDomainPatterns(allowlist)
+	emailDomainsMutex.Unlock()
+}
+
+// ReadEmailDomainsFile reads domain patterns from the file, one per line, '#' starts a comment
+func ReadEmailDomainsFile(fileName string) ([]string, error) {
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	domains := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		domains = append(domains, line)
+	}
+	return domains, scanner.Err()
+}
+
+// isEmailDomainBlocked returns true if the domain matches the blocklist and doesn't match the allowlist
+func isEmailDomainBlocked(domain string) bool {
+
+	emailDomainsMutex.RLock()
+	defer emailDomainsMutex.RUnlock()
+
+	if matchesDomainPattern(domain, emailDomainsAllowlist) {
+		return false
+	}
+	return matchesDomainPattern(domain, emailDomainsBlocklist)
+}
+
+// matchesDomainPattern returns true if the domain matches any pattern
+func matchesDomainPattern(domain string, patterns []string) bool {
+
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, domain); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDomainPatterns trims and lowercases the patterns and skips empty ones
+func normalizeDomainPatterns(patterns []string) []string {
+
+	normalized := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if len(pattern) > 0 {
+			normalized = append(normalized, pattern)
+		}
+	}
+	return normalized
+}
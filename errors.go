@@ -1,8 +1,18 @@
 package cigExchange
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+
+	"github.com/lib/pq"
+)
+
+// postgresql error codes
+const (
+	pqUniqueViolationCode = "23505"
+	pqQueryCanceledCode   = "57014"
 )
 
 // NotFoundHandler returns an error when requested resourse / route is missing
@@ -20,8 +30,13 @@ const (
 	ErrorTypeBadRequest          = "Bad request"
 	ErrorTypeUnauthorized        = "Unauthorized"
 	ErrorTypeForbidden           = "Forbidden"
+	ErrorTypeNotFound            = "Not found"
+	ErrorTypeConflict            = "Conflict"
+	ErrorTypePayloadTooLarge     = "Payload too large"
 	ErrorTypeInternalServer      = "Internal server error"
 	ErrorTypeUnprocessableEntity = "Unprocessable Entity"
+	ErrorTypeTooManyRequests     = "Too many requests"
+	ErrorTypeServiceUnavailable  = "Service unavailable"
 )
 
 // nested API Error reasons
@@ -37,13 +52,21 @@ const (
 	ReasonFieldInvalid                = "Invalid field"
 	ReasonJSONFailure                 = "JSON decoding failure"
 	ReasonDatabaseFailure             = "Database error"
+	ReasonDatabaseTimeout             = "Database timeout"
 	ReasonUserActivityFailure         = "Record user activity error"
 	ReasonReadFailure                 = "Read request body error"
 	ReasonRedisFailure                = "Redis error"
 	ReasonTwilioFailure               = "Twilio error"
 	ReasonMandrillFailure             = "Mandrill error"
+	ReasonCaptchaFailure              = "Captcha provider error"
+	ReasonEncryptionFailure           = "Encryption error"
 	ReasonTokenGenerationFailure      = "JWT generation error"
 	ReasonRoutingFailure              = "Routing error"
+	ReasonTooManyAttempts             = "Too many attempts"
+	ReasonNotFound                    = "Resource not found"
+	ReasonPayloadTooLarge             = "Request body too large"
+	ReasonRequestInProgress           = "Request in progress"
+	ReasonHandlerPanic                = "Unexpected server failure"
 )
 
 // nested API Error messages
@@ -51,6 +74,7 @@ const (
 	MessageResponseJSONEncoding = "Response JSON encoding failed"
 	MessageRequestJSONDecoding  = "Request JSON parsing failed"
 	MessageJSONEncoding         = "JSON encoding failed"
+	MessageJSONDecoding         = "JSON decoding failed"
 )
 
 // APIError is a custom error type that gets reported to the client
@@ -81,6 +105,16 @@ func (e *APIError) NewNestedError(reason, message string) *NestedAPIError {
 	return nestedError
 }
 
+// AppendNestedErrors adds the nested errors of other to the error, nil is ignored.
+// Used to report all validation problems at once
+func (e *APIError) AppendNestedErrors(other *APIError) {
+
+	if other == nil {
+		return
+	}
+	e.Errors = append(e.Errors, other.Errors...)
+}
+
 // SetErrorType sets the top level error type and corresponding error code
 func (e *APIError) SetErrorType(errType string) {
 
@@ -93,10 +127,22 @@ func (e *APIError) SetErrorType(errType string) {
 		e.Code = 400
 	case ErrorTypeUnauthorized:
 		e.Code = 401
+	case ErrorTypeForbidden:
+		e.Code = 403
+	case ErrorTypeNotFound:
+		e.Code = 404
+	case ErrorTypeConflict:
+		e.Code = 409
+	case ErrorTypePayloadTooLarge:
+		e.Code = 413
 	case ErrorTypeUnprocessableEntity:
 		e.Code = 422
+	case ErrorTypeTooManyRequests:
+		e.Code = 429
 	case ErrorTypeInternalServer:
 		e.Code = 500
+	case ErrorTypeServiceUnavailable:
+		e.Code = 503
 	default:
 		// 500 is the default for any uncategorized errors
 		e.Code = 500
@@ -142,6 +188,28 @@ func (e *APIError) ToString() string {
 	return res
 }
 
+// IsUniqueViolation returns true if err is a postgresql unique constraint violation
+func IsUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == pqUniqueViolationCode
+}
+
+// IsUniqueConstraintViolation returns true if err is a postgresql unique violation of the constraint or unique index
+func IsUniqueConstraintViolation(err error, constraint string) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == pqUniqueViolationCode && pqErr.Constraint == constraint
+}
+
+// IsQueryTimeout returns true if err is a postgresql statement timeout or the query context deadline
+func IsQueryTimeout(err error) bool {
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == pqQueryCanceledCode
+}
+
 // Helper functions for creating specific errors
 
 // NewInternalServerError creates APIError with ErrorTypeInternalServer
@@ -155,9 +223,18 @@ func NewInternalServerError(reason, message string) *APIError {
 }
 
 // NewDatabaseError creates APIError with ErrorTypeInternalServer
-// and nested error with ReasonDatabaseFailure reason
+// and nested error with ReasonDatabaseFailure reason.
+// Query timeouts create APIError with ErrorTypeServiceUnavailable and ReasonDatabaseTimeout reason
 func NewDatabaseError(message string, err error) *APIError {
 	apiErr := &APIError{}
+
+	if IsQueryTimeout(err) {
+		apiErr.SetErrorType(ErrorTypeServiceUnavailable)
+		nesetedError := apiErr.NewNestedError(ReasonDatabaseTimeout, message+": query timed out")
+		nesetedError.OriginalError = err
+		return apiErr
+	}
+
 	apiErr.SetErrorType(ErrorTypeInternalServer)
 
 	nesetedError := apiErr.NewNestedError(ReasonDatabaseFailure, message)
@@ -167,8 +244,15 @@ func NewDatabaseError(message string, err error) *APIError {
 }
 
 // NewReadError creates APIError with ErrorTypeBadRequest
-// and nested error with ReasonReadFailure reason
+// and nested error with ReasonReadFailure reason.
+// Body exceeding the MaxBodyBytes limit is reported as ErrorTypePayloadTooLarge
 func NewReadError(message string, err error) *APIError {
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return NewPayloadTooLargeError(maxBytesErr.Limit)
+	}
+
 	apiErr := &APIError{}
 	apiErr.SetErrorType(ErrorTypeBadRequest)
 
@@ -202,6 +286,30 @@ func NewTwilioError(message string, err error) *APIError {
 	return apiErr
 }
 
+// NewCaptchaError creates APIError with ErrorTypeInternalServer
+// and nested error with ReasonCaptchaFailure reason
+func NewCaptchaError(message string, err error) *APIError {
+	apiErr := &APIError{}
+	apiErr.SetErrorType(ErrorTypeInternalServer)
+
+	nesetedError := apiErr.NewNestedError(ReasonCaptchaFailure, message)
+	nesetedError.OriginalError = err
+
+	return apiErr
+}
+
+// NewEncryptionError creates APIError with ErrorTypeInternalServer
+// and nested error with ReasonEncryptionFailure reason
+func NewEncryptionError(message string, err error) *APIError {
+	apiErr := &APIError{}
+	apiErr.SetErrorType(ErrorTypeInternalServer)
+
+	nesetedError := apiErr.NewNestedError(ReasonEncryptionFailure, message)
+	nesetedError.OriginalError = err
+
+	return apiErr
+}
+
 // NewTokenError creates APIError with ErrorTypeInternalServer
 // and nested error with ReasonTokenGenerationFailure reason
 func NewTokenError(message string, err error) *APIError {
@@ -235,6 +343,16 @@ func NewUserDoesntExistError(message string) *APIError {
 	return apiErr
 }
 
+// NewUserAlreadyExistsError creates APIError with ErrorTypeUnauthorized
+// and nested error with ReasonUserAlreadyExists reason
+// This error is silenced by default (not shown to the client by authAPI)
+func NewUserAlreadyExistsError(message string) *APIError {
+	apiErr := &APIError{}
+	apiErr.SetErrorType(ErrorTypeUnauthorized)
+	apiErr.NewNestedError(ReasonUserAlreadyExists, message)
+	return apiErr
+}
+
 // NewOrganisationDoesntExistError creates APIError with ErrorTypeBadRequest
 // and nested error with ReasonOrganisationDoesntExist reason
 func NewOrganisationDoesntExistError(message string) *APIError {
@@ -271,6 +389,44 @@ func NewAccessForbiddenError(message string) *APIError {
 	return apiErr
 }
 
+// NewNotFoundError creates APIError with ErrorTypeNotFound
+// and nested error with ReasonNotFound reason with filled message and field name
+func NewNotFoundError(fieldName, message string) *APIError {
+	apiErr := &APIError{}
+	apiErr.SetErrorType(ErrorTypeNotFound)
+
+	nesetedError := apiErr.NewNestedError(ReasonNotFound, message)
+	nesetedError.Field = fieldName
+	return apiErr
+}
+
+// NewTooManyRequestsError creates APIError with ErrorTypeTooManyRequests
+// and nested error with ReasonTooManyAttempts reason
+func NewTooManyRequestsError(message string) *APIError {
+	apiErr := &APIError{}
+	apiErr.SetErrorType(ErrorTypeTooManyRequests)
+	apiErr.NewNestedError(ReasonTooManyAttempts, message)
+	return apiErr
+}
+
+// NewRequestInProgressError creates APIError with ErrorTypeConflict
+// and nested error with ReasonRequestInProgress reason
+func NewRequestInProgressError(message string) *APIError {
+	apiErr := &APIError{}
+	apiErr.SetErrorType(ErrorTypeConflict)
+	apiErr.NewNestedError(ReasonRequestInProgress, message)
+	return apiErr
+}
+
+// NewPayloadTooLargeError creates APIError with ErrorTypePayloadTooLarge
+// and nested error with ReasonPayloadTooLarge reason
+func NewPayloadTooLargeError(limit int64) *APIError {
+	apiErr := &APIError{}
+	apiErr.SetErrorType(ErrorTypePayloadTooLarge)
+	apiErr.NewNestedError(ReasonPayloadTooLarge, fmt.Sprintf("Request body exceeds %d bytes", limit))
+	return apiErr
+}
+
 // NewRequiredFieldError creates APIError with ErrorTypeBadRequest
 // and nested error(s) with NestedErrorFieldMissing reason and filled field name
 func NewRequiredFieldError(fields []string) *APIError {
@@ -329,8 +485,15 @@ func NewJSONEncodingError(message string, err error) *APIError {
 }
 
 // NewRequestDecodingError creates APIError with ErrorTypeBadRequest
-// and nested error with NestedErrorJSONFailure reason
+// and nested error with NestedErrorJSONFailure reason.
+// Body exceeding the MaxBodyBytes limit is reported as ErrorTypePayloadTooLarge
 func NewRequestDecodingError(err error) *APIError {
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return NewPayloadTooLargeError(maxBytesErr.Limit)
+	}
+
 	apiErr := &APIError{}
 	apiErr.SetErrorType(ErrorTypeBadRequest)
 
@@ -0,0 +1,42 @@
+package cigExchange
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DomainEvent is a typed event of the user, organisation and offering lifecycle
+type DomainEvent struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	AggregateID string          `json:"aggregate_id"`
+	Payload     json.RawMessage `json:"payload"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+}
+
+// EventPublisher publishes domain events to the message broker (NATS, RabbitMQ).
+// Publishing is disabled by default, events are delivered from the outbox by models.RunEventRelay
+type EventPublisher interface {
+	Publish(event *DomainEvent) error
+}
+
+// nopEventPublisher discards all events
+type nopEventPublisher struct{}
+
+func (nopEventPublisher) Publish(*DomainEvent) error { return nil }
+
+var eventPublisher EventPublisher = nopEventPublisher{}
+
+// GetEventPublisher returns the event publisher singletone
+func GetEventPublisher() EventPublisher {
+	return eventPublisher
+}
+
+// SetEventPublisher enables events publishing, nil disables it
+func SetEventPublisher(p EventPublisher) {
+
+	if p == nil {
+		p = nopEventPublisher{}
+	}
+	eventPublisher = p
+}
@@ -0,0 +1,172 @@
+package cigExchange
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HeaderIdempotencyKey is the request header carrying the client generated idempotency key
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// maximum accepted length of the idempotency key header
+const maxIdempotencyKeyLength = 255
+
+// idempotencyLockExpiration limits the key lock if the call never finishes
+const idempotencyLockExpiration = time.Minute
+
+// idempotentResponse is a cached http response stored in redis
+type idempotentResponse struct {
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// responseRecorder writes the response to the client and keeps a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	if rec.statusCode == 0 {
+		rec.statusCode = statusCode
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.statusCode == 0 {
+		rec.statusCode = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// GetIdempotencyKey returns the redis key for the request Idempotency-Key header.
+// The key is bound to the user UUID (empty for public calls) and the request body hash,
+// so the same header value with another body or user doesn't replay the stored response.
+// suffix scopes the key to a single api call. Empty string is returned if the header is missing.
+// The body is read and replaced with a copy
+func GetIdempotencyKey(r *http.Request, userUUID, suffix string) (string, *APIError) {
+
+	headerKey := strings.TrimSpace(r.Header.Get(HeaderIdempotencyKey))
+	if len(headerKey) == 0 || len(headerKey) > maxIdempotencyKeyLength {
+		return "", nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", NewReadError("Failed to read request body", err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.New()
+	hash.Write([]byte(headerKey))
+	hash.Write([]byte{0})
+	hash.Write([]byte(userUUID))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return GenerateRedisKey(hex.EncodeToString(hash.Sum(nil)), suffix), nil
+}
+
+// isFinalResponse returns true for the responses stored for replay:
+// success and conflict responses. Rate limit, captcha and other client errors
+// depend on the moment of the call and the retry must be processed again
+func isFinalResponse(statusCode int) bool {
+	return (statusCode >= 200 && statusCode < 300) || statusCode == http.StatusConflict
+}
+
+// WithIdempotency calls fn and stores the written response in redis under key for ttl.
+// Replayed calls with the same key get the stored response and fn is not called.
+// The key is locked while fn runs, concurrent calls with the same key are rejected with 409.
+// Empty key disables the caching, only final responses (see isFinalResponse) are stored
+func WithIdempotency(key string, ttl time.Duration, w http.ResponseWriter, fn func(w http.ResponseWriter)) {
+
+	if len(key) == 0 {
+		fn(w)
+		return
+	}
+
+	// in-flight placeholder has no status code, it expires if the process dies before fn returns
+	placeholder, err := json.Marshal(&idempotentResponse{})
+	if err != nil {
+		RespondWithAPIError(w, NewJSONEncodingError(MessageJSONEncoding, err))
+		return
+	}
+	locked, err := GetStore().SetNX(key, string(placeholder), idempotencyLockExpiration)
+	if err != nil {
+		RespondWithAPIError(w, NewRedisError("Set idempotency lock failure", err))
+		return
+	}
+	if !locked {
+		replayIdempotentResponse(key, w)
+		return
+	}
+
+	rec := &responseRecorder{ResponseWriter: w}
+	fn(rec)
+
+	if !isFinalResponse(rec.statusCode) {
+		// release the lock so the call can be retried
+		if _, err := GetStore().Del(key); err != nil {
+			LogAPIError("Idempotency", NewRedisError("Del idempotency lock failure", err))
+		}
+		return
+	}
+
+	response := &idempotentResponse{
+		StatusCode:  rec.statusCode,
+		ContentType: rec.Header().Get("Content-Type"),
+		Body:        rec.body.Bytes(),
+	}
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		LogAPIError("Idempotency", NewJSONEncodingError(MessageJSONEncoding, err))
+		return
+	}
+
+	err = GetStore().Set(key, string(responseBytes), ttl)
+	if err != nil {
+		LogAPIError("Idempotency", NewRedisError("Set idempotent response failure", err))
+	}
+}
+
+// replayIdempotentResponse writes the stored response of the key,
+// 409 is returned while the first call is still in progress
+func replayIdempotentResponse(key string, w http.ResponseWriter) {
+
+	value, err := GetStore().Get(key)
+	if err != nil {
+		if err == ErrKeyNotFound {
+			// lock was released by the failed call in between
+			RespondWithAPIError(w, NewRequestInProgressError("Request with the same idempotency key is in progress, retry later"))
+			return
+		}
+		RespondWithAPIError(w, NewRedisError("Get idempotent response failure", err))
+		return
+	}
+
+	cached := &idempotentResponse{}
+	if err := json.Unmarshal([]byte(value), cached); err != nil {
+		Logger().Warn("Idempotency: can't parse cached response", "key", key, "error", err)
+		RespondWithAPIError(w, NewRedisError("Can't parse idempotent response", err))
+		return
+	}
+	if cached.StatusCode == 0 {
+		RespondWithAPIError(w, NewRequestInProgressError("Request with the same idempotency key is in progress, retry later"))
+		return
+	}
+
+	if len(cached.ContentType) > 0 {
+		w.Header().Set("Content-Type", cached.ContentType)
+	}
+	w.WriteHeader(cached.StatusCode)
+	w.Write(cached.Body)
+}
@@ -0,0 +1,106 @@
+package cigExchange
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newIdempotentRequest(headerKey, body string) *http.Request {
+
+	r := httptest.NewRequest(http.MethodPost, "/api/users/signup", strings.NewReader(body))
+	r.Header.Set(HeaderIdempotencyKey, headerKey)
+	return r
+}
+
+func idempotencyKey(t *testing.T, r *http.Request, userUUID string) string {
+
+	key, apiError := GetIdempotencyKey(r, userUUID, KeyIdempotencySignUp)
+	if apiError != nil {
+		t.Fatalf("unexpected error: %v", apiError.ToString())
+	}
+	return key
+}
+
+func TestGetIdempotencyKeyBinding(t *testing.T) {
+
+	r := newIdempotentRequest("abc", `{"name":"a"}`)
+	key := idempotencyKey(t, r, "")
+
+	// body is restored for the handler
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil || string(body) != `{"name":"a"}` {
+		t.Fatalf("request body not restored: %q %v", body, err)
+	}
+
+	if key == idempotencyKey(t, newIdempotentRequest("abc", `{"name":"b"}`), "") {
+		t.Error("different body must give different key")
+	}
+	if key == idempotencyKey(t, newIdempotentRequest("abc", `{"name":"a"}`), "user") {
+		t.Error("different user must give different key")
+	}
+	if key != idempotencyKey(t, newIdempotentRequest("abc", `{"name":"a"}`), "") {
+		t.Error("same request must give the same key")
+	}
+	if len(idempotencyKey(t, newIdempotentRequest("", `{}`), "")) != 0 {
+		t.Error("missing header must disable idempotency")
+	}
+}
+
+func TestWithIdempotency(t *testing.T) {
+
+	SetStore(NewMemoryStore())
+	defer SetStore(nil)
+
+	calls := 0
+	status := http.StatusCreated
+	handler := func(w http.ResponseWriter) {
+		calls++
+		w.WriteHeader(status)
+		w.Write([]byte("response"))
+	}
+
+	// final response is replayed without calling the handler
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		WithIdempotency("created", time.Hour, rec, handler)
+		if rec.Code != http.StatusCreated || rec.Body.String() != "response" {
+			t.Fatalf("unexpected response %v %q", rec.Code, rec.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler called %v times, expected 1", calls)
+	}
+
+	// rate limited response isn't stored, retry calls the handler again
+	calls = 0
+	status = http.StatusTooManyRequests
+	for i := 0; i < 2; i++ {
+		WithIdempotency("limited", time.Hour, httptest.NewRecorder(), handler)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %v times, expected 2", calls)
+	}
+}
+
+func TestWithIdempotencyInFlight(t *testing.T) {
+
+	SetStore(NewMemoryStore())
+	defer SetStore(nil)
+
+	WithIdempotency("key", time.Hour, httptest.NewRecorder(), func(w http.ResponseWriter) {
+
+		// concurrent call with the same key while the first one runs
+		rec := httptest.NewRecorder()
+		WithIdempotency("key", time.Hour, rec, func(w http.ResponseWriter) {
+			t.Error("handler must not run while the key is locked")
+		})
+		if rec.Code != http.StatusConflict {
+			t.Errorf("expected 409, got %v", rec.Code)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
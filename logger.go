@@ -0,0 +1,79 @@
+package cigExchange
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// structured logger, LOG_LEVEL is applied in init after loading .env
+var logger = newJSONLogger(os.Stdout, "")
+
+// newJSONLogger creates structured JSON logger with the level name (debug, info, warn, error), info is the default
+func newJSONLogger(w io.Writer, levelName string) *slog.Logger {
+
+	level := slog.LevelInfo
+	switch strings.ToLower(strings.TrimSpace(levelName)) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// Logger returns the structured logger singletone
+func Logger() *slog.Logger {
+	return logger
+}
+
+// SetLogger replaces the structured logger, nil disables logging
+func SetLogger(l *slog.Logger) {
+
+	if l == nil {
+		l = NewNopLogger()
+	}
+	logger = l
+}
+
+// NewNopLogger returns logger that discards all records, used in tests
+func NewNopLogger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(io.Discard, nil))
+}
+
+// LogAPIError logs api error with the type, code and nested errors as structured fields
+func LogAPIError(message string, apiError *APIError) {
+
+	if apiError == nil {
+		return
+	}
+
+	reasons := make([]string, 0, len(apiError.Errors))
+	details := make([]string, 0, len(apiError.Errors))
+	for _, nested := range apiError.Errors {
+		reasons = append(reasons, nested.Reason)
+		detail := nested.Message
+		if len(nested.Field) > 0 {
+			detail += " [" + nested.Field + "]"
+		}
+		if nested.OriginalError != nil {
+			detail += " " + nested.OriginalError.Error()
+		}
+		details = append(details, detail)
+	}
+
+	level := slog.LevelWarn
+	if apiError.Code >= 500 {
+		level = slog.LevelError
+	}
+	logger.Log(context.Background(), level, message,
+		slog.String("type", apiError.Type),
+		slog.Int("code", apiError.Code),
+		slog.Any("reasons", reasons),
+		slog.Any("details", details),
+	)
+}
@@ -0,0 +1,93 @@
+package cigExchange
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Constants defining the metrics outcome label
+const (
+	MetricOutcomeSuccess = "success"
+	MetricOutcomeFailure = "failure"
+)
+
+// Metrics records auth and database metrics.
+// Metrics are disabled by default, cig-exchange-libs/metrics provides the Prometheus implementation
+type Metrics interface {
+	SignUp(outcome string)
+	SignIn(method, outcome string)
+	OTPSent(channel, outcome string)
+	OTPVerified(channel, outcome string)
+	JWTValidated(outcome string)
+	DBQuery(operation string, duration time.Duration)
+}
+
+// nopMetrics discards all metrics
+type nopMetrics struct{}
+
+func (nopMetrics) SignUp(string)                 {}
+func (nopMetrics) SignIn(string, string)         {}
+func (nopMetrics) OTPSent(string, string)        {}
+func (nopMetrics) OTPVerified(string, string)    {}
+func (nopMetrics) JWTValidated(string)           {}
+func (nopMetrics) DBQuery(string, time.Duration) {}
+
+var metrics Metrics = nopMetrics{}
+
+// GetMetrics returns the metrics recorder singletone
+func GetMetrics() Metrics {
+	return metrics
+}
+
+// SetMetrics enables metrics recording, nil disables it
+func SetMetrics(m Metrics) {
+
+	if m == nil {
+		m = nopMetrics{}
+	}
+	metrics = m
+}
+
+// MetricOutcome returns the outcome label for the api error
+func MetricOutcome(apiError *APIError) string {
+
+	if apiError != nil {
+		return MetricOutcomeFailure
+	}
+	return MetricOutcomeSuccess
+}
+
+// metrics scope key of the query start time
+const metricsStartKey = "cig:metrics_start"
+
+// registerDBMetricsCallbacks registers gorm callbacks measuring query durations by operation
+func registerDBMetricsCallbacks(db *gorm.DB) {
+
+	before := func(scope *gorm.Scope) {
+		scope.InstanceSet(metricsStartKey, time.Now())
+	}
+	after := func(operation string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			start, ok := scope.InstanceGet(metricsStartKey)
+			if !ok {
+				return
+			}
+			if startTime, ok := start.(time.Time); ok {
+				GetMetrics().DBQuery(operation, time.Since(startTime))
+			}
+		}
+	}
+
+	callback := db.Callback()
+	callback.Create().Before("gorm:create").Register("cig:metrics_before_create", before)
+	callback.Create().After("gorm:create").Register("cig:metrics_after_create", after("create"))
+	callback.Query().Before("gorm:query").Register("cig:metrics_before_query", before)
+	callback.Query().After("gorm:query").Register("cig:metrics_after_query", after("query"))
+	callback.Update().Before("gorm:update").Register("cig:metrics_before_update", before)
+	callback.Update().After("gorm:update").Register("cig:metrics_after_update", after("update"))
+	callback.Delete().Before("gorm:delete").Register("cig:metrics_before_delete", before)
+	callback.Delete().After("gorm:delete").Register("cig:metrics_after_delete", after("delete"))
+	callback.RowQuery().Before("gorm:row_query").Register("cig:metrics_before_row_query", before)
+	callback.RowQuery().After("gorm:row_query").Register("cig:metrics_after_row_query", after("row_query"))
+}
@@ -0,0 +1,109 @@
+// Package metrics provides the Prometheus implementation of cigExchange.Metrics.
+// Importers that don't need metrics don't import the package and Prometheus
+package metrics
+
+import (
+	cigExchange "cig-exchange-libs"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace of all cig-exchange metrics
+const namespace = "cig_exchange"
+
+// Prometheus records cig-exchange-libs metrics with Prometheus collectors
+type Prometheus struct {
+	signUps         *prometheus.CounterVec
+	signIns         *prometheus.CounterVec
+	otpSent         *prometheus.CounterVec
+	otpVerified     *prometheus.CounterVec
+	jwtValidations  *prometheus.CounterVec
+	dbQueryDuration *prometheus.HistogramVec
+}
+
+// NewPrometheus creates Prometheus metrics and registers collectors in the registerer
+func NewPrometheus(registerer prometheus.Registerer) *Prometheus {
+
+	p := &Prometheus{
+		signUps: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signups_total",
+			Help:      "User signups by outcome.",
+		}, []string{"outcome"}),
+		signIns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signins_total",
+			Help:      "User signins by method and outcome.",
+		}, []string{"method", "outcome"}),
+		otpSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "otp_sent_total",
+			Help:      "OTP codes sent by channel and outcome.",
+		}, []string{"channel", "outcome"}),
+		otpVerified: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "otp_verified_total",
+			Help:      "OTP code verifications by channel and outcome.",
+		}, []string{"channel", "outcome"}),
+		jwtValidations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jwt_validations_total",
+			Help:      "JWT validations by outcome.",
+		}, []string{"outcome"}),
+		dbQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Database query durations by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+	}
+
+	registerer.MustRegister(p.signUps, p.signIns, p.otpSent, p.otpVerified, p.jwtValidations, p.dbQueryDuration)
+	return p
+}
+
+// Enable creates Prometheus metrics registered in the default registerer and enables metrics recording
+func Enable() *Prometheus {
+
+	p := NewPrometheus(prometheus.DefaultRegisterer)
+	cigExchange.SetMetrics(p)
+	return p
+}
+
+// MetricsHandler returns http handler exposing metrics of the default registry
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// SignUp records user signup
+func (p *Prometheus) SignUp(outcome string) {
+	p.signUps.WithLabelValues(outcome).Inc()
+}
+
+// SignIn records user signin
+func (p *Prometheus) SignIn(method, outcome string) {
+	p.signIns.WithLabelValues(method, outcome).Inc()
+}
+
+// OTPSent records OTP code sending
+func (p *Prometheus) OTPSent(channel, outcome string) {
+	p.otpSent.WithLabelValues(channel, outcome).Inc()
+}
+
+// OTPVerified records OTP code verification
+func (p *Prometheus) OTPVerified(channel, outcome string) {
+	p.otpVerified.WithLabelValues(channel, outcome).Inc()
+}
+
+// JWTValidated records JWT validation
+func (p *Prometheus) JWTValidated(outcome string) {
+	p.jwtValidations.WithLabelValues(outcome).Inc()
+}
+
+// DBQuery records database query duration
+func (p *Prometheus) DBQuery(operation string, duration time.Duration) {
+	p.dbQueryDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
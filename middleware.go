@@ -0,0 +1,165 @@
+package cigExchange
+
+import (
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxBodyBytes is the request body limit used by MaxBodyBytes when no limit is set
+const DefaultMaxBodyBytes = 1 << 20
+
+// MaxBodyBytes returns middleware limiting the request body size, limit <= 0 uses DefaultMaxBodyBytes.
+// Bodies with larger Content-Length are rejected with 413, reading past the limit fails the request decoding
+func MaxBodyBytes(limit int64) func(http.Handler) http.Handler {
+
+	if limit <= 0 {
+		limit = DefaultMaxBodyBytes
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			if r.ContentLength > limit {
+				apiError := NewPayloadTooLargeError(limit)
+				LogAPIError("MaxBodyBytes: request rejected", apiError)
+				RespondWithAPIError(w, apiError)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IPRateLimit returns middleware allowing up to limit requests per client IP in a fixed window,
+// requests above the limit are rejected with 429. Counters are kept in the Store per name,
+// use the same name to share the limit between routes. Store failures don't block requests
+func IPRateLimit(name string, limit int64, window time.Duration) func(http.Handler) http.Handler {
+
+	retryAfter := strconv.Itoa(int(window.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			rediskey := GenerateRedisKey(name+"|"+ClientIP(r), KeyIPRateLimit)
+			// window starts with the first request
+			count, err := GetStore().IncrWithExpire(rediskey, window)
+			if err != nil {
+				LogAPIError("IPRateLimit", NewRedisError("Increment ip rate limit failure", err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if count > limit {
+				apiError := NewTooManyRequestsError("Too many requests, try again later")
+				LogAPIError("IPRateLimit: request rejected", apiError)
+				w.Header().Set("Retry-After", retryAfter)
+				RespondWithAPIError(w, apiError)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CheckJSONContentType returns error if the request has a body and the content type is not application/json.
+// Requests without body (GET, DELETE, empty POST) are allowed with any content type
+func CheckJSONContentType(r *http.Request) *APIError {
+
+	if r.ContentLength == 0 || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return NewInvalidFieldError("content-type", "Content type must be application/json")
+	}
+	return nil
+}
+
+// RequireJSONContentType returns middleware rejecting requests with non JSON body, see CheckJSONContentType
+func RequireJSONContentType(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if apiError := CheckJSONContentType(r); apiError != nil {
+			LogAPIError("RequireJSONContentType: request rejected", apiError)
+			RespondWithAPIError(w, apiError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CORSOptions configures CORSHandler.
+// Zero value allows no cross-origin requests
+type CORSOptions struct {
+	// AllowedOrigins lists the allowed origins, "*" allows any origin without credentials
+	AllowedOrigins []string
+	// AllowedMethods defaults to GET, POST, PATCH, DELETE
+	AllowedMethods []string
+	// AllowedHeaders defaults to Authorization, Content-Type, Idempotency-Key
+	AllowedHeaders []string
+	// AllowCredentials allows cookies and auth headers for the listed origins
+	AllowCredentials bool
+	// MaxAge is the preflight response cache duration, zero omits the header
+	MaxAge time.Duration
+}
+
+// CORSHandler returns middleware adding CORS headers for the allowed origins and answering preflight requests.
+// Wrap the whole router rather than using router.Use, mux doesn't run middlewares for unmatched OPTIONS routes
+func CORSHandler(options CORSOptions) func(http.Handler) http.Handler {
+
+	methods := options.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete}
+	}
+	headers := options.AllowedHeaders
+	if len(headers) == 0 {
+		headers = []string{"Authorization", "Content-Type", "Idempotency-Key"}
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+	anyOrigin := slices.Contains(options.AllowedOrigins, "*")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0
+
+			w.Header().Add("Vary", "Origin")
+			allowed := len(origin) > 0 && (anyOrigin || slices.Contains(options.AllowedOrigins, origin))
+			if allowed {
+				if anyOrigin && !options.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				} else {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+				}
+				if options.AllowCredentials && !anyOrigin {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if !preflight {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// preflight is answered here, disallowed origin gets no CORS headers and is blocked by the browser
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+				if options.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(options.MaxAge.Seconds())))
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
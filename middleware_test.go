@@ -0,0 +1,101 @@
+package cigExchange
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIPRateLimitBurst(t *testing.T) {
+
+	memoryStore := NewMemoryStore()
+	SetStore(memoryStore)
+	defer SetStore(nil)
+
+	const limit = 5
+	const burst = 50
+
+	handler := IPRateLimit("burst", limit, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+
+	var passed, rejected int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < burst; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodPost, "/api/users/signin", nil)
+			r.RemoteAddr = "203.0.113.1:1234"
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			switch w.Code {
+			case 204:
+				atomic.AddInt64(&passed, 1)
+			case http.StatusTooManyRequests:
+				atomic.AddInt64(&rejected, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if passed != limit || rejected != burst-limit {
+		t.Fatalf("expected %d passed and %d rejected, got %d and %d", limit, burst-limit, passed, rejected)
+	}
+
+	// counter created by the burst expires with the window
+	rediskey := GenerateRedisKey("burst|203.0.113.1", KeyIPRateLimit)
+	item, ok := memoryStore.items[rediskey]
+	if !ok || item.expiresAt.IsZero() {
+		t.Fatal("rate limit counter has no expiration")
+	}
+}
+
+func TestMaxBodyBytesOversizedBody(t *testing.T) {
+
+	const limit = 64
+
+	handled := false
+	handler := MaxBodyBytes(limit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled = true
+		body := make(map[string]interface{})
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			RespondWithAPIError(w, NewRequestDecodingError(err))
+			return
+		}
+		w.WriteHeader(204)
+	}))
+
+	oversized := `{"name":"` + strings.Repeat("a", limit) + `"}`
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		expected      int
+		handled       bool
+	}{
+		{"small body", `{"name":"a"}`, 12, 204, true},
+		{"content length", oversized, int64(len(oversized)), http.StatusRequestEntityTooLarge, false},
+		// chunked body is cut while decoding
+		{"unknown length", oversized, -1, http.StatusRequestEntityTooLarge, true},
+	}
+
+	for _, test := range tests {
+		handled = false
+		r := httptest.NewRequest(http.MethodPost, "/api/users/signup", strings.NewReader(test.body))
+		r.ContentLength = test.contentLength
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d %s", test.name, test.expected, w.Code, w.Body.String())
+		}
+		if handled != test.handled {
+			t.Errorf("%s: expected handled %v, got %v", test.name, test.handled, handled)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	cigExchange "cig-exchange-libs"
+	"context"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -20,12 +21,16 @@ const (
 	ActivityTypeAllOfferings          = "get_all_offerings"
 	ActivityTypeContactUs             = "contact_us"
 	ActivityTypeSwitchOrganisation    = "switch"
+	ActivityTypeSetHomeOrganisation   = "set_home_org"
+	ActivityTypeRefreshToken          = "refresh_token"
 	ActivityTypeUpdateUser            = "update_user"
 	ActivityTypeGetUser               = "get_user"
 	ActivityTypeGetUserContacts       = "get_user_contacts"
 	ActivityTypeCreateUserContact     = "create_user_contact"
 	ActivityTypeUpdateUserContact     = "update_user_contact"
 	ActivityTypeDeleteUserContact     = "delete_user_contact"
+	ActivityTypeGetUserSessions       = "get_user_sessions"
+	ActivityTypeDeleteUserSession     = "delete_user_session"
 	ActivityTypeCreateOrganisation    = "create_org"
 	ActivityTypeGetOrganisations      = "get_orgs"
 	ActivityTypeGetOrganisation       = "get_org"
@@ -57,6 +62,9 @@ const (
 	ActivityTypeOrderingMedia         = "ordering_media"
 	ActivityTypeUpdateOfferingsMedia  = "update_offerings_media"
 	ActivityTypeDeleteOfferingsMedia  = "delete_offerings_media"
+	ActivityTypePanic                 = "panic"
+	ActivityTypeEnableTOTP            = "enable_totp"
+	ActivityTypeConfirmTOTP           = "confirm_totp"
 )
 
 // UnknownUser user for trading api calls
@@ -86,12 +94,35 @@ func (*UserActivity) BeforeCreate(scope *gorm.Scope) error {
 	return nil
 }
 
+// HardDelete permanently removes the user activity from db
+func (activity *UserActivity) HardDelete() *cigExchange.APIError {
+
+	// check that UUID is set
+	if len(activity.ID) == 0 {
+		return cigExchange.NewInvalidFieldError("activity_id", "User activity id is invalid")
+	}
+
+	db := cigExchange.GetDB().Unscoped().Delete(activity)
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Failed to delete user activity", db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return cigExchange.NewInvalidFieldError("activity_id", "User activity with provided id doesn't exist")
+	}
+	return nil
+}
+
 // GetActivitiesForUser queries all user activities for user from db
 func GetActivitiesForUser(userID string) (userActs []*UserActivity, apiErr *cigExchange.APIError) {
+	return GetActivitiesForUserCtx(context.Background(), userID)
+}
+
+// GetActivitiesForUserCtx queries all user activities for user from db with the context
+func GetActivitiesForUserCtx(ctx context.Context, userID string) (userActs []*UserActivity, apiErr *cigExchange.APIError) {
 
 	userActs = make([]*UserActivity, 0)
 	// find all userActivities objects for organisation
-	db := cigExchange.GetDB().Where(&UserActivity{UserID: userID}).Find(&userActs)
+	db := cigExchange.GetDBWithContext(ctx).Where(&UserActivity{UserID: userID}).Find(&userActs)
 	if db.Error != nil {
 		if !db.RecordNotFound() {
 			apiErr = cigExchange.NewDatabaseError("UserActivity lookup failed", db.Error)
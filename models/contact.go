@@ -2,6 +2,8 @@ package models
 
 import (
 	cigExchange "cig-exchange-libs"
+	"context"
+	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -21,20 +23,23 @@ const (
 
 // Contact is a struct to represent a contact
 type Contact struct {
-	ID        string     `json:"id" gorm:"column:id;primary_key"`
-	Level     string     `json:"level" gorm:"column:level"`
-	Location  string     `json:"location" gorm:"column:location"`
-	Type      string     `json:"type" gorm:"column:type"`
-	Subtype   string     `json:"subtype" gorm:"column:subtype"`
-	Value1    string     `json:"value1" gorm:"column:value1"`
-	Value2    string     `json:"value2" gorm:"column:value2"`
-	Value3    string     `json:"value3" gorm:"column:value3"`
-	Value4    string     `json:"value4" gorm:"column:value4"`
-	Value5    string     `json:"value5" gorm:"column:value5"`
-	Value6    string     `json:"value6" gorm:"column:value6"`
-	CreatedAt time.Time  `json:"created_at" gorm:"column:created_at"`
-	UpdatedAt time.Time  `json:"updated_at" gorm:"column:updated_at"`
-	DeletedAt *time.Time `json:"-" gorm:"column:deleted_at"`
+	ID         string     `json:"id" gorm:"column:id;primary_key"`
+	Level      string     `json:"level" gorm:"column:level"`
+	Location   string     `json:"location" gorm:"column:location"`
+	Type       string     `json:"type" gorm:"column:type"`
+	Subtype    string     `json:"subtype" gorm:"column:subtype"`
+	Value1     string     `json:"value1" gorm:"column:value1"`
+	Value2     string     `json:"value2" gorm:"column:value2"`
+	Value3     string     `json:"value3" gorm:"column:value3"`
+	Value4     string     `json:"value4" gorm:"column:value4"`
+	Value5     string     `json:"value5" gorm:"column:value5"`
+	Value6     string     `json:"value6" gorm:"column:value6"`
+	EmailHash  string     `json:"-" gorm:"column:email_hash"`
+	PhoneHash  string     `json:"-" gorm:"column:phone_hash"`
+	VerifiedAt *time.Time `json:"verified_at" gorm:"column:verified_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"column:created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" gorm:"column:updated_at"`
+	DeletedAt  *time.Time `json:"-" gorm:"column:deleted_at"`
 }
 
 // TableName returns table name for struct
@@ -49,12 +54,345 @@ func (*Contact) BeforeCreate(scope *gorm.Scope) error {
 	return nil
 }
 
+// BeforeSave sets the blind index of email and phone contacts and encrypts value1 and value2
+// if the contact encryption is enabled, see cigExchange.IsEncryptionEnabled.
+// The index is not set if BLIND_INDEX_KEY is missing. Partial updates without value1 and value2 keep the stored values
+func (contact *Contact) BeforeSave(scope *gorm.Scope) error {
+
+	columns := []string{"value1", "value2"}
+	if attrs, ok := scope.InstanceGet("gorm:update_attrs"); ok {
+		updateAttrs := attrs.(map[string]interface{})
+		columns = make([]string, 0, 2)
+		for _, column := range []string{"value1", "value2"} {
+			if _, ok := updateAttrs[column]; ok {
+				columns = append(columns, column)
+			}
+		}
+		if len(columns) == 0 {
+			return nil
+		}
+	}
+
+	hashColumn, hash, err := contact.blindIndex()
+	if err != nil && err != cigExchange.ErrBlindIndexKeyMissing {
+		return err
+	}
+	if err == nil && len(hashColumn) > 0 {
+		if err := scope.SetColumn(hashColumn, hash); err != nil {
+			return err
+		}
+	}
+
+	values := map[string]string{"value1": contact.Value1, "value2": contact.Value2}
+	for _, column := range columns {
+		encrypted, err := encryptContactValue(values[column])
+		if err != nil {
+			return err
+		}
+		if err := scope.SetColumn(column, encrypted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AfterSave restores the plaintext values encrypted by BeforeSave
+func (contact *Contact) AfterSave() error {
+	return contact.decryptValues()
+}
+
+// AfterFind decrypts value1 and value2
+func (contact *Contact) AfterFind() error {
+	return contact.decryptValues()
+}
+
+// decryptValues decrypts value1 and value2, plaintext values are kept as is
+func (contact *Contact) decryptValues() error {
+
+	for _, value := range []*string{&contact.Value1, &contact.Value2} {
+		var plaintext cigExchange.EncryptedString
+		if err := plaintext.Scan(*value); err != nil {
+			return err
+		}
+		*value = string(plaintext)
+	}
+	return nil
+}
+
+// encryptContactValue returns the db value of value1 or value2,
+// values are stored in plaintext if the contact encryption is disabled
+func encryptContactValue(value string) (string, error) {
+
+	if !cigExchange.IsEncryptionEnabled() || cigExchange.IsEncryptedValue(value) {
+		return value, nil
+	}
+	encrypted, err := cigExchange.EncryptedString(value).Value()
+	if err != nil {
+		return "", err
+	}
+	return encrypted.(string), nil
+}
+
+// blindIndex returns the blind index column and value of the contact,
+// email_hash of email contacts and phone_hash of phone contacts. Other types have no index
+func (contact *Contact) blindIndex() (string, string, error) {
+
+	switch contact.Type {
+	case ContactTypeEmail:
+		hash, err := contactEmailHash(contact.Value1)
+		return "email_hash", hash, err
+	case ContactTypePhone:
+		hash, err := contactPhoneHash(contact.Value1, contact.Value2)
+		return "phone_hash", hash, err
+	}
+	return "", "", nil
+}
+
+// contactEmailHash returns the email blind index stored in email_hash
+func contactEmailHash(email string) (string, error) {
+	return cigExchange.BlindIndex(strings.TrimSpace(email))
+}
+
+// contactPhoneHash returns the phone blind index stored in phone_hash
+func contactPhoneHash(code, number string) (string, error) {
+	return cigExchange.BlindIndex(strings.TrimSpace(code) + " " + strings.TrimSpace(number))
+}
+
+// whereContactEmail filters contacts by the email blind index.
+// Contacts without the index (BLIND_INDEX_KEY is missing or the contact isn't backfilled yet) are matched by value1
+func whereContactEmail(db *gorm.DB, email string) *gorm.DB {
+
+	hash, err := contactEmailHash(email)
+	if err != nil {
+		return db.Where("value1 = ?", email)
+	}
+	return db.Where("(email_hash = ? OR (COALESCE(email_hash, '') = '' AND value1 = ?))", hash, email)
+}
+
+// whereContactPhone filters phone contacts by the phone blind index,
+// contacts without the index are matched by value1 and value2 like in whereContactEmail
+func whereContactPhone(db *gorm.DB, code, number string) *gorm.DB {
+
+	db = db.Where("type = ?", ContactTypePhone)
+	hash, err := contactPhoneHash(code, number)
+	if err != nil {
+		return db.Where("value1 = ? AND value2 = ?", code, number)
+	}
+	return db.Where("(phone_hash = ? OR (COALESCE(phone_hash, '') = '' AND value1 = ? AND value2 = ?))", hash, code, number)
+}
+
 // GetMultilangFields returns jsonb fields
 func (*Contact) GetMultilangFields() []string {
 
 	return []string{}
 }
 
+// IsVerified returns true if the contact was verified with OTP
+func (contact *Contact) IsVerified() bool {
+	return contact.VerifiedAt != nil
+}
+
+// MarkVerified sets the contact verification time in db
+func (contact *Contact) MarkVerified() *cigExchange.APIError {
+
+	// check that UUID is set
+	if len(contact.ID) == 0 {
+		return cigExchange.NewInvalidFieldError("contact_id", "Contact id is invalid")
+	}
+
+	// contact is already verified
+	if contact.IsVerified() {
+		return nil
+	}
+
+	now := time.Now()
+	db := cigExchange.GetDB().Model(contact).Update("verified_at", now)
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Failed to mark contact verified", db.Error)
+	}
+	contact.VerifiedAt = &now
+	return nil
+}
+
+// MarkActiveUsersLoginContactsVerified marks login emails of all active users as verified.
+// Used to migrate the contacts created before the verification status was introduced.
+// Login phones may never have been checked with OTP, they stay unverified until the next phone verification
+func MarkActiveUsersLoginContactsVerified() *cigExchange.APIError {
+
+	query := `UPDATE public.contact SET verified_at = now()
+		WHERE verified_at IS NULL AND deleted_at IS NULL AND type = ? AND id IN (
+			SELECT login_email FROM public.user WHERE status = ? AND deleted_at IS NULL AND login_email IS NOT NULL
+		);`
+	db := cigExchange.GetDB().Exec(query, ContactTypeEmail, UserStatusVerified)
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Failed to mark login contacts verified", db.Error)
+	}
+	return nil
+}
+
+// CreateContactIndexes creates the contact table indexes.
+// Email contacts are unique among not deleted contacts, existing duplicates fail the migration
+func CreateContactIndexes() *cigExchange.APIError {
+
+	apiError := checkUniqueIndexDuplicates("contact", "value1", "type = 'email' AND deleted_at IS NULL")
+	if apiError != nil {
+		return apiError
+	}
+
+	query := `CREATE UNIQUE INDEX IF NOT EXISTS contact_email_unique_idx ON public.contact (value1)
+		WHERE type = 'email' AND deleted_at IS NULL;`
+	db := cigExchange.GetDB().Exec(query)
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Failed to create contact email index", db.Error)
+	}
+	return nil
+}
+
+// CreateContactPhoneIndexes creates the phone contact lookup index
+func CreateContactPhoneIndexes() *cigExchange.APIError {
+
+	query := `CREATE INDEX IF NOT EXISTS contact_phone_idx ON public.contact (value1, value2)
+		WHERE type = 'phone' AND deleted_at IS NULL;`
+	db := cigExchange.GetDB().Exec(query)
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Failed to create contact phone index", db.Error)
+	}
+	return nil
+}
+
+// NormalizePhoneContacts converts stored phone contacts to the canonical form, see cigExchange.NormalizePhone.
+// Contacts with invalid numbers are left unchanged
+func NormalizePhoneContacts() *cigExchange.APIError {
+
+	contacts := make([]*Contact, 0)
+	db := cigExchange.GetDB().Where("type = ?", ContactTypePhone).Find(&contacts)
+	if db.Error != nil && !db.RecordNotFound() {
+		return cigExchange.NewDatabaseError("Fetch phone contacts failed", db.Error)
+	}
+
+	for _, contact := range contacts {
+		code, number, apiError := cigExchange.NormalizePhone(contact.Value1, contact.Value2)
+		if apiError != nil {
+			cigExchange.Logger().Warn("NormalizePhoneContacts: invalid phone number", "contact_id", contact.ID)
+			continue
+		}
+		if code == contact.Value1 && number == contact.Value2 {
+			continue
+		}
+		update := map[string]interface{}{
+			"value1": code,
+			"value2": number,
+		}
+		if err := cigExchange.GetDB().Model(contact).Updates(update).Error; err != nil {
+			return cigExchange.NewDatabaseError("Failed to normalize phone contact", err)
+		}
+	}
+	return nil
+}
+
+// CreateContactEmailHashIndexes creates the email blind index lookup index
+func CreateContactEmailHashIndexes() *cigExchange.APIError {
+
+	query := `CREATE INDEX IF NOT EXISTS contact_email_hash_idx ON public.contact (email_hash)
+		WHERE type = 'email' AND deleted_at IS NULL;`
+	db := cigExchange.GetDB().Exec(query)
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Failed to create contact email hash index", db.Error)
+	}
+	return nil
+}
+
+// BackfillContactEmailHashes sets the email blind index of the email contacts created without it.
+// Nothing is done if BLIND_INDEX_KEY is missing, run it again once the key is set
+func BackfillContactEmailHashes() *cigExchange.APIError {
+
+	if _, err := contactEmailHash(""); err != nil {
+		cigExchange.Logger().Warn("BackfillContactEmailHashes: BLIND_INDEX_KEY is not set, skipped")
+		return nil
+	}
+
+	contacts := make([]*Contact, 0)
+	db := cigExchange.GetDB().Unscoped().Where("type = ? AND COALESCE(email_hash, '') = ''", ContactTypeEmail).Find(&contacts)
+	if db.Error != nil && !db.RecordNotFound() {
+		return cigExchange.NewDatabaseError("Fetch email contacts failed", db.Error)
+	}
+
+	for _, contact := range contacts {
+		hash, err := contactEmailHash(contact.Value1)
+		if err != nil {
+			return cigExchange.NewEncryptionError("Email hash failed", err)
+		}
+		err = cigExchange.GetDB().Model(contact).UpdateColumn("email_hash", hash).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Failed to update contact email hash", err)
+		}
+	}
+	return nil
+}
+
+// CreateContactHashIndexes creates the phone blind index lookup index and makes the email blind index unique.
+// Encrypted emails can't be checked by the value1 unique index
+func CreateContactHashIndexes() *cigExchange.APIError {
+
+	apiError := checkUniqueIndexDuplicates("contact", "email_hash", "type = 'email' AND deleted_at IS NULL AND COALESCE(email_hash, '') <> ''")
+	if apiError != nil {
+		return apiError
+	}
+
+	query := `CREATE INDEX IF NOT EXISTS contact_phone_hash_idx ON public.contact (phone_hash)
+		WHERE type = 'phone' AND deleted_at IS NULL;
+		CREATE UNIQUE INDEX IF NOT EXISTS contact_email_hash_unique_idx ON public.contact (email_hash)
+		WHERE type = 'email' AND deleted_at IS NULL AND COALESCE(email_hash, '') <> '';`
+	db := cigExchange.GetDB().Exec(query)
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Failed to create contact hash indexes", db.Error)
+	}
+	return nil
+}
+
+// EncryptContactValues encrypts value1 and value2 of the contacts stored in plaintext and sets their blind index.
+// Nothing is done unless the contact encryption is enabled, run it again once the keys are set
+func EncryptContactValues() *cigExchange.APIError {
+
+	if !cigExchange.IsEncryptionEnabled() {
+		cigExchange.Logger().Warn("EncryptContactValues: ENCRYPTION_KEY or BLIND_INDEX_KEY is not set, skipped")
+		return nil
+	}
+
+	contacts := make([]*Contact, 0)
+	db := cigExchange.GetDB().Unscoped().
+		Where("(COALESCE(value1, '') <> '' AND value1 NOT LIKE ?) OR (COALESCE(value2, '') <> '' AND value2 NOT LIKE ?)", "enc:%", "enc:%").
+		Find(&contacts)
+	if db.Error != nil && !db.RecordNotFound() {
+		return cigExchange.NewDatabaseError("Fetch plaintext contacts failed", db.Error)
+	}
+
+	for _, contact := range contacts {
+		update := make(map[string]interface{})
+		hashColumn, hash, err := contact.blindIndex()
+		if err != nil {
+			return cigExchange.NewEncryptionError("Contact hash failed", err)
+		}
+		if len(hashColumn) > 0 {
+			update[hashColumn] = hash
+		}
+		for column, value := range map[string]string{"value1": contact.Value1, "value2": contact.Value2} {
+			encrypted, err := encryptContactValue(value)
+			if err != nil {
+				return cigExchange.NewEncryptionError("Contact encryption failed", err)
+			}
+			update[column] = encrypted
+		}
+
+		// hooks are skipped, the values are encrypted above
+		err = cigExchange.GetDB().Unscoped().Model(contact).UpdateColumns(update).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Failed to encrypt contact", err)
+		}
+	}
+	return nil
+}
+
 // ContactWithIndex contains Contact struct with index from UserContact
 type ContactWithIndex struct {
 	*Contact
@@ -63,11 +401,16 @@ type ContactWithIndex struct {
 
 // GetContact queries a contact from db
 func GetContact(contactID string) (*Contact, *cigExchange.APIError) {
+	return GetContactCtx(context.Background(), contactID)
+}
+
+// GetContactCtx queries a contact from db with the context
+func GetContactCtx(ctx context.Context, contactID string) (*Contact, *cigExchange.APIError) {
 
 	contact := &Contact{
 		ID: contactID,
 	}
-	db := cigExchange.GetDB().First(contact)
+	db := cigExchange.GetDBWithContext(ctx).First(contact)
 	if db.Error != nil {
 		if db.RecordNotFound() {
 			return nil, cigExchange.NewInvalidFieldError("contact_id", "Contact with provided id doesn't exist")
@@ -80,6 +423,11 @@ func GetContact(contactID string) (*Contact, *cigExchange.APIError) {
 
 // GetContacts queries all contact for user from db
 func GetContacts(userID string) ([]*ContactWithIndex, *cigExchange.APIError) {
+	return GetContactsCtx(context.Background(), userID)
+}
+
+// GetContactsCtx queries all contact for user from db with the context
+func GetContactsCtx(ctx context.Context, userID string) ([]*ContactWithIndex, *cigExchange.APIError) {
 
 	contacts := make([]*ContactWithIndex, 0)
 
@@ -92,48 +440,60 @@ func GetContacts(userID string) ([]*ContactWithIndex, *cigExchange.APIError) {
 	joinS := "INNER JOIN public.user_contact ON contact.id = user_contact.contact_id "
 	whereS := "WHERE user_contact.user_id = '" + userID + "' AND user_contact.deleted_at IS NULL AND contact.deleted_at IS NULL;"
 	// query ContactWithIndex structs
-	db := cigExchange.GetDB().Raw(selectS + joinS + whereS).Scan(&contacts)
+	db := cigExchange.GetDBWithContext(ctx).Raw(selectS + joinS + whereS).Scan(&contacts)
 	if db.Error != nil {
 		if !db.RecordNotFound() {
 			return nil, cigExchange.NewDatabaseError("Fetch contacts failed", db.Error)
 		}
 	}
 
+	// raw scan doesn't call AfterFind
+	for _, contact := range contacts {
+		if err := contact.decryptValues(); err != nil {
+			return nil, cigExchange.NewEncryptionError("Contact decryption failed", err)
+		}
+	}
+
 	return contacts, nil
 }
 
 // Create inserts new offering contact and user_contact into db
 func (contact *Contact) Create(userID string, index int32) *cigExchange.APIError {
 
-	tx := cigExchange.GetDB().Begin()
-	// invalidate the uuid
-	contact.ID = ""
-
-	err := tx.Create(contact).Error
-	if err != nil {
-		tx.Rollback()
-		return cigExchange.NewDatabaseError("Create contact failed", err)
+	// phone is stored in the canonical form
+	if contact.Type == ContactTypePhone {
+		code, number, apiError := cigExchange.NormalizePhone(contact.Value1, contact.Value2)
+		if apiError != nil {
+			return apiError
+		}
+		contact.Value1 = code
+		contact.Value2 = number
 	}
 
-	// create user contact link
-	userContact := &UserContact{
-		UserID:    userID,
-		ContactID: contact.ID,
-		Index:     index,
-	}
-	err = tx.Create(userContact).Error
-	if err != nil {
-		tx.Rollback()
-		return cigExchange.NewDatabaseError("Create user contact link failed", err)
-	}
+	return cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		// invalidate the uuid
+		contact.ID = ""
 
-	// commit new records
-	if err = tx.Commit().Error; err != nil {
-		tx.Rollback()
-		return cigExchange.NewDatabaseError("Commit contact creation failed", err)
-	}
+		err := tx.Create(contact).Error
+		if err != nil {
+			if cigExchange.IsUniqueViolation(err) {
+				return cigExchange.NewUserAlreadyExistsError("Contact with provided email already exists")
+			}
+			return cigExchange.NewDatabaseError("Create contact failed", err)
+		}
 
-	return nil
+		// create user contact link
+		userContact := &UserContact{
+			UserID:    userID,
+			ContactID: contact.ID,
+			Index:     index,
+		}
+		err = tx.Create(userContact).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Create user contact link failed", err)
+		}
+		return nil
+	})
 }
 
 // Update existing contact object in db
@@ -154,26 +514,39 @@ func (contact *Contact) Update(userID string, update map[string]interface{}, ind
 		return cigExchange.NewInvalidFieldError("contact_id", "Contact UUID is not set")
 	}
 
-	tx := cigExchange.GetDB().Begin()
+	apiError := cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		if userContact.Index != index {
+			userContact.Index = index
+			err := tx.Save(userContact).Error
+			if err != nil {
+				return cigExchange.NewDatabaseError("Can't update user contact", err)
+			}
+		}
 
-	if userContact.Index != index {
-		userContact.Index = index
-		err := tx.Save(userContact).Error
-		if err != nil {
-			tx.Rollback()
-			return cigExchange.NewDatabaseError("Can't update user contact", err)
+		// lock the stored contact, the update is checked against it
+		stored := &Contact{}
+		db := tx.Set("gorm:query_option", "FOR UPDATE").Where(&Contact{ID: contact.ID}).First(stored)
+		if db.Error != nil {
+			if db.RecordNotFound() {
+				return cigExchange.NewInvalidFieldError("contact_id", "Contact with provided id doesn't exist")
+			}
+			return cigExchange.NewDatabaseError("Fetch contact failed", db.Error)
+		}
+		if apiError := prepareContactUpdate(stored, update); apiError != nil {
+			return apiError
 		}
-	}
-	err := tx.Model(contact).Updates(update).Error
-	if err != nil {
-		tx.Rollback()
-		return cigExchange.NewDatabaseError("Failed to update contact", db.Error)
-	}
 
-	// commit new records
-	if err = tx.Commit().Error; err != nil {
-		tx.Rollback()
-		return cigExchange.NewDatabaseError("Commit contact update failed", err)
+		err := tx.Model(stored).Updates(update).Error
+		if err != nil {
+			if cigExchange.IsUniqueViolation(err) {
+				return cigExchange.NewUserAlreadyExistsError("Contact with provided email already exists")
+			}
+			return cigExchange.NewDatabaseError("Failed to update contact", err)
+		}
+		return nil
+	})
+	if apiError != nil {
+		return apiError
 	}
 
 	db = cigExchange.GetDB().Where(&Contact{ID: contact.ID}).First(contact)
@@ -184,11 +557,74 @@ func (contact *Contact) Update(userID string, update map[string]interface{}, ind
 	return nil
 }
 
+// prepareContactUpdate checks the contact update against the stored contact.
+// Type and level can't be changed, verification status is set by the OTP verification only
+// and is cleared when the contact value changes. Phone values are normalized like in Create
+func prepareContactUpdate(stored *Contact, update map[string]interface{}) *cigExchange.APIError {
+
+	delete(update, "verified_at")
+
+	for _, field := range []string{"type", "level"} {
+		value, ok := update[field]
+		if !ok {
+			continue
+		}
+		current := stored.Type
+		if field == "level" {
+			current = stored.Level
+		}
+		if str, isString := value.(string); !isString || str != current {
+			return cigExchange.NewInvalidFieldError(field, "Contact "+field+" can't be changed")
+		}
+		delete(update, field)
+	}
+
+	value1, value2 := stored.Value1, stored.Value2
+	valuesUpdated := false
+	for field, value := range map[string]*string{"value1": &value1, "value2": &value2} {
+		updateValue, ok := update[field]
+		if !ok {
+			continue
+		}
+		str, isString := updateValue.(string)
+		if !isString {
+			return cigExchange.NewInvalidFieldError(field, "Field '"+field+"' must be a string")
+		}
+		*value = strings.TrimSpace(str)
+		valuesUpdated = true
+	}
+	if !valuesUpdated {
+		return nil
+	}
+
+	switch stored.Type {
+	case ContactTypePhone:
+		code, number, apiError := cigExchange.NormalizePhone(value1, value2)
+		if apiError != nil {
+			return apiError
+		}
+		value1, value2 = code, number
+		update["value1"] = value1
+		update["value2"] = value2
+	case ContactTypeEmail:
+		if apiError := cigExchange.ValidateEmail(value1); apiError != nil {
+			return apiError
+		}
+		update["value1"] = value1
+	}
+
+	// changed value has to be verified again
+	if value1 != stored.Value1 || value2 != stored.Value2 {
+		update["verified_at"] = nil
+	}
+	return nil
+}
+
 // Delete existing contact object in db
 func (contact *Contact) Delete(userID string) *cigExchange.APIError {
 
-	userCont := &UserContact{ContactID: contact.ID, UserID: userID}
-	db := cigExchange.GetDB().First(userCont)
+	userCont := &UserContact{}
+	db := cigExchange.GetDB().Where(&UserContact{ContactID: contact.ID, UserID: userID}).First(userCont)
 	if db.Error != nil {
 		if db.RecordNotFound() {
 			return cigExchange.NewInvalidFieldError("contact_id, user_id", "User contact link with provided id doesn't exist")
@@ -196,42 +632,71 @@ func (contact *Contact) Delete(userID string) *cigExchange.APIError {
 		return cigExchange.NewDatabaseError("Fetch user contact failed", db.Error)
 	}
 
-	tx := cigExchange.GetDB().Begin()
+	// login contact can't be deleted, it would break the user authentication
+	user := &User{}
+	db = cigExchange.GetDB().Where(&User{ID: userID}).First(user)
+	if db.Error != nil {
+		if db.RecordNotFound() {
+			return cigExchange.NewUserDoesntExistError("User with provided uuid doesn't exist")
+		}
+		return cigExchange.NewDatabaseError("User lookup failed", db.Error)
+	}
+	if user.IsLoginContact(contact.ID) {
+		return cigExchange.NewAccessRightsError("Login contact can't be deleted")
+	}
 
 	// check that UUID is set
 	if len(contact.ID) == 0 {
 		return cigExchange.NewInvalidFieldError("contact_id", "Contact id is invalid")
 	}
 
-	// delete contact
-	tx = tx.Delete(contact)
-	if tx.Error != nil {
-		tx.Rollback()
-		return cigExchange.NewDatabaseError("Failed to delete contact", tx.Error)
-	}
-	if tx.RowsAffected != 1 {
-		tx.Rollback()
-		return cigExchange.NewInvalidFieldError("contact_id", "Contact doesn't exist")
-	}
+	return cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		// delete contact
+		db := tx.Delete(contact)
+		if db.Error != nil {
+			return cigExchange.NewDatabaseError("Failed to delete contact", db.Error)
+		}
+		if db.RowsAffected != 1 {
+			return cigExchange.NewInvalidFieldError("contact_id", "Contact doesn't exist")
+		}
 
-	// delete user contact link
-	tx = tx.Delete(&UserContact{ID: userCont.ID})
-	if tx.Error != nil {
-		tx.Rollback()
-		return cigExchange.NewDatabaseError("Failed to delete user contact", tx.Error)
-	}
-	if tx.RowsAffected != 1 {
-		tx.Rollback()
-		return cigExchange.NewInvalidFieldError("contact_id, user_id", "User Contact link doesn't exist")
-	}
+		// delete user contact link
+		db = tx.Delete(&UserContact{ID: userCont.ID})
+		if db.Error != nil {
+			return cigExchange.NewDatabaseError("Failed to delete user contact", db.Error)
+		}
+		if db.RowsAffected != 1 {
+			return cigExchange.NewInvalidFieldError("contact_id, user_id", "User Contact link doesn't exist")
+		}
+		return nil
+	})
+}
+
+// HardDelete permanently removes the contact and its user contact links from db
+func (contact *Contact) HardDelete() *cigExchange.APIError {
 
-	// commit deletion
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		return cigExchange.NewDatabaseError("Commit contact deletion failed", err)
+	// check that UUID is set
+	if len(contact.ID) == 0 {
+		return cigExchange.NewInvalidFieldError("contact_id", "Contact id is invalid")
 	}
 
-	return nil
+	return cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		// delete user contact links
+		err := tx.Unscoped().Where("contact_id = ?", contact.ID).Delete(&UserContact{}).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Failed to delete user contact", err)
+		}
+
+		// delete contact
+		db := tx.Unscoped().Delete(contact)
+		if db.Error != nil {
+			return cigExchange.NewDatabaseError("Failed to delete contact", db.Error)
+		}
+		if db.RowsAffected != 1 {
+			return cigExchange.NewInvalidFieldError("contact_id", "Contact doesn't exist")
+		}
+		return nil
+	})
 }
 
 // UserContact is a struct to represent a contact
@@ -0,0 +1,86 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"testing"
+)
+
+// requireDB skips the test unless the database from the environment is reachable and migrates it
+func requireDB(t *testing.T) {
+
+	t.Helper()
+	if cigExchange.GetDB() == nil || cigExchange.GetDB().DB() == nil || cigExchange.GetDB().DB().Ping() != nil {
+		t.Skip("database is not available")
+	}
+	if apiError := Migrate(); apiError != nil {
+		t.Fatalf("migration failed: %v", apiError.ToString())
+	}
+}
+
+// createTestRecord creates the record and removes it after the test
+func createTestRecord(t *testing.T, record interface{}) {
+
+	t.Helper()
+	if err := cigExchange.GetDB().Create(record).Error; err != nil {
+		t.Fatalf("create %T failed: %v", record, err)
+	}
+	t.Cleanup(func() {
+		cigExchange.GetDB().Unscoped().Delete(record)
+	})
+}
+
+func TestIsLoginContact(t *testing.T) {
+
+	email := "email-contact"
+	phone := "phone-contact"
+	user := &User{LoginEmailUUID: &email, LoginPhoneUUID: &phone}
+
+	tests := []struct {
+		contactID string
+		expected  bool
+	}{
+		{"email-contact", true},
+		{"phone-contact", true},
+		{"secondary-contact", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := user.IsLoginContact(test.contactID); got != test.expected {
+			t.Errorf("%q: expected %v, got %v", test.contactID, test.expected, got)
+		}
+	}
+
+	if (&User{}).IsLoginContact("email-contact") {
+		t.Error("user without login contacts has a login contact")
+	}
+}
+
+func TestContactDeleteLoginContact(t *testing.T) {
+
+	requireDB(t)
+
+	loginEmail := &Contact{Level: ContactLevelPrimary, Type: ContactTypeEmail, Value1: "login-" + cigExchange.RandomUUID() + "@example.com"}
+	createTestRecord(t, loginEmail)
+	user := &User{Name: "Contact", LastName: "Test", Role: UserRoleUser, Status: UserStatusVerified, LoginEmailUUID: &loginEmail.ID}
+	createTestRecord(t, user)
+	createTestRecord(t, &UserContact{UserID: user.ID, ContactID: loginEmail.ID})
+
+	secondary := &Contact{Level: ContactLevelSecondary, Type: ContactTypeEmail, Value1: "secondary-" + cigExchange.RandomUUID() + "@example.com"}
+	if apiError := secondary.Create(user.ID, 1); apiError != nil {
+		t.Fatalf("create failed: %v", apiError.ToString())
+	}
+	t.Cleanup(func() {
+		cigExchange.GetDB().Unscoped().Where("contact_id = ?", secondary.ID).Delete(&UserContact{})
+		cigExchange.GetDB().Unscoped().Delete(secondary)
+	})
+
+	// primary login contact is kept
+	apiError := (&Contact{ID: loginEmail.ID}).Delete(user.ID)
+	if apiError == nil || len(apiError.Errors) == 0 || apiError.Errors[0].Reason != cigExchange.ReasonNotAllowed {
+		t.Fatalf("expected access rights error, got %v", apiError)
+	}
+
+	if apiError := (&Contact{ID: secondary.ID}).Delete(user.ID); apiError != nil {
+		t.Fatalf("secondary contact delete failed: %v", apiError.ToString())
+	}
+}
@@ -0,0 +1,196 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// Event types
+const (
+	EventTypeUserCreated         = "user.created"
+	EventTypeUserVerified        = "user.verified"
+	EventTypeOrganisationCreated = "organisation.created"
+	EventTypeOrganisationUpdated = "organisation.updated"
+	EventTypeOrganisationDeleted = "organisation.deleted"
+	EventTypeOfferingCreated     = "offering.created"
+	EventTypeOfferingUpdated     = "offering.updated"
+	EventTypeOfferingDeleted     = "offering.deleted"
+)
+
+// Event is a struct to represent an outbox event.
+// Events are written in the same transaction as the state change and dispatched by the relay
+type Event struct {
+	ID          string         `json:"id" gorm:"column:id;primary_key"`
+	Type        string         `json:"type" gorm:"column:type"`
+	AggregateID string         `json:"aggregate_id" gorm:"column:aggregate_id"`
+	Payload     postgres.Jsonb `json:"payload" gorm:"column:payload"`
+	Attempts    int            `json:"-" gorm:"column:attempts"`
+	LastError   string         `json:"-" gorm:"column:last_error"`
+	SentAt      *time.Time     `json:"-" gorm:"column:sent_at"`
+	FailedAt    *time.Time     `json:"-" gorm:"column:failed_at"`
+	CreatedAt   time.Time      `json:"created_at" gorm:"column:created_at"`
+}
+
+// TableName returns table name for struct
+func (*Event) TableName() string {
+	return "event"
+}
+
+// BeforeCreate generates new unique UUIDs for new db records
+func (*Event) BeforeCreate(scope *gorm.Scope) error {
+
+	scope.SetColumn("ID", cigExchange.RandomUUID())
+	return nil
+}
+
+// CreateEventIndexes creates the event table indexes.
+// Relay queries unsent events in the creation order
+func CreateEventIndexes() *cigExchange.APIError {
+
+	query := `CREATE INDEX IF NOT EXISTS event_unsent_idx ON public.event (created_at)
+		WHERE sent_at IS NULL;`
+	db := cigExchange.GetDB().Exec(query)
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Failed to create event unsent index", db.Error)
+	}
+	return nil
+}
+
+// createEvent inserts the outbox event with the JSON encoded payload using db, pass the transaction of the state change
+func createEvent(db *gorm.DB, eventType, aggregateID string, payload interface{}) *cigExchange.APIError {
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return cigExchange.NewJSONEncodingError(cigExchange.MessageJSONEncoding, err)
+	}
+
+	event := &Event{
+		Type:        eventType,
+		AggregateID: aggregateID,
+		Payload:     postgres.Jsonb{RawMessage: payloadBytes},
+	}
+	err = db.Create(event).Error
+	if err != nil {
+		return cigExchange.NewDatabaseError("Create event failed", err)
+	}
+	return nil
+}
+
+// updateEventPayload returns the payload of update events with the id and updated field names
+func updateEventPayload(id string, update map[string]interface{}) map[string]interface{} {
+
+	fields := make([]string, 0, len(update))
+	for field := range update {
+		if field == "id" {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return map[string]interface{}{
+		"id":     id,
+		"fields": fields,
+	}
+}
+
+// EventMaxAttempts is the number of failed dispatches after which the event is dead-lettered:
+// marked failed and no longer relayed. Failed events stay in the table for inspection
+const EventMaxAttempts = 10
+
+// EventDispatcher delivers the outbox event, error leaves the event unsent for the next relay run
+type EventDispatcher func(event *Event) error
+
+// RelayEvents dispatches up to limit unsent events in the creation order and marks them sent.
+// Failed events are skipped and retried by the next relay run, so a failing event doesn't block the others
+// and the delivery order isn't guaranteed. After EventMaxAttempts failures the event is dead-lettered.
+// Locked rows are skipped, so several relays can run at once.
+// Events are delivered at least once, consumers must deduplicate by id
+func RelayEvents(dispatch EventDispatcher, limit int) (int, *cigExchange.APIError) {
+
+	sent := 0
+	apiError := cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+
+		events := make([]*Event, 0)
+		db := tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+			Where("sent_at IS NULL AND failed_at IS NULL").Order("created_at").Limit(limit).Find(&events)
+		if db.Error != nil && !db.RecordNotFound() {
+			return cigExchange.NewDatabaseError("Fetch unsent events failed", db.Error)
+		}
+
+		for _, event := range events {
+			if err := dispatch(event); err != nil {
+				update := map[string]interface{}{
+					"attempts":   event.Attempts + 1,
+					"last_error": err.Error(),
+				}
+				if event.Attempts+1 >= EventMaxAttempts {
+					update["failed_at"] = time.Now()
+					cigExchange.Logger().Error("RelayEvents: event dead-lettered", "event_id", event.ID, "type", event.Type, "error", err)
+				}
+				if err := tx.Model(event).Updates(update).Error; err != nil {
+					return cigExchange.NewDatabaseError("Failed to update event", err)
+				}
+				continue
+			}
+
+			if err := tx.Model(event).Update("sent_at", time.Now()).Error; err != nil {
+				return cigExchange.NewDatabaseError("Failed to mark event sent", err)
+			}
+			sent++
+		}
+		return nil
+	})
+	if apiError != nil {
+		return 0, apiError
+	}
+	return sent, nil
+}
+
+// PublishEvent is the EventDispatcher publishing the event with the cigExchange event publisher
+func PublishEvent(event *Event) error {
+
+	domainEvent := &cigExchange.DomainEvent{
+		ID:          event.ID,
+		Type:        event.Type,
+		AggregateID: event.AggregateID,
+		Payload:     event.Payload.RawMessage,
+		OccurredAt:  event.CreatedAt,
+	}
+	return cigExchange.GetEventPublisher().Publish(domainEvent)
+}
+
+// RunEventRelay relays unsent events every interval until ctx is done.
+// Pass PublishEvent as dispatch to publish the events to the message broker.
+// Start it with cigExchange.RunAsync so Shutdown waits for the running relay
+func RunEventRelay(ctx context.Context, interval time.Duration, dispatch EventDispatcher) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// relay all pending events before waiting for the next tick
+		for {
+			sent, apiError := RelayEvents(dispatch, 100)
+			if apiError != nil {
+				cigExchange.LogAPIError("RunEventRelay: relay failed", apiError)
+				break
+			}
+			if sent < 100 {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
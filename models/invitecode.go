@@ -0,0 +1,206 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// organisation invite code length
+const inviteCodeLength = 12
+
+// OrganisationInviteCode is a struct to represent a time limited organisation invite code.
+// Invite codes can be used instead of the permanent organisation reference key at signup
+type OrganisationInviteCode struct {
+	ID             string     `json:"id" gorm:"column:id;primary_key"`
+	OrganisationID string     `json:"organisation_id" gorm:"column:organisation_id"`
+	Code           string     `json:"code" gorm:"column:code"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"column:expires_at"`
+	MaxUses        int        `json:"max_uses" gorm:"column:max_uses"`
+	UseCount       int        `json:"use_count" gorm:"column:use_count"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"column:created_at"`
+	UpdatedAt      time.Time  `json:"-" gorm:"column:updated_at"`
+	DeletedAt      *time.Time `json:"-" gorm:"column:deleted_at"`
+}
+
+// TableName returns table name for struct
+func (*OrganisationInviteCode) TableName() string {
+	return "organisation_invite_code"
+}
+
+// BeforeCreate generates new unique UUIDs for new db records
+func (*OrganisationInviteCode) BeforeCreate(scope *gorm.Scope) error {
+
+	scope.SetColumn("ID", cigExchange.RandomUUID())
+	return nil
+}
+
+// IsUsable returns true if invite code isn't expired and has uses left
+func (inviteCode *OrganisationInviteCode) IsUsable() bool {
+
+	if !time.Now().Before(inviteCode.ExpiresAt) {
+		return false
+	}
+	return inviteCode.MaxUses == 0 || inviteCode.UseCount < inviteCode.MaxUses
+}
+
+// CreateOrganisationInviteCode generates new invite code for the organisation valid for ttl.
+// maxUses limits the number of signups with the code, 0 means unlimited (1 for single use codes)
+func CreateOrganisationInviteCode(organisationID string, ttl time.Duration, maxUses int) (*OrganisationInviteCode, *cigExchange.APIError) {
+
+	// check that UUID is set
+	if len(organisationID) == 0 {
+		return nil, cigExchange.NewInvalidFieldError("organisation_id", "Organisation id is invalid")
+	}
+	if ttl <= 0 {
+		return nil, cigExchange.NewInvalidFieldError("ttl", "Invite code lifetime must be positive")
+	}
+	if maxUses < 0 {
+		return nil, cigExchange.NewInvalidFieldError("max_uses", "Invite code max uses can't be negative")
+	}
+
+	// check that organisation exists
+	_, apiError := GetOrganisation(organisationID)
+	if apiError != nil {
+		return nil, apiError
+	}
+
+	inviteCode := &OrganisationInviteCode{
+		OrganisationID: organisationID,
+		Code:           cigExchange.RandCode(inviteCodeLength),
+		ExpiresAt:      time.Now().Add(ttl),
+		MaxUses:        maxUses,
+	}
+	db := cigExchange.GetDB().Create(inviteCode)
+	if db.Error != nil {
+		return nil, cigExchange.NewDatabaseError("Create organisation invite code call failed", db.Error)
+	}
+	return inviteCode, nil
+}
+
+// GetOrganisationInviteCodes queries all invite codes of the organisation from db
+func GetOrganisationInviteCodes(organisationID string) ([]*OrganisationInviteCode, *cigExchange.APIError) {
+
+	inviteCodes := make([]*OrganisationInviteCode, 0)
+
+	// check that UUID is set
+	if len(organisationID) == 0 {
+		return inviteCodes, cigExchange.NewInvalidFieldError("organisation_id", "Organisation id is invalid")
+	}
+
+	db := cigExchange.GetDB().Where(&OrganisationInviteCode{OrganisationID: organisationID}).Order("created_at desc").Find(&inviteCodes)
+	if db.Error != nil {
+		if !db.RecordNotFound() {
+			return inviteCodes, cigExchange.NewDatabaseError("Organisation invite codes lookup failed", db.Error)
+		}
+	}
+	return inviteCodes, nil
+}
+
+// Delete revokes the invite code
+func (inviteCode *OrganisationInviteCode) Delete() *cigExchange.APIError {
+
+	// check that UUID is set
+	if len(inviteCode.ID) == 0 {
+		return cigExchange.NewInvalidFieldError("invite_code_id", "Invite code id is invalid")
+	}
+
+	db := cigExchange.GetDB().Delete(inviteCode)
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Delete organisation invite code call failed", db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return cigExchange.NewInvalidFieldError("invite_code_id", "Invite code with provided id doesn't exist")
+	}
+	return nil
+}
+
+// use increments the invite code use count if it's still usable, db can be a transaction
+func (inviteCode *OrganisationInviteCode) use(db *gorm.DB) *cigExchange.APIError {
+
+	db = db.Model(&OrganisationInviteCode{}).
+		Where("id = ? and expires_at > now() and (max_uses = 0 or use_count < max_uses)", inviteCode.ID).
+		Update("use_count", gorm.Expr("use_count + 1"))
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Update organisation invite code call failed", db.Error)
+	}
+	// concurrent signup used the last use or the code expired
+	if db.RowsAffected == 0 {
+		return cigExchange.NewInvalidFieldError("reference_key", "Organisation invite code is expired")
+	}
+	inviteCode.UseCount++
+	return nil
+}
+
+// releaseInviteCodeUses decrements the use count of invite codes used by unverified organisation links of the user.
+// Called in the transaction deleting the unverified user
+func releaseInviteCodeUses(tx *gorm.DB, userID string) *cigExchange.APIError {
+
+	orgUsers := make([]*OrganisationUser, 0)
+	db := tx.Where("user_id = ? and status = ? and invite_code_id is not null", userID, OrganisationUserStatusUnverified).Find(&orgUsers)
+	if db.Error != nil && !db.RecordNotFound() {
+		return cigExchange.NewDatabaseError("Organization user links lookup failed", db.Error)
+	}
+
+	for _, orgUser := range orgUsers {
+		err := tx.Model(&OrganisationInviteCode{}).
+			Where("id = ? and use_count > 0", *orgUser.InviteCodeID).
+			Update("use_count", gorm.Expr("use_count - 1")).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Update organisation invite code call failed", err)
+		}
+	}
+	return nil
+}
+
+// resolveReferenceKey returns the organisation for the invite code or the permanent reference key.
+// Invite code is returned if it was used
+func resolveReferenceKey(referenceKey string) (*Organisation, *OrganisationInviteCode, *cigExchange.APIError) {
+
+	referenceKey = strings.TrimSpace(referenceKey)
+
+	// check invite codes first
+	inviteCode := &OrganisationInviteCode{}
+	db := cigExchange.GetDB().Where(&OrganisationInviteCode{Code: strings.ToUpper(referenceKey)}).First(inviteCode)
+	if db.Error == nil {
+		if !inviteCode.IsUsable() {
+			return nil, nil, cigExchange.NewInvalidFieldError("reference_key", "Organisation invite code is expired")
+		}
+		org, apiError := GetOrganisation(inviteCode.OrganisationID)
+		if apiError != nil {
+			return nil, nil, apiError
+		}
+		return org, inviteCode, nil
+	}
+	if !db.RecordNotFound() {
+		return nil, nil, cigExchange.NewDatabaseError("Organisation invite code lookup failed", db.Error)
+	}
+
+	// fall back to the permanent reference key
+	org, apiError := GetOrganisationByReferenceKey(referenceKey)
+	if apiError != nil {
+		// wrong reference key is reported as invalid field
+		if len(apiError.Errors) > 0 && apiError.Errors[0].Reason == cigExchange.ReasonOrganisationDoesntExist {
+			return nil, nil, cigExchange.NewInvalidFieldError("reference_key", "Organisation reference key is invalid")
+		}
+		return nil, nil, apiError
+	}
+
+	cigExchange.Logger().Warn("Permanent reference key used to join organisation", "organisation_id", org.ID)
+	return org, nil, nil
+}
+
+// CreateOrganisationInviteCodeIndexes creates the unique index on invite codes
+func CreateOrganisationInviteCodeIndexes() *cigExchange.APIError {
+
+	query := `CREATE UNIQUE INDEX IF NOT EXISTS organisation_invite_code_code_unique_idx ON public.organisation_invite_code (code)
+		WHERE deleted_at IS NULL;`
+
+	db := cigExchange.GetDB().Exec(query)
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Create organisation invite code indexes failed", db.Error)
+	}
+	return nil
+}
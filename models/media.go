@@ -2,6 +2,7 @@ package models
 
 import (
 	cigExchange "cig-exchange-libs"
+	"context"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -78,11 +79,16 @@ func (*OfferingMedia) BeforeCreate(scope *gorm.Scope) error {
 
 // GetMedia queries a single media from db
 func GetMedia(mediaID string) (*Media, *cigExchange.APIError) {
+	return GetMediaCtx(context.Background(), mediaID)
+}
+
+// GetMediaCtx queries a single media from db with the context
+func GetMediaCtx(ctx context.Context, mediaID string) (*Media, *cigExchange.APIError) {
 
 	media := &Media{
 		ID: mediaID,
 	}
-	db := cigExchange.GetDB().First(media)
+	db := cigExchange.GetDBWithContext(ctx).First(media)
 	if db.Error != nil {
 		if db.RecordNotFound() {
 			return nil, cigExchange.NewInvalidFieldError("media_id", "Media with provided id doesn't exist")
@@ -120,24 +126,25 @@ func CreateMediaForOffering(mediaIndex *MediaWithIndex, offeringID string) *cigE
 		return cigExchange.NewInvalidFieldError("offering_id", "Offering id is invalid")
 	}
 
-	// create media
-	db := cigExchange.GetDB().Create(media)
-	if db.Error != nil {
-		return cigExchange.NewDatabaseError("Create media failed", db.Error)
-	}
-
-	// create offering media link
-	mediaOffering := &OfferingMedia{
-		OfferingID: offeringID,
-		MediaID:    media.ID,
-		Index:      mediaIndex.Index,
-	}
-	db = cigExchange.GetDB().Create(mediaOffering)
-	if db.Error != nil {
-		return cigExchange.NewDatabaseError("Create offering media failed", db.Error)
-	}
+	return cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		// create media
+		err := tx.Create(media).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Create media failed", err)
+		}
 
-	return nil
+		// create offering media link
+		mediaOffering := &OfferingMedia{
+			OfferingID: offeringID,
+			MediaID:    media.ID,
+			Index:      mediaIndex.Index,
+		}
+		err = tx.Create(mediaOffering).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Create offering media failed", err)
+		}
+		return nil
+	})
 }
 
 // Update existing media object in db
@@ -157,6 +164,11 @@ func (media *Media) Update(update map[string]interface{}) *cigExchange.APIError
 
 // GetMediaForOffering queries all offering media objects for offering
 func GetMediaForOffering(offeringID string) (media []*MediaWithIndex, apiError *cigExchange.APIError) {
+	return GetMediaForOfferingCtx(context.Background(), offeringID)
+}
+
+// GetMediaForOfferingCtx queries all offering media objects for offering with the context
+func GetMediaForOfferingCtx(ctx context.Context, offeringID string) (media []*MediaWithIndex, apiError *cigExchange.APIError) {
 
 	media = make([]*MediaWithIndex, 0)
 	// check that UUID is set
@@ -164,7 +176,7 @@ func GetMediaForOffering(offeringID string) (media []*MediaWithIndex, apiError *
 		return media, cigExchange.NewInvalidFieldError("offering_id", "Offering id is invalid")
 	}
 
-	db := cigExchange.GetDB().Select("media.*, offering_media.index").
+	db := cigExchange.GetDBWithContext(ctx).Select("media.*, offering_media.index").
 		Joins("JOIN offering_media on offering_media.media_id=media.id").
 		Where("offering_media.offering_id=?", offeringID).Find(&media)
 	if db.Error != nil {
@@ -204,23 +216,72 @@ func DeleteOfferingMedia(mediaID string) *cigExchange.APIError {
 		return cigExchange.NewInvalidFieldError("media_id", "Media id is invalid")
 	}
 
-	// delete media
-	db := cigExchange.GetDB().Delete(&Media{ID: mediaID})
-	if db.Error != nil {
-		return cigExchange.NewDatabaseError("Failed to delete media", db.Error)
+	return cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		// delete media
+		db := tx.Delete(&Media{ID: mediaID})
+		if db.Error != nil {
+			return cigExchange.NewDatabaseError("Failed to delete media", db.Error)
+		}
+		if db.RowsAffected == 0 {
+			return cigExchange.NewInvalidFieldError("media_id", "Media with provided id doesn't exist")
+		}
+
+		// delete offering media link
+		db = tx.Where("media_id = ?", mediaID).Delete(&OfferingMedia{})
+		if db.Error != nil {
+			return cigExchange.NewDatabaseError("Failed to delete offering media link", db.Error)
+		}
+		if db.RowsAffected == 0 {
+			return cigExchange.NewInvalidFieldError("media_id", "Offering Media link with provided id doesn't exist")
+		}
+		return nil
+	})
+}
+
+// Restore restores soft deleted media and its offering media links in db.
+// Platform admins and admins of the organisations of the linked offerings can restore the media
+func (media *Media) Restore(userUUID string) *cigExchange.APIError {
+
+	// check that UUID is set
+	if len(media.ID) == 0 {
+		return cigExchange.NewInvalidFieldError("media_id", "Media id is invalid")
 	}
-	if db.RowsAffected == 0 {
-		return cigExchange.NewInvalidFieldError("media_id", "Media with provided id doesn't exist")
+
+	// links are soft deleted together with the media
+	organisationIDs := make([]string, 0)
+	db := cigExchange.GetDB().Unscoped().Table("offering_media").
+		Joins("JOIN offering ON offering.id = offering_media.offering_id").
+		Where("offering_media.media_id = ?", media.ID).Pluck("DISTINCT offering.organisation_id", &organisationIDs)
+	if db.Error != nil && !db.RecordNotFound() {
+		return cigExchange.NewDatabaseError("Fetch media organisations failed", db.Error)
 	}
 
-	// delete offering media link
-	db = cigExchange.GetDB().Where("media_id = ?", mediaID).Delete(&OfferingMedia{})
-	if db.Error != nil {
-		return cigExchange.NewDatabaseError("Failed to delete offering media link", db.Error)
+	if apiError := checkRestorePermission(userUUID, organisationIDs); apiError != nil {
+		return apiError
 	}
-	if db.RowsAffected == 0 {
-		return cigExchange.NewInvalidFieldError("media_id", "Offering Media link with provided id doesn't exist")
+
+	apiError := cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		// restore media
+		db := tx.Unscoped().Model(media).Where("deleted_at IS NOT NULL").Update("deleted_at", nil)
+		if db.Error != nil {
+			return cigExchange.NewDatabaseError("Failed to restore media", db.Error)
+		}
+		if db.RowsAffected == 0 {
+			return cigExchange.NewInvalidFieldError("media_id", "Deleted media with provided id doesn't exist")
+		}
+
+		// restore offering media links
+		db = tx.Unscoped().Model(&OfferingMedia{}).Where("media_id = ? AND deleted_at IS NOT NULL", media.ID).Update("deleted_at", nil)
+		if db.Error != nil {
+			return cigExchange.NewDatabaseError("Failed to restore offering media link", db.Error)
+		}
+		return nil
+	})
+	if apiError != nil {
+		return apiError
 	}
+
+	media.DeletedAt = nil
 	return nil
 }
 
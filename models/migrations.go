@@ -0,0 +1,191 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"fmt"
+	"time"
+)
+
+// SchemaMigration is a struct to represent an applied data migration
+type SchemaMigration struct {
+	Version     int       `gorm:"column:version;primary_key;auto_increment:false"`
+	Description string    `gorm:"column:description"`
+	CreatedAt   time.Time `gorm:"column:created_at"`
+}
+
+// TableName returns table name for struct
+func (*SchemaMigration) TableName() string {
+	return "schema_migration"
+}
+
+// migration is a versioned data migration applied once
+type migration struct {
+	Version     int
+	Description string
+	Up          func() *cigExchange.APIError
+}
+
+// migrations are applied in the version order, never change or reorder applied versions
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "contact email unique index",
+		Up:          CreateContactIndexes,
+	},
+	{
+		Version:     2,
+		Description: "mark active users login contacts verified",
+		Up:          MarkActiveUsersLoginContactsVerified,
+	},
+	{
+		Version:     3,
+		Description: "organisation reference key unique index",
+		Up:          CreateOrganisationIndexes,
+	},
+	{
+		Version:     4,
+		Description: "offering slug unique index",
+		Up:          CreateOfferingIndexes,
+	},
+	{
+		Version:     5,
+		Description: "organisation invite code unique index",
+		Up:          CreateOrganisationInviteCodeIndexes,
+	},
+	{
+		Version:     6,
+		Description: "event unsent index",
+		Up:          CreateEventIndexes,
+	},
+	{
+		Version:     7,
+		Description: "backfill user platform",
+		Up:          BackfillUserPlatform,
+	},
+	{
+		Version:     8,
+		Description: "offering audit index",
+		Up:          CreateOfferingAuditIndexes,
+	},
+	{
+		Version:     9,
+		Description: "audit log record index",
+		Up:          cigExchange.CreateAuditLogIndexes,
+	},
+	{
+		Version:     10,
+		Description: "normalize phone contacts",
+		Up:          NormalizePhoneContacts,
+	},
+	{
+		Version:     11,
+		Description: "contact phone index",
+		Up:          CreateContactPhoneIndexes,
+	},
+	{
+		Version:     12,
+		Description: "contact phone hash and email hash unique indexes",
+		Up:          CreateContactHashIndexes,
+	},
+	{
+		Version:     13,
+		Description: "contact email hash index",
+		Up:          CreateContactEmailHashIndexes,
+	},
+}
+
+// autoMigrateModels returns all models with db tables
+func autoMigrateModels() []interface{} {
+	return []interface{}{
+		&Contact{},
+		&UserContact{},
+		&Info{},
+		&User{},
+		&Organisation{},
+		&OrganisationUser{},
+		&OrganisationInviteCode{},
+		&Media{},
+		&OfferingMedia{},
+		&Offering{},
+		&UserActivity{},
+		&Event{},
+		&OfferingAudit{},
+		&cigExchange.AuditLog{},
+		&SchemaMigration{},
+	}
+}
+
+// Migrate creates missing tables and columns for all models and applies pending data migrations.
+// Can be called at startup or from cmd/migrate, already applied migrations are skipped
+func Migrate() *cigExchange.APIError {
+
+	cigExchange.Logger().Info("Migrate: auto migrating models")
+	db := cigExchange.GetDB().AutoMigrate(autoMigrateModels()...)
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Auto migration failed", db.Error)
+	}
+
+	// query applied migrations
+	applied := make([]*SchemaMigration, 0)
+	db = cigExchange.GetDB().Find(&applied)
+	if db.Error != nil && !db.RecordNotFound() {
+		return cigExchange.NewDatabaseError("Fetch applied migrations failed", db.Error)
+	}
+
+	appliedVersions := make(map[int]bool)
+	for _, schemaMigration := range applied {
+		appliedVersions[schemaMigration.Version] = true
+	}
+
+	for _, m := range migrations {
+		if appliedVersions[m.Version] {
+			continue
+		}
+
+		cigExchange.Logger().Info("Migrate: applying migration", "version", m.Version, "description", m.Description)
+		apiError := m.Up()
+		if apiError != nil {
+			cigExchange.LogAPIError("Migrate: migration failed", apiError)
+			return apiError
+		}
+
+		schemaMigration := &SchemaMigration{
+			Version:     m.Version,
+			Description: m.Description,
+		}
+		db = cigExchange.GetDB().Create(schemaMigration)
+		if db.Error != nil {
+			return cigExchange.NewDatabaseError("Save applied migration failed", db.Error)
+		}
+	}
+
+	cigExchange.Logger().Info("Migrate: database is up to date")
+	return nil
+}
+
+// checkUniqueIndexDuplicates returns an error listing the duplicated values of the column among the rows matching where.
+// Unique index migrations call it first, so the migration fails with the rows to fix
+// instead of the database error. Duplicates are not removed automatically, they belong to different owners
+func checkUniqueIndexDuplicates(table, column, where string) *cigExchange.APIError {
+
+	type duplicate struct {
+		Count int64
+		IDs   string
+	}
+	duplicates := make([]*duplicate, 0)
+	query := "SELECT count(*) AS count, string_agg(id::text, ', ') AS ids FROM public." + table +
+		" WHERE " + where + " GROUP BY " + column + " HAVING count(*) > 1;"
+	db := cigExchange.GetDB().Raw(query).Scan(&duplicates)
+	if db.Error != nil && !db.RecordNotFound() {
+		return cigExchange.NewDatabaseError("Duplicates lookup failed", db.Error)
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	for _, d := range duplicates {
+		cigExchange.Logger().Error("Migrate: duplicated unique value", "table", table, "column", column, "count", d.Count, "ids", d.IDs)
+	}
+	return cigExchange.NewInternalServerError(cigExchange.ReasonDatabaseFailure,
+		fmt.Sprintf("%v %v has %v duplicated values, resolve them and run the migration again", table, column, len(duplicates)))
+}
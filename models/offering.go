@@ -2,7 +2,11 @@ package models
 
 import (
 	cigExchange "cig-exchange-libs"
+	"context"
 	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -21,6 +25,7 @@ type Offering struct {
 	Amount                 *float64       `json:"amount" gorm:"column:amount"`
 	Remaining              float64        `json:"remaining" gorm:"-"`
 	Interest               *float64       `json:"interest" gorm:"column:interest"`
+	AnnualInterest         *float64       `json:"annual_interest" gorm:"-"`
 	Period                 *int64         `json:"period" gorm:"column:period"`
 	Origin                 string         `json:"origin" gorm:"column:origin"`
 	Map                    postgres.Jsonb `json:"map" gorm:"column:map"`
@@ -38,11 +43,12 @@ type Offering struct {
 	ReferralReward         *float64       `json:"referral_reward" gorm:"column:referral_reward"`
 	ClosingDate            *string        `json:"closing_date" gorm:"column:closing_date"`
 	IsVisible              bool           `json:"is_visible" gorm:"is_visible"`
+	HiddenBySuspension     bool           `json:"-" gorm:"column:hidden_by_suspension"`
 	Organisation           Organisation   `json:"-" gorm:"foreignkey:OrganisationID;association_foreignkey:ID"`
 	OrganisationID         string         `json:"organisation_id" gorm:"column:organisation_id"`
 	OfferingDirectURL      postgres.Jsonb `json:"offering_direct_url" gorm:"column:offering_direct_url"`
 	Media                  []*Media       `json:"-" gorm:"many2many:offering_media;"`
-	MediaTypes             MediaTypes     `json:"media"`
+	MediaTypes             MediaTypes     `json:"media" gorm:"-"`
 	CreatedAt              time.Time      `json:"created_at" gorm:"column:created_at"`
 	UpdatedAt              time.Time      `json:"updated_at" gorm:"column:updated_at"`
 	DeletedAt              *time.Time     `json:"-" gorm:"column:deleted_at"`
@@ -74,53 +80,50 @@ func (offering *Offering) GetMultilangFields() []string {
 
 // Validate checks that:
 // - required fields are pressent and not empty
+// - amounts, rating, map and dates are valid
+// all invalid fields are reported together
 func (offering *Offering) Validate() *cigExchange.APIError {
 
-	if len(offering.OrganisationID) == 0 {
-		return cigExchange.NewInvalidFieldError("organisation_id", "Required field 'organisation_id' missing")
-	}
-
-	// check OfferingDirectURL
-	if len(offering.OfferingDirectURL.RawMessage) == 0 {
-		return cigExchange.NewInvalidFieldError("offering_direct_url", "Required field 'offering_direct_url' missing")
-	}
-	value, err := offering.OfferingDirectURL.MarshalJSON()
-	if err != nil {
-		return cigExchange.NewRequestDecodingError(err)
-	}
+	v := cigExchange.NewValidator().
+		Field("organisation_id", offering.OrganisationID, cigExchange.Required).
+		Field("offering_direct_url", offering.OfferingDirectURL.RawMessage, cigExchange.Required).
+		Field("origin", offering.Origin, cigExchange.Required).
+		Field("title", offering.Title.RawMessage, cigExchange.Required)
 
 	// check that all languages present
-	var langsObject cigExchange.MultilangString
-	if err := json.Unmarshal(value, &langsObject); err != nil {
-		return cigExchange.NewRequestDecodingError(err)
+	if v.IsValid("offering_direct_url") {
+		var langsObject cigExchange.MultilangString
+		if err := json.Unmarshal(offering.OfferingDirectURL.RawMessage, &langsObject); err != nil {
+			return cigExchange.NewRequestDecodingError(err)
+		}
+		v.Field("offering_direct_url.en", langsObject.En, cigExchange.Required).
+			Field("offering_direct_url.fr", langsObject.Fr, cigExchange.Required).
+			Field("offering_direct_url.it", langsObject.It, cigExchange.Required).
+			Field("offering_direct_url.de", langsObject.De, cigExchange.Required)
 	}
 
-	missingFieldNames := make([]string, 0)
-	if len(langsObject.En) == 0 {
-		missingFieldNames = append(missingFieldNames, "offering_direct_url.en")
-	}
-	if len(langsObject.Fr) == 0 {
-		missingFieldNames = append(missingFieldNames, "offering_direct_url.fr")
-	}
-	if len(langsObject.It) == 0 {
-		missingFieldNames = append(missingFieldNames, "offering_direct_url.it")
-	}
-	if len(langsObject.De) == 0 {
-		missingFieldNames = append(missingFieldNames, "offering_direct_url.de")
-	}
-	if len(offering.Origin) == 0 {
-		missingFieldNames = append(missingFieldNames, "origin")
+	v.Check(offering.checkInvestmentLimits()).
+		Check(offering.checkRemaining()).
+		Check(validateRating(offering.Rating))
+
+	if len(offering.Map.RawMessage) > 0 {
+		_, apiErr := offering.GetMap()
+		v.Check(apiErr)
 	}
-	if len(offering.Title.RawMessage) == 0 {
-		missingFieldNames = append(missingFieldNames, "title")
+
+	closingDate, apiErr := normalizeDate("closing_date", offering.ClosingDate)
+	if apiErr == nil {
+		offering.ClosingDate = closingDate
 	}
+	v.Check(apiErr)
 
-	if len(missingFieldNames) > 0 {
-		return cigExchange.NewRequiredFieldError(missingFieldNames)
+	debtEndDatetime, apiErr := normalizeDate("current_debt_end_datetime", offering.CurrentDebtEndDatetime)
+	if apiErr == nil {
+		offering.CurrentDebtEndDatetime = debtEndDatetime
 	}
+	v.Check(apiErr)
 
-	apiErr := offering.checkRemaining()
-	if apiErr != nil {
+	if apiErr := v.Error(); apiErr != nil {
 		return apiErr
 	}
 
@@ -141,6 +144,11 @@ func (offering *Offering) Validate() *cigExchange.APIError {
 
 // Create inserts new offering object into db
 func (offering *Offering) Create() *cigExchange.APIError {
+	return offering.CreateCtx(context.Background())
+}
+
+// CreateCtx inserts new offering object into db with the context
+func (offering *Offering) CreateCtx(ctx context.Context) *cigExchange.APIError {
 
 	// invalidate the uuid
 	offering.ID = ""
@@ -149,9 +157,27 @@ func (offering *Offering) Create() *cigExchange.APIError {
 		return apiError
 	}
 
-	db := cigExchange.GetDB().Create(offering)
-	if db.Error != nil {
-		return cigExchange.NewDatabaseError("Create offering failed", db.Error)
+	// generate slug from the english title unless provided
+	apiErr := offering.saveWithUniqueSlug(offering.Slug == nil || len(*offering.Slug) == 0, func() (bool, *cigExchange.APIError) {
+		slugConflict := false
+		apiError := cigExchange.WithTransactionCtx(ctx, func(tx *gorm.DB) *cigExchange.APIError {
+			err := tx.Create(offering).Error
+			if err != nil {
+				if cigExchange.IsUniqueConstraintViolation(err, offeringSlugIndex) {
+					slugConflict = true
+					return cigExchange.NewInvalidFieldError("slug", "Offering slug already in use")
+				}
+				return cigExchange.NewDatabaseError("Create offering failed", err)
+			}
+			if apiError := createOfferingAudit(ctx, tx, cigExchange.AuditOperationCreate, &Offering{}, offering); apiError != nil {
+				return apiError
+			}
+			return createEvent(tx, EventTypeOfferingCreated, offering.ID, offering)
+		})
+		return slugConflict, apiError
+	})
+	if apiErr != nil {
+		return apiErr
 	}
 
 	offering.processOffering(make(map[string]int32))
@@ -159,12 +185,56 @@ func (offering *Offering) Create() *cigExchange.APIError {
 	return nil
 }
 
+// offeringNullableColumns are the columns that can be cleared with UpdateWithClear
+var offeringNullableColumns = []string{
+	"rating",
+	"slug",
+	"amount",
+	"interest",
+	"period",
+	"current_debt_end_datetime",
+	"amount_already_taken",
+	"minimum_investment",
+	"maximum_investment",
+	"transaction_fee",
+	"p2p_fee",
+	"referral_reward",
+	"closing_date",
+}
+
 // Update existing offering object in db
 func (offering *Offering) Update(update map[string]interface{}) *cigExchange.APIError {
+	return offering.UpdateCtx(context.Background(), update)
+}
 
-	apiErr := offering.checkRemaining()
-	if apiErr != nil {
-		return apiErr
+// UpdateCtx updates existing offering object in db with the context
+func (offering *Offering) UpdateCtx(ctx context.Context, update map[string]interface{}) *cigExchange.APIError {
+	return offering.UpdateWithClearCtx(ctx, update, nil)
+}
+
+// UpdateWithClear updates existing offering object in db and sets clearFields columns to NULL
+func (offering *Offering) UpdateWithClear(update map[string]interface{}, clearFields []string) *cigExchange.APIError {
+	return offering.UpdateWithClearCtx(context.Background(), update, clearFields)
+}
+
+// UpdateWithClearCtx updates existing offering object in db and sets clearFields columns to NULL with the context
+func (offering *Offering) UpdateWithClearCtx(ctx context.Context, update map[string]interface{}, clearFields []string) *cigExchange.APIError {
+
+	// check that cleared fields are nullable and not updated at the same time
+	for _, field := range clearFields {
+		nullable := false
+		for _, column := range offeringNullableColumns {
+			if column == field {
+				nullable = true
+				break
+			}
+		}
+		if !nullable {
+			return cigExchange.NewInvalidFieldError(field, "Field '"+field+"' can't be cleared")
+		}
+		if _, ok := update[field]; ok {
+			return cigExchange.NewInvalidFieldError(field, "Field '"+field+"' can't be updated and cleared at the same time")
+		}
 	}
 
 	// check that UUID is set
@@ -172,49 +242,519 @@ func (offering *Offering) Update(update map[string]interface{}) *cigExchange.API
 		return cigExchange.NewInvalidFieldError("offering_id", "Offering UUID is not set")
 	}
 
-	db := cigExchange.GetDB().Model(offering).Updates(update)
-	if db.Error != nil {
-		return cigExchange.NewDatabaseError("Failed to update offering", db.Error)
+	// validate rating if changed
+	if ratingVal, ok := update["rating"]; ok && ratingVal != nil {
+		rating, ok := ratingVal.(string)
+		if !ok {
+			return cigExchange.NewInvalidFieldError("rating", "Rating is not a string")
+		}
+		if apiErr := validateRating(&rating); apiErr != nil {
+			return apiErr
+		}
 	}
 
-	return nil
+	// validate map coordinates if changed
+	if mapVal, ok := update["map"]; ok && mapVal != nil {
+		var raw json.RawMessage
+		switch v := mapVal.(type) {
+		case postgres.Jsonb:
+			raw = v.RawMessage
+		default:
+			mapBytes, err := json.Marshal(v)
+			if err != nil {
+				return cigExchange.NewJSONEncodingError(cigExchange.MessageRequestJSONDecoding, err)
+			}
+			raw = mapBytes
+		}
+		geoPoint, apiErr := parseGeoPoint(raw)
+		if apiErr != nil {
+			return apiErr
+		}
+		if geoPoint != nil {
+			mapBytes, err := json.Marshal(geoPoint)
+			if err != nil {
+				return cigExchange.NewJSONEncodingError(cigExchange.MessageJSONEncoding, err)
+			}
+			update["map"] = postgres.Jsonb{RawMessage: mapBytes}
+		}
+	}
+
+	// validate and normalize dates if changed
+	for _, field := range []string{"closing_date", "current_debt_end_datetime"} {
+		dateVal, ok := update[field]
+		if !ok || dateVal == nil {
+			continue
+		}
+		dateStr, ok := dateVal.(string)
+		if !ok {
+			return cigExchange.NewInvalidFieldError(field, "Date is not a string")
+		}
+		date, apiErr := normalizeDate(field, &dateStr)
+		if apiErr != nil {
+			return apiErr
+		}
+		update[field] = date
+	}
+
+	// slug stays stable on title change, explicitly provided slug is normalized
+	if slugVal, ok := update["slug"]; ok && slugVal != nil {
+		slug, ok := slugVal.(string)
+		if !ok {
+			return cigExchange.NewInvalidFieldError("slug", "Slug is not a string")
+		}
+		slug = Slugify(slug)
+		if len(slug) == 0 {
+			return cigExchange.NewInvalidFieldError("slug", "Slug is invalid")
+		}
+		update["slug"] = slug
+	}
+
+	// gorm skips nil values, NULL is set explicitly
+	for _, field := range clearFields {
+		update[field] = gorm.Expr("NULL")
+	}
+
+	payload := updateEventPayload(offering.ID, update)
+	return cigExchange.WithTransactionCtx(ctx, func(tx *gorm.DB) *cigExchange.APIError {
+		before, apiError := fetchOfferingForAudit(tx, offering.ID)
+		if apiError != nil {
+			return apiError
+		}
+
+		// amounts are checked with the stored values of the fields missing in the update
+		merged, apiError := offeringWithUpdate(before, update, clearFields)
+		if apiError != nil {
+			return apiError
+		}
+		if apiError = merged.checkInvestmentLimits(); apiError != nil {
+			return apiError
+		}
+		if apiError = merged.checkRemaining(); apiError != nil {
+			return apiError
+		}
+
+		err := tx.Model(offering).Updates(update).Error
+		if err != nil {
+			if cigExchange.IsUniqueConstraintViolation(err, offeringSlugIndex) {
+				return cigExchange.NewInvalidFieldError("slug", "Offering slug already in use")
+			}
+			return cigExchange.NewDatabaseError("Failed to update offering", err)
+		}
+		after, apiError := fetchOfferingForAudit(tx, offering.ID)
+		if apiError != nil {
+			return apiError
+		}
+		if apiError = createOfferingAudit(ctx, tx, cigExchange.AuditOperationUpdate, before, after); apiError != nil {
+			return apiError
+		}
+		return createEvent(tx, EventTypeOfferingUpdated, offering.ID, payload)
+	})
 }
 
 // Delete existing offering object in db
 func (offering *Offering) Delete() *cigExchange.APIError {
+	return offering.DeleteCtx(context.Background())
+}
+
+// DeleteCtx deletes existing offering object in db with the context
+func (offering *Offering) DeleteCtx(ctx context.Context) *cigExchange.APIError {
+
+	// check that UUID is set
+	if len(offering.ID) == 0 {
+		return cigExchange.NewInvalidFieldError("offering_id", "Offering id is invalid")
+	}
+
+	return cigExchange.WithTransactionCtx(ctx, func(tx *gorm.DB) *cigExchange.APIError {
+		before, apiError := fetchOfferingForAudit(tx, offering.ID)
+		if apiError != nil {
+			return apiError
+		}
+		db := tx.Delete(offering)
+		if db.Error != nil {
+			return cigExchange.NewDatabaseError("Failed to delete offering", db.Error)
+		}
+		if db.RowsAffected == 0 {
+			return cigExchange.NewInvalidFieldError("offering_id", "Offering with provided id doesn't exist")
+		}
+		if apiError = createOfferingAudit(ctx, tx, cigExchange.AuditOperationDelete, before, &Offering{}); apiError != nil {
+			return apiError
+		}
+		return createEvent(tx, EventTypeOfferingDeleted, offering.ID, map[string]interface{}{"id": offering.ID})
+	})
+}
+
+// SetVisibility shows or hides the offering.
+// Offering can be made visible only if it passes Validate, so incomplete drafts stay hidden.
+// Offerings of suspended organisations can't be made visible
+func SetVisibility(offeringID string, visible bool) *cigExchange.APIError {
+
+	// check that UUID is set
+	if len(offeringID) == 0 {
+		return cigExchange.NewInvalidFieldError("offering_id", "Offering id is invalid")
+	}
+
+	if visible {
+		offering, apiError := GetOffering(offeringID)
+		if apiError != nil {
+			return apiError
+		}
+		if offering.Organisation.Status == OrganisationStatusSuspended {
+			return cigExchange.NewInvalidFieldError("offering_id", "Offering of suspended organisation can't be made visible")
+		}
+		if apiError = offering.Validate(); apiError != nil {
+			return apiError
+		}
+	}
+
+	// manual change overrides the visibility restored on organisation unsuspend
+	update := map[string]interface{}{
+		"is_visible":           visible,
+		"hidden_by_suspension": false,
+	}
+	payload := updateEventPayload(offeringID, update)
+	return cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		before, apiError := fetchOfferingForAudit(tx, offeringID)
+		if apiError != nil {
+			return apiError
+		}
+		db := tx.Model(&Offering{ID: offeringID}).Updates(update)
+		if db.Error != nil {
+			return cigExchange.NewDatabaseError("Failed to update offering visibility", db.Error)
+		}
+		after := *before
+		after.IsVisible = visible
+		if apiError = createOfferingAudit(context.Background(), tx, cigExchange.AuditOperationUpdate, before, &after); apiError != nil {
+			return apiError
+		}
+		return createEvent(tx, EventTypeOfferingUpdated, offeringID, payload)
+	})
+}
+
+// RegenerateSlug generates a new slug from the current english title and saves it in db
+func (offering *Offering) RegenerateSlug() *cigExchange.APIError {
 
 	// check that UUID is set
 	if len(offering.ID) == 0 {
 		return cigExchange.NewInvalidFieldError("offering_id", "Offering id is invalid")
 	}
 
-	db := cigExchange.GetDB().Delete(offering)
+	return offering.saveWithUniqueSlug(true, func() (bool, *cigExchange.APIError) {
+		db := cigExchange.GetDB().Model(offering).Update("slug", offering.Slug)
+		if db.Error != nil {
+			if cigExchange.IsUniqueConstraintViolation(db.Error, offeringSlugIndex) {
+				return true, cigExchange.NewInvalidFieldError("slug", "Offering slug already in use")
+			}
+			return false, cigExchange.NewDatabaseError("Failed to update offering slug", db.Error)
+		}
+		return false, nil
+	})
+}
+
+// offeringSlugAttempts limits the slug generation retries when concurrent requests take the generated slug
+const offeringSlugAttempts = 3
+
+// saveWithUniqueSlug generates the slug with generateSlug and runs save.
+// generateSlug only picks a slug that is free at the moment, the unique index decides between concurrent requests,
+// so the slug is generated again while save reports the slug index conflict
+func (offering *Offering) saveWithUniqueSlug(fromTitle bool, save func() (bool, *cigExchange.APIError)) *cigExchange.APIError {
+
+	for attempt := 1; ; attempt++ {
+		apiError := offering.generateSlug(fromTitle)
+		if apiError != nil {
+			return apiError
+		}
+		slugConflict, apiError := save()
+		if !slugConflict || attempt >= offeringSlugAttempts {
+			return apiError
+		}
+	}
+}
+
+// generateSlug fills unique slug from the english title if fromTitle is true,
+// otherwise the provided slug is normalized, offering without slug is left as is
+func (offering *Offering) generateSlug(fromTitle bool) *cigExchange.APIError {
+
+	base := ""
+	if fromTitle {
+		title := cigExchange.MultilangString{}
+		if len(offering.Title.RawMessage) > 0 {
+			if err := json.Unmarshal(offering.Title.RawMessage, &title); err != nil {
+				return cigExchange.NewRequestDecodingError(err)
+			}
+		}
+		base = Slugify(title.En)
+		// offering without english title has no slug
+		if len(base) == 0 {
+			offering.Slug = nil
+			return nil
+		}
+	} else {
+		if offering.Slug == nil {
+			return nil
+		}
+		base = Slugify(*offering.Slug)
+		if len(base) == 0 {
+			return cigExchange.NewInvalidFieldError("slug", "Slug is invalid")
+		}
+	}
+
+	// query slugs with the same base
+	slugs := make([]string, 0)
+	db := cigExchange.GetDB().Model(&Offering{}).Where("(slug = ? OR slug LIKE ?) AND id <> ?", base, base+"-%", offering.ID).Pluck("slug", &slugs)
+	if db.Error != nil && !db.RecordNotFound() {
+		return cigExchange.NewDatabaseError("Fetch offering slugs failed", db.Error)
+	}
+
+	usedSlugs := make(map[string]bool)
+	for _, slug := range slugs {
+		usedSlugs[slug] = true
+	}
+
+	// deduplicate with numeric suffix
+	slug := base
+	for i := 2; usedSlugs[slug]; i++ {
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+	offering.Slug = &slug
+	return nil
+}
+
+// slugAccentsReplacer replaces common accented latin letters
+var slugAccentsReplacer = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ä", "a", "ã", "a", "å", "a",
+	"è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i",
+	"ò", "o", "ó", "o", "ô", "o", "ö", "o", "õ", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n", "ß", "ss",
+)
+
+// Slugify converts text to lowercase hyphenated slug containing only latin letters and digits
+func Slugify(text string) string {
+
+	text = slugAccentsReplacer.Replace(strings.ToLower(strings.TrimSpace(text)))
+
+	var builder strings.Builder
+	hyphen := false
+	for _, r := range text {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			builder.WriteRune(r)
+			hyphen = false
+		} else if !hyphen && builder.Len() > 0 {
+			builder.WriteRune('-')
+			hyphen = true
+		}
+	}
+	return strings.TrimSuffix(builder.String(), "-")
+}
+
+// offeringSlugIndex is the unique index of the offering slug
+const offeringSlugIndex = "offering_slug_unique_idx"
+
+// CreateOfferingIndexes creates the offering table indexes.
+// Slug is unique among not deleted offerings, existing slugs are normalized and deduplicated first
+func CreateOfferingIndexes() *cigExchange.APIError {
+
+	apiError := normalizeOfferingSlugs()
+	if apiError != nil {
+		return apiError
+	}
+
+	query := `CREATE UNIQUE INDEX IF NOT EXISTS ` + offeringSlugIndex + ` ON public.offering (slug)
+		WHERE deleted_at IS NULL AND slug IS NOT NULL;`
+	db := cigExchange.GetDB().Exec(query)
 	if db.Error != nil {
-		return cigExchange.NewDatabaseError("Failed to delete offering", db.Error)
+		return cigExchange.NewDatabaseError("Failed to create offering slug index", db.Error)
+	}
+	return nil
+}
+
+// normalizeOfferingSlugs converts the free form slugs of not deleted offerings with Slugify
+// and adds the numeric suffix to duplicates. Older offerings and already normalized slugs keep their slug
+func normalizeOfferingSlugs() *cigExchange.APIError {
+
+	type storedSlug struct {
+		ID   string
+		Slug string
 	}
-	if db.RowsAffected == 0 {
-		return cigExchange.NewInvalidFieldError("offering_id", "Offering with provided id doesn't exist")
+	stored := make([]*storedSlug, 0)
+	db := cigExchange.GetDB().Model(&Offering{}).Select("id, slug").
+		Where("slug IS NOT NULL").Order("created_at").Order("id").Scan(&stored)
+	if db.Error != nil && !db.RecordNotFound() {
+		return cigExchange.NewDatabaseError("Fetch offering slugs failed", db.Error)
+	}
+
+	// normalized slugs are claimed first, so they don't change
+	usedSlugs := make(map[string]bool)
+	unclaimed := make([]*storedSlug, 0)
+	for _, offering := range stored {
+		if offering.Slug == Slugify(offering.Slug) && len(offering.Slug) > 0 && !usedSlugs[offering.Slug] {
+			usedSlugs[offering.Slug] = true
+			continue
+		}
+		unclaimed = append(unclaimed, offering)
+	}
+
+	for _, offering := range unclaimed {
+		var slug *string
+		base := Slugify(offering.Slug)
+		// slug without letters and digits is removed
+		if len(base) > 0 {
+			candidate := base
+			for i := 2; usedSlugs[candidate]; i++ {
+				candidate = fmt.Sprintf("%s-%d", base, i)
+			}
+			usedSlugs[candidate] = true
+			slug = &candidate
+		}
+
+		db = cigExchange.GetDB().Model(&Offering{ID: offering.ID}).UpdateColumn("slug", slug)
+		if db.Error != nil {
+			return cigExchange.NewDatabaseError("Failed to normalize offering slug", db.Error)
+		}
 	}
 	return nil
 }
 
+// GetOfferingBySlug queries a single offering by slug from db
+func GetOfferingBySlug(slug string) (*Offering, *cigExchange.APIError) {
+	return GetOfferingBySlugCtx(context.Background(), slug)
+}
+
+// GetOfferingBySlugCtx queries a single offering by slug from db with the context
+func GetOfferingBySlugCtx(ctx context.Context, slug string) (*Offering, *cigExchange.APIError) {
+	return getOfferingBySlugCtx(ctx, slug, false)
+}
+
+// GetPublicOfferingBySlug queries a single visible offering of verified organisation by slug from db
+func GetPublicOfferingBySlug(slug string) (*Offering, *cigExchange.APIError) {
+	return GetPublicOfferingBySlugCtx(context.Background(), slug)
+}
+
+// GetPublicOfferingBySlugCtx queries a single visible offering of verified organisation by slug from db with the context
+func GetPublicOfferingBySlugCtx(ctx context.Context, slug string) (*Offering, *cigExchange.APIError) {
+	return getOfferingBySlugCtx(ctx, slug, true)
+}
+
+func getOfferingBySlugCtx(ctx context.Context, slug string, publicOnly bool) (*Offering, *cigExchange.APIError) {
+
+	// check that slug is set
+	if len(slug) == 0 {
+		return nil, cigExchange.NewInvalidFieldError("slug", "Slug is invalid")
+	}
+
+	bySlug := func(db *gorm.DB) *gorm.DB {
+		db = db.Where("offering.slug = ?", slug)
+		if publicOnly {
+			db = db.Where("offering.is_visible = ? AND organisation.status = ?", true, OrganisationStatusVerified)
+		}
+		return db
+	}
+	return getOfferingCtx(ctx, bySlug, cigExchange.NewNotFoundError("slug", "Offering with provided slug doesn't exist"))
+}
+
+// Restore restores soft deleted offering in db.
+// Platform admins and admins of the offering organisation can restore the offering.
+// Offerings of deleted organisations can't be restored, slug taken by a live offering is deduplicated
+func (offering *Offering) Restore(userUUID string) *cigExchange.APIError {
+
+	// check that UUID is set
+	if len(offering.ID) == 0 {
+		return cigExchange.NewInvalidFieldError("offering_id", "Offering id is invalid")
+	}
+
+	db := cigExchange.GetDB().Unscoped().Where("deleted_at IS NOT NULL").First(offering)
+	if db.Error != nil {
+		if db.RecordNotFound() {
+			return cigExchange.NewInvalidFieldError("offering_id", "Deleted offering with provided id doesn't exist")
+		}
+		return cigExchange.NewDatabaseError("Fetch deleted offering failed", db.Error)
+	}
+
+	if apiError := checkRestorePermission(userUUID, []string{offering.OrganisationID}); apiError != nil {
+		return apiError
+	}
+
+	// organisation must exist
+	if _, apiError := GetOrganisation(offering.OrganisationID); apiError != nil {
+		return apiError
+	}
+
+	if offering.Slug != nil && len(*offering.Slug) == 0 {
+		offering.Slug = nil
+	}
+	apiError := offering.saveWithUniqueSlug(false, func() (bool, *cigExchange.APIError) {
+		update := map[string]interface{}{
+			"deleted_at": nil,
+			"slug":       offering.Slug,
+		}
+		db := cigExchange.GetDB().Unscoped().Model(offering).Updates(update)
+		if db.Error != nil {
+			if cigExchange.IsUniqueConstraintViolation(db.Error, offeringSlugIndex) {
+				return true, cigExchange.NewInvalidFieldError("slug", "Offering slug already in use")
+			}
+			return false, cigExchange.NewDatabaseError("Failed to restore offering", db.Error)
+		}
+		return false, nil
+	})
+	if apiError != nil {
+		return apiError
+	}
+	offering.DeletedAt = nil
+	return nil
+}
+
+// GetDeletedOfferings queries all soft deleted offerings from db, recently deleted first
+func GetDeletedOfferings() ([]*Offering, *cigExchange.APIError) {
+
+	offerings := make([]*Offering, 0)
+	db := cigExchange.GetDB().Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at desc").Find(&offerings)
+	if db.Error != nil {
+		if !db.RecordNotFound() {
+			return offerings, cigExchange.NewDatabaseError("Fetch deleted offerings failed", db.Error)
+		}
+	}
+	return offerings, nil
+}
+
+// withActiveOrganisation limits the offerings query to offerings of not soft deleted organisations.
+// Offerings of soft deleted organisations are hidden from both list and detail queries
+func withActiveOrganisation(db *gorm.DB) *gorm.DB {
+	return db.Select("offering.*").
+		Joins("JOIN organisation ON organisation.id = offering.organisation_id AND organisation.deleted_at IS NULL")
+}
+
 // GetOffering queries a single offering from db
 func GetOffering(UUID string) (*Offering, *cigExchange.APIError) {
+	return GetOfferingCtx(context.Background(), UUID)
+}
+
+// GetOfferingCtx queries a single offering from db with the context
+func GetOfferingCtx(ctx context.Context, UUID string) (*Offering, *cigExchange.APIError) {
 
-	offering := &Offering{
-		ID: UUID,
+	byID := func(db *gorm.DB) *gorm.DB {
+		return db.Where("offering.id = ?", UUID)
 	}
-	db := cigExchange.GetDB().Preload("Media", "offering_media.deleted_at is NULL").First(offering)
+	return getOfferingCtx(ctx, byID, cigExchange.NewInvalidFieldError("offering_id", "Offering with provided id doesn't exist"))
+}
+
+// getOfferingCtx queries a single offering selected by the where scope with the organisation and media,
+// notFoundError is returned if the offering doesn't exist
+func getOfferingCtx(ctx context.Context, where func(db *gorm.DB) *gorm.DB, notFoundError *cigExchange.APIError) (*Offering, *cigExchange.APIError) {
+
+	offering := &Offering{}
+	db := cigExchange.GetDBWithContext(ctx).Scopes(withActiveOrganisation, where).Preload("Organisation").
+		Preload("Media", "offering_media.deleted_at is NULL").First(offering)
 	if db.Error != nil {
 		if db.RecordNotFound() {
-			return nil, cigExchange.NewInvalidFieldError("offering_id", "Offering with provided id doesn't exist")
+			return nil, notFoundError
 		}
 		return nil, cigExchange.NewDatabaseError("Fetch offering failed", db.Error)
 	}
 
 	// query all offering media for offering
 	offeringMedia := make([]*OfferingMedia, 0)
-	db = cigExchange.GetDB().Where("offering_id = ?", UUID).Find(&offeringMedia)
+	db = cigExchange.GetDBWithContext(ctx).Where("offering_id = ?", offering.ID).Find(&offeringMedia)
 	if db.Error != nil {
 		if !db.RecordNotFound() {
 			return offering, cigExchange.NewDatabaseError("Fetch offering_media failed", db.Error)
@@ -232,9 +772,15 @@ func GetOffering(UUID string) (*Offering, *cigExchange.APIError) {
 
 // GetOfferings queries all offering objects from db
 func GetOfferings() ([]*Offering, *cigExchange.APIError) {
+	return GetOfferingsCtx(context.Background())
+}
+
+// GetOfferingsCtx queries all offering objects from db with the context
+func GetOfferingsCtx(ctx context.Context) ([]*Offering, *cigExchange.APIError) {
 
 	offerings := make([]*Offering, 0)
-	db := cigExchange.GetDB().Preload("Organisation", "organisation.deleted_at is NULL").Preload("Media", "offering_media.deleted_at is NULL").Find(&offerings)
+	db := cigExchange.GetReadDBWithContext(ctx).Scopes(withActiveOrganisation).Preload("Organisation").
+		Preload("Media", "offering_media.deleted_at is NULL").Find(&offerings)
 	if db.Error != nil {
 		if !db.RecordNotFound() {
 			return offerings, cigExchange.NewDatabaseError("Fetch all offerings failed", db.Error)
@@ -243,7 +789,7 @@ func GetOfferings() ([]*Offering, *cigExchange.APIError) {
 
 	// query all offering media
 	offeringMedia := make([]*OfferingMedia, 0)
-	db = cigExchange.GetDB().Find(&offeringMedia)
+	db = cigExchange.GetReadDBWithContext(ctx).Find(&offeringMedia)
 	if db.Error != nil {
 		if !db.RecordNotFound() {
 			return offerings, cigExchange.NewDatabaseError("Fetch offering_media failed", db.Error)
@@ -264,9 +810,15 @@ func GetOfferings() ([]*Offering, *cigExchange.APIError) {
 
 // GetOrganisationOfferings queries all offering objects from db for a given organisation
 func GetOrganisationOfferings(organisationID string) ([]*Offering, *cigExchange.APIError) {
+	return GetOrganisationOfferingsCtx(context.Background(), organisationID)
+}
+
+// GetOrganisationOfferingsCtx queries all offering objects from db for a given organisation with the context
+func GetOrganisationOfferingsCtx(ctx context.Context, organisationID string) ([]*Offering, *cigExchange.APIError) {
 
 	offerings := make([]*Offering, 0)
-	db := cigExchange.GetDB().Preload("Organisation", "organisation.deleted_at is NULL").Preload("Media", "offering_media.deleted_at is NULL").Where(&Offering{OrganisationID: organisationID}).Find(&offerings)
+	db := cigExchange.GetReadDBWithContext(ctx).Scopes(withActiveOrganisation).Preload("Organisation").
+		Preload("Media", "offering_media.deleted_at is NULL").Where(&Offering{OrganisationID: organisationID}).Find(&offerings)
 	if db.Error != nil {
 		if !db.RecordNotFound() {
 			return offerings, cigExchange.NewDatabaseError("Fetch offerings failed", db.Error)
@@ -275,7 +827,7 @@ func GetOrganisationOfferings(organisationID string) ([]*Offering, *cigExchange.
 
 	// query offering media for organisation
 	offeringMedia := make([]*OfferingMedia, 0)
-	db = cigExchange.GetDB().Joins("JOIN offering on offering_media.offering_id=offering.id").Where("offering.organisation_id = ?", organisationID).Find(&offeringMedia)
+	db = cigExchange.GetReadDBWithContext(ctx).Joins("JOIN offering on offering_media.offering_id=offering.id").Where("offering.organisation_id = ?", organisationID).Find(&offeringMedia)
 	if db.Error != nil {
 		if !db.RecordNotFound() {
 			return offerings, cigExchange.NewDatabaseError("Fetch offering_media failed", db.Error)
@@ -293,6 +845,32 @@ func GetOrganisationOfferings(organisationID string) ([]*Offering, *cigExchange.
 	return offerings, nil
 }
 
+// checkInvestmentLimits checks minimum and maximum investment against each other and amount.
+// nil values are unconstrained
+func (offering *Offering) checkInvestmentLimits() *cigExchange.APIError {
+
+	min := offering.MinimumInvestment
+	max := offering.MaximumInvestment
+	amount := offering.Amount
+
+	v := cigExchange.NewValidator().
+		Field("minimum_investment", min, cigExchange.Min(0)).
+		Field("maximum_investment", max, cigExchange.Min(0))
+	if apiErr := v.Error(); apiErr != nil {
+		return apiErr
+	}
+	if min != nil && max != nil && *min > *max {
+		return cigExchange.NewInvalidFieldError("minimum_investment, maximum_investment", "'minimum_investment' can't be bigger than 'maximum_investment'")
+	}
+	if min != nil && amount != nil && *min > *amount {
+		return cigExchange.NewInvalidFieldError("minimum_investment, amount", "'minimum_investment' can't be bigger than 'amount'")
+	}
+	if max != nil && amount != nil && *max > *amount {
+		return cigExchange.NewInvalidFieldError("maximum_investment, amount", "'maximum_investment' can't be bigger than 'amount'")
+	}
+	return nil
+}
+
 func (offering *Offering) checkRemaining() *cigExchange.APIError {
 
 	if offering.Amount == nil {
@@ -307,6 +885,201 @@ func (offering *Offering) checkRemaining() *cigExchange.APIError {
 	return nil
 }
 
+// offeringWithUpdate returns a copy of the stored offering with the updated and cleared amount fields applied,
+// so the amount checks see the values the offering has after the update
+func offeringWithUpdate(stored *Offering, update map[string]interface{}, clearFields []string) (*Offering, *cigExchange.APIError) {
+
+	merged := *stored
+	fields := map[string]**float64{
+		"amount":               &merged.Amount,
+		"amount_already_taken": &merged.AmountAlreadyTaken,
+		"minimum_investment":   &merged.MinimumInvestment,
+		"maximum_investment":   &merged.MaximumInvestment,
+	}
+	for _, field := range clearFields {
+		if target, ok := fields[field]; ok {
+			*target = nil
+		}
+	}
+	for field, target := range fields {
+		value, ok := update[field]
+		if !ok {
+			continue
+		}
+		switch v := value.(type) {
+		case nil:
+			*target = nil
+		case float64:
+			*target = &v
+		case *float64:
+			*target = v
+		case int:
+			number := float64(v)
+			*target = &number
+		case *gorm.SqlExpr:
+			// NULL of the cleared field
+			*target = nil
+		default:
+			return nil, cigExchange.NewInvalidFieldError(field, "Field '"+field+"' is not a number")
+		}
+	}
+	return &merged, nil
+}
+
+// validateRating checks that rating belongs to the rating scale, nil or empty rating means unrated
+func validateRating(rating *string) *cigExchange.APIError {
+
+	if rating == nil || len(*rating) == 0 {
+		return nil
+	}
+	for _, scaleRating := range cigExchange.GetOfferingRatingScale() {
+		if scaleRating == *rating {
+			return nil
+		}
+	}
+	return cigExchange.NewInvalidFieldError("rating", "Rating '"+*rating+"' is not in the rating scale")
+}
+
+// RatingRank returns the rating position in the rating scale, 0 is the best rating.
+// Unrated offerings and unknown ratings rank after all rated offerings
+func RatingRank(rating *string) int {
+
+	scale := cigExchange.GetOfferingRatingScale()
+	if rating == nil {
+		return len(scale)
+	}
+	for i, scaleRating := range scale {
+		if scaleRating == *rating {
+			return i
+		}
+	}
+	return len(scale)
+}
+
+// SortOfferingsByRating sorts offerings from the best to the worst rating, unrated offerings go last
+func SortOfferingsByRating(offerings []*Offering) {
+
+	sort.SliceStable(offerings, func(i, j int) bool {
+		return RatingRank(offerings[i].Rating) < RatingRank(offerings[j].Rating)
+	})
+}
+
+// FilterOfferingsByMinRating returns offerings rated minRating or better
+func FilterOfferingsByMinRating(offerings []*Offering, minRating string) []*Offering {
+
+	minRank := RatingRank(&minRating)
+	unratedRank := len(cigExchange.GetOfferingRatingScale())
+	filtered := make([]*Offering, 0)
+	for _, offering := range offerings {
+		rank := RatingRank(offering.Rating)
+		if rank < unratedRank && rank <= minRank {
+			filtered = append(filtered, offering)
+		}
+	}
+	return filtered
+}
+
+// GeoPoint is a map coordinate stored in Offering.Map
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Validate checks latitude and longitude ranges
+func (point *GeoPoint) Validate() *cigExchange.APIError {
+
+	if point.Lat < -90 || point.Lat > 90 {
+		return cigExchange.NewInvalidFieldError("map.lat", "Latitude must be between -90 and 90")
+	}
+	if point.Lng < -180 || point.Lng > 180 {
+		return cigExchange.NewInvalidFieldError("map.lng", "Longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// parseGeoPoint parses and validates {"lat":..,"lng":..} jsonb, returns nil for empty value
+func parseGeoPoint(raw json.RawMessage) (*GeoPoint, *cigExchange.APIError) {
+
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	// both coordinates are required
+	fields := struct {
+		Lat *float64 `json:"lat"`
+		Lng *float64 `json:"lng"`
+	}{}
+	if err := json.Unmarshal(raw, &fields); err != nil || fields.Lat == nil || fields.Lng == nil {
+		return nil, cigExchange.NewInvalidFieldError("map", "Map must be an object with 'lat' and 'lng' numbers")
+	}
+
+	point := &GeoPoint{Lat: *fields.Lat, Lng: *fields.Lng}
+	if apiErr := point.Validate(); apiErr != nil {
+		return nil, apiErr
+	}
+	return point, nil
+}
+
+// GetMap returns the offering map coordinate, nil if it's not set.
+// Location is a multilanguage text and has no coordinates
+func (offering *Offering) GetMap() (*GeoPoint, *cigExchange.APIError) {
+	return parseGeoPoint(offering.Map.RawMessage)
+}
+
+// SetMap validates and sets the offering map coordinate, nil point clears the map
+func (offering *Offering) SetMap(point *GeoPoint) *cigExchange.APIError {
+
+	if point == nil {
+		offering.Map = postgres.Jsonb{}
+		return nil
+	}
+	if apiErr := point.Validate(); apiErr != nil {
+		return apiErr
+	}
+
+	pointBytes, err := json.Marshal(point)
+	if err != nil {
+		return cigExchange.NewJSONEncodingError(cigExchange.MessageJSONEncoding, err)
+	}
+	offering.Map = postgres.Jsonb{RawMessage: pointBytes}
+	return nil
+}
+
+// OfferingDateLayout is the canonical layout of offering dates (closing_date, current_debt_end_datetime).
+// RFC3339 values are accepted too and truncated to the date
+const OfferingDateLayout = "2006-01-02"
+
+// normalizeDate parses date in OfferingDateLayout or RFC3339 layout and returns it in OfferingDateLayout.
+// nil and empty dates stay unchanged
+func normalizeDate(fieldName string, date *string) (*string, *cigExchange.APIError) {
+
+	if date == nil || len(*date) == 0 {
+		return date, nil
+	}
+
+	parsed, err := time.Parse(OfferingDateLayout, *date)
+	if err != nil {
+		parsed, err = time.Parse(time.RFC3339, *date)
+		if err != nil {
+			return date, cigExchange.NewInvalidFieldError(fieldName, "Invalid date, expected format is YYYY-MM-DD")
+		}
+	}
+
+	normalized := parsed.Format(OfferingDateLayout)
+	return &normalized, nil
+}
+
+// AnnualizeInterest converts interest for the period in months to the annual interest (simple interest).
+// Returns nil if interest or period is missing
+func AnnualizeInterest(interest *float64, periodMonths *int64) *float64 {
+
+	if interest == nil || periodMonths == nil || *periodMonths <= 0 {
+		return nil
+	}
+	annual := *interest * 12 / float64(*periodMonths)
+	return &annual
+}
+
 func createMediaIndexMap(media []*OfferingMedia) map[string]int32 {
 
 	mapMI := make(map[string]int32)
@@ -334,6 +1107,9 @@ func (offering *Offering) processOffering(indexMap map[string]int32) {
 		offering.Remaining = 0
 	}
 
+	// calculate annual interest
+	offering.AnnualInterest = AnnualizeInterest(offering.Interest, offering.Period)
+
 	offering.MediaTypes.OfferingImages = make([]*MediaWithIndex, 0)
 	offering.MediaTypes.OfferingDocuments = make([]*MediaWithIndex, 0)
 
@@ -0,0 +1,203 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"strings"
+	"testing"
+)
+
+func float64Ptr(value float64) *float64 {
+	return &value
+}
+
+func TestOfferingWithUpdateChecksStoredValues(t *testing.T) {
+
+	stored := &Offering{
+		Amount:             float64Ptr(1000),
+		AmountAlreadyTaken: float64Ptr(200),
+		MaximumInvestment:  float64Ptr(500),
+	}
+
+	tests := []struct {
+		name        string
+		update      map[string]interface{}
+		clearFields []string
+		valid       bool
+	}{
+		{"minimum above stored maximum", map[string]interface{}{"minimum_investment": 600.0}, nil, false},
+		{"minimum below stored maximum", map[string]interface{}{"minimum_investment": 100.0}, nil, true},
+		{"amount below stored maximum", map[string]interface{}{"amount": 400.0}, nil, false},
+		{"amount below stored taken amount", map[string]interface{}{"amount": 100.0, "maximum_investment": 50.0}, nil, false},
+		{"taken amount above stored amount", map[string]interface{}{"amount_already_taken": 1500.0}, nil, false},
+		{"cleared maximum", map[string]interface{}{"amount": 400.0}, []string{"maximum_investment"}, true},
+	}
+
+	for _, test := range tests {
+		merged, apiError := offeringWithUpdate(stored, test.update, test.clearFields)
+		if apiError != nil {
+			t.Fatalf("%s: unexpected error %v", test.name, apiError.ToString())
+		}
+		apiError = merged.checkInvestmentLimits()
+		if apiError == nil {
+			apiError = merged.checkRemaining()
+		}
+		if valid := apiError == nil; valid != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, valid)
+		}
+	}
+
+	// stored offering isn't changed
+	if *stored.Amount != 1000 || stored.MinimumInvestment != nil {
+		t.Error("stored offering was modified")
+	}
+}
+
+func TestOfferingWithUpdateRejectsNonNumbers(t *testing.T) {
+
+	_, apiError := offeringWithUpdate(&Offering{}, map[string]interface{}{"amount": "100"}, nil)
+	if apiError == nil {
+		t.Error("string amount accepted")
+	}
+}
+
+func TestUpdateWithClearRejectsInvalidFields(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		update      map[string]interface{}
+		clearFields []string
+	}{
+		{"not nullable", map[string]interface{}{"id": "offering"}, []string{"title"}},
+		{"updated and cleared", map[string]interface{}{"id": "offering", "rating": "AA"}, []string{"rating"}},
+		{"missing id", map[string]interface{}{}, []string{"closing_date"}},
+	}
+
+	for _, test := range tests {
+		offering := &Offering{ID: "offering"}
+		if apiError := offering.UpdateWithClear(test.update, test.clearFields); apiError == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
+
+func TestUpdateWithClearRatingAndClosingDate(t *testing.T) {
+
+	requireDB(t)
+	organisation := createTestOrganisation(t)
+	offering := createTestOffering(t, organisation.ID, "clear-"+cigExchange.RandomUUID())
+
+	err := cigExchange.GetDB().Model(offering).Updates(map[string]interface{}{"rating": "AA", "closing_date": "2030-01-01"}).Error
+	if err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	apiError := offering.UpdateWithClear(map[string]interface{}{"id": offering.ID}, []string{"rating", "closing_date"})
+	if apiError != nil {
+		t.Fatalf("clear failed: %v", apiError.ToString())
+	}
+
+	stored, apiError := GetOffering(offering.ID)
+	if apiError != nil {
+		t.Fatalf("fetch failed: %v", apiError.ToString())
+	}
+	if stored.Rating != nil {
+		t.Errorf("rating not cleared: %v", *stored.Rating)
+	}
+	if stored.ClosingDate != nil {
+		t.Errorf("closing date not cleared: %v", *stored.ClosingDate)
+	}
+}
+func TestCreateOfferingIndexesNormalizesSlugs(t *testing.T) {
+
+	requireDB(t)
+
+	// free form slugs exist only in data created before the unique index
+	if err := cigExchange.GetDB().Exec("DROP INDEX IF EXISTS " + offeringSlugIndex + ";").Error; err != nil {
+		t.Fatalf("drop index failed: %v", err)
+	}
+	t.Cleanup(func() {
+		if apiError := CreateOfferingIndexes(); apiError != nil {
+			t.Errorf("create index failed: %v", apiError.ToString())
+		}
+	})
+
+	organisation := createTestOrganisation(t)
+	base := "normalize-" + cigExchange.RandomUUID()
+	tests := []struct {
+		slug     string
+		expected string
+	}{
+		{base, base},
+		{" " + strings.ToUpper(base) + " ", base + "-2"},
+		{base, base + "-3"},
+		{"!!!", ""},
+	}
+	offerings := make([]*Offering, 0, len(tests))
+	for _, test := range tests {
+		offerings = append(offerings, createTestOffering(t, organisation.ID, test.slug))
+	}
+
+	if apiError := CreateOfferingIndexes(); apiError != nil {
+		t.Fatalf("migration failed: %v", apiError.ToString())
+	}
+
+	for i, test := range tests {
+		stored := &Offering{}
+		if err := cigExchange.GetDB().Where("id = ?", offerings[i].ID).First(stored).Error; err != nil {
+			t.Fatalf("fetch failed: %v", err)
+		}
+		slug := ""
+		if stored.Slug != nil {
+			slug = *stored.Slug
+		}
+		if slug != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.slug, test.expected, slug)
+		}
+	}
+}
+
+func TestSetVisibilityRequiresValidOffering(t *testing.T) {
+
+	requireDB(t)
+	organisation := createTestOrganisation(t)
+	offering := createTestOffering(t, organisation.ID, "visibility-"+cigExchange.RandomUUID())
+
+	// draft without origin and direct url stays hidden
+	apiError := SetVisibility(offering.ID, true)
+	if apiError == nil {
+		t.Fatal("invalid offering made visible")
+	}
+	missing := make(map[string]bool)
+	for _, nestedError := range apiError.Errors {
+		if nestedError.Reason == cigExchange.ReasonFieldMissing {
+			missing[nestedError.Field] = true
+		}
+	}
+	if !missing["origin"] || !missing["offering_direct_url"] {
+		t.Errorf("expected missing origin and offering_direct_url, got %+v", apiError.Errors)
+	}
+	stored, _ := GetOffering(offering.ID)
+	if stored == nil || stored.IsVisible {
+		t.Fatal("invalid offering is visible")
+	}
+
+	directURL := `{"en":"https://example.com/en","fr":"https://example.com/fr","it":"https://example.com/it","de":"https://example.com/de"}`
+	err := cigExchange.GetDB().Model(offering).Updates(map[string]interface{}{"origin": "test", "offering_direct_url": directURL}).Error
+	if err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	if apiError := SetVisibility(offering.ID, true); apiError != nil {
+		t.Fatalf("valid offering not made visible: %v", apiError.ToString())
+	}
+	stored, _ = GetOffering(offering.ID)
+	if stored == nil || !stored.IsVisible {
+		t.Error("valid offering is hidden")
+	}
+
+	// hiding isn't validated
+	cigExchange.GetDB().Model(offering).Update("origin", "")
+	if apiError := SetVisibility(offering.ID, false); apiError != nil {
+		t.Errorf("offering not hidden: %v", apiError.ToString())
+	}
+}
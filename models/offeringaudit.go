@@ -0,0 +1,117 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// OfferingAudit is a struct to represent an offering change record.
+// Diff stores the changed fields as returned by DiffOffering
+type OfferingAudit struct {
+	ID         string         `json:"id" gorm:"column:id;primary_key"`
+	OfferingID string         `json:"offering_id" gorm:"column:offering_id"`
+	ActorID    string         `json:"actor_id" gorm:"column:actor_id"`
+	Operation  string         `json:"operation" gorm:"column:operation"`
+	Diff       postgres.Jsonb `json:"diff" gorm:"column:diff"`
+	CreatedAt  time.Time      `json:"created_at" gorm:"column:created_at"`
+}
+
+// TableName returns table name for struct
+func (*OfferingAudit) TableName() string {
+	return "offering_audit"
+}
+
+// BeforeCreate generates new unique UUIDs for new db records
+func (*OfferingAudit) BeforeCreate(scope *gorm.Scope) error {
+
+	scope.SetColumn("ID", cigExchange.RandomUUID())
+	return nil
+}
+
+// CreateOfferingAuditIndexes creates the offering_audit table indexes
+func CreateOfferingAuditIndexes() *cigExchange.APIError {
+
+	query := `CREATE INDEX IF NOT EXISTS offering_audit_offering_idx ON public.offering_audit (offering_id, created_at);`
+	db := cigExchange.GetDB().Exec(query)
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Failed to create offering audit index", db.Error)
+	}
+	return nil
+}
+
+// createOfferingAudit inserts the offering change record using db, pass the transaction of the change.
+// The actor is taken from ctx, see cigExchange.ContextWithActor. Updates without changes are not recorded
+func createOfferingAudit(ctx context.Context, db *gorm.DB, operation string, before, after *Offering) *cigExchange.APIError {
+
+	diff, apiError := DiffOffering(before, after)
+	if apiError != nil {
+		return apiError
+	}
+	if operation == cigExchange.AuditOperationUpdate && len(diff) == 0 {
+		return nil
+	}
+
+	diffBytes, err := json.Marshal(diff)
+	if err != nil {
+		return cigExchange.NewJSONEncodingError(cigExchange.MessageJSONEncoding, err)
+	}
+
+	offeringID := after.ID
+	if len(offeringID) == 0 {
+		offeringID = before.ID
+	}
+	audit := &OfferingAudit{
+		OfferingID: offeringID,
+		ActorID:    cigExchange.ActorFromContext(ctx),
+		Operation:  operation,
+		Diff:       postgres.Jsonb{RawMessage: diffBytes},
+	}
+	err = db.Create(audit).Error
+	if err != nil {
+		return cigExchange.NewDatabaseError("Create offering audit failed", err)
+	}
+	return nil
+}
+
+// fetchOfferingForAudit queries the offering state inside the change transaction
+func fetchOfferingForAudit(db *gorm.DB, offeringID string) (*Offering, *cigExchange.APIError) {
+
+	offering := &Offering{
+		ID: offeringID,
+	}
+	db = db.First(offering)
+	if db.Error != nil {
+		if db.RecordNotFound() {
+			return nil, cigExchange.NewInvalidFieldError("offering_id", "Offering with provided id doesn't exist")
+		}
+		return nil, cigExchange.NewDatabaseError("Fetch offering failed", db.Error)
+	}
+	return offering, nil
+}
+
+// GetOfferingAudit queries the change history of the offering from db, oldest first
+func GetOfferingAudit(offeringID string) ([]*OfferingAudit, *cigExchange.APIError) {
+	return GetOfferingAuditCtx(context.Background(), offeringID)
+}
+
+// GetOfferingAuditCtx queries the change history of the offering from db with the context
+func GetOfferingAuditCtx(ctx context.Context, offeringID string) ([]*OfferingAudit, *cigExchange.APIError) {
+
+	audits := make([]*OfferingAudit, 0)
+
+	// check that UUID is set
+	if len(offeringID) == 0 {
+		return audits, cigExchange.NewInvalidFieldError("offering_id", "Offering id is invalid")
+	}
+
+	db := cigExchange.GetReadDBWithContext(ctx).Where("offering_id = ?", offeringID).Order("created_at").Find(&audits)
+	if db.Error != nil && !db.RecordNotFound() {
+		return audits, cigExchange.NewDatabaseError("Fetch offering audit failed", db.Error)
+	}
+	return audits, nil
+}
@@ -0,0 +1,216 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// offeringMediaSeparator separates media urls in the "images" and "documents" columns
+const offeringMediaSeparator = " "
+
+// offeringExportColumns returns the export columns in the import format order
+func offeringExportColumns() []string {
+
+	columns := []string{"id"}
+	columns = append(columns, offeringStringColumns...)
+	columns = append(columns, offeringFloatColumns...)
+	columns = append(columns, "period", "is_visible", "type", "map_lat", "map_lng")
+	for _, field := range offeringMultilangColumns {
+		for _, lang := range offeringLanguages {
+			columns = append(columns, field+"_"+lang)
+		}
+	}
+	return append(columns, "images", "documents")
+}
+
+// ExportOfferings writes all offerings of the organisation to w as CSV or JSON in the ImportOfferings format.
+// Offerings are streamed from db one by one. Media are exported as space separated urls and are not imported back
+func ExportOfferings(orgID string, format string, w io.Writer) *cigExchange.APIError {
+
+	if format != OfferingFormatCSV && format != OfferingFormatJSON {
+		return cigExchange.NewInvalidFieldError("format", "Format must be 'csv' or 'json'")
+	}
+
+	if _, apiError := GetOrganisation(orgID); apiError != nil {
+		return apiError
+	}
+
+	rows, err := cigExchange.GetReadDB().Model(&Offering{}).Where("organisation_id = ?", orgID).Order("created_at").Rows()
+	if err != nil {
+		return cigExchange.NewDatabaseError("Fetch offerings failed", err)
+	}
+	defer rows.Close()
+
+	columns := offeringExportColumns()
+	var csvWriter *csv.Writer
+	if format == OfferingFormatCSV {
+		csvWriter = csv.NewWriter(w)
+		if err := csvWriter.Write(columns); err != nil {
+			return cigExchange.NewInternalServerError(cigExchange.ReasonReadFailure, "Export write failed: "+err.Error())
+		}
+	} else if _, err := io.WriteString(w, "["); err != nil {
+		return cigExchange.NewInternalServerError(cigExchange.ReasonReadFailure, "Export write failed: "+err.Error())
+	}
+
+	first := true
+	for rows.Next() {
+		offering := &Offering{}
+		if err := cigExchange.GetReadDB().ScanRows(rows, offering); err != nil {
+			return cigExchange.NewDatabaseError("Fetch offerings failed", err)
+		}
+
+		row, apiError := offeringToRow(offering)
+		if apiError != nil {
+			return apiError
+		}
+
+		if csvWriter != nil {
+			record := make([]string, len(columns))
+			for i, column := range columns {
+				record[i] = row[column]
+			}
+			err = csvWriter.Write(record)
+		} else {
+			// empty values are omitted in JSON
+			for column, value := range row {
+				if len(value) == 0 {
+					delete(row, column)
+				}
+			}
+			var jsonBytes []byte
+			jsonBytes, err = json.Marshal(row)
+			if err == nil {
+				if !first {
+					jsonBytes = append([]byte(","), jsonBytes...)
+				}
+				_, err = w.Write(jsonBytes)
+			}
+		}
+		if err != nil {
+			return cigExchange.NewInternalServerError(cigExchange.ReasonReadFailure, "Export write failed: "+err.Error())
+		}
+		first = false
+	}
+	if err := rows.Err(); err != nil {
+		return cigExchange.NewDatabaseError("Fetch offerings failed", err)
+	}
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+		err = csvWriter.Error()
+	} else {
+		_, err = io.WriteString(w, "]")
+	}
+	if err != nil {
+		return cigExchange.NewInternalServerError(cigExchange.ReasonReadFailure, "Export write failed: "+err.Error())
+	}
+	return nil
+}
+
+// offeringToRow converts the offering to the export row with media urls
+func offeringToRow(offering *Offering) (map[string]string, *cigExchange.APIError) {
+
+	row := map[string]string{
+		"id":                        offering.ID,
+		"rating":                    stringValue(offering.Rating),
+		"slug":                      stringValue(offering.Slug),
+		"origin":                    offering.Origin,
+		"closing_date":              stringValue(offering.ClosingDate),
+		"current_debt_end_datetime": stringValue(offering.CurrentDebtEndDatetime),
+		"amount":                    floatValue(offering.Amount),
+		"interest":                  floatValue(offering.Interest),
+		"amount_already_taken":      floatValue(offering.AmountAlreadyTaken),
+		"minimum_investment":        floatValue(offering.MinimumInvestment),
+		"maximum_investment":        floatValue(offering.MaximumInvestment),
+		"transaction_fee":           floatValue(offering.TransactionFee),
+		"p2p_fee":                   floatValue(offering.P2PFee),
+		"referral_reward":           floatValue(offering.ReferralReward),
+		"is_visible":                strconv.FormatBool(offering.IsVisible),
+		"type":                      strings.Join(offering.Type, offeringTypeSeparator),
+	}
+	if offering.Period != nil {
+		row["period"] = strconv.FormatInt(*offering.Period, 10)
+	}
+
+	geoPoint, apiError := offering.GetMap()
+	if apiError != nil {
+		return nil, apiError
+	}
+	if geoPoint != nil {
+		row["map_lat"] = strconv.FormatFloat(geoPoint.Lat, 'f', -1, 64)
+		row["map_lng"] = strconv.FormatFloat(geoPoint.Lng, 'f', -1, 64)
+	}
+
+	multilangValues := map[string]postgres.Jsonb{
+		"title":               offering.Title,
+		"description":         offering.Description,
+		"location":            offering.Location,
+		"tagline1":            offering.Tagline1,
+		"tagline2":            offering.Tagline2,
+		"tagline3":            offering.Tagline3,
+		"current_debt_level":  offering.CurrentDebtLevel,
+		"offering_direct_url": offering.OfferingDirectURL,
+	}
+	for field, value := range multilangValues {
+		mString, apiError := cigExchange.ParseMultilangString(field, value.RawMessage)
+		if apiError != nil {
+			return nil, apiError
+		}
+		row[field+"_en"] = mString.En
+		row[field+"_fr"] = mString.Fr
+		row[field+"_it"] = mString.It
+		row[field+"_de"] = mString.De
+	}
+
+	// media urls in the offering order
+	mediaRows, err := cigExchange.GetReadDB().Table("media").Select("media.type, media.url").
+		Joins("JOIN offering_media ON offering_media.media_id = media.id AND offering_media.deleted_at IS NULL").
+		Where("offering_media.offering_id = ? AND media.deleted_at IS NULL", offering.ID).
+		Order("offering_media.index").Rows()
+	if err != nil {
+		return nil, cigExchange.NewDatabaseError("Fetch offering media failed", err)
+	}
+	defer mediaRows.Close()
+
+	images := make([]string, 0)
+	documents := make([]string, 0)
+	for mediaRows.Next() {
+		var mediaType, url string
+		if err := mediaRows.Scan(&mediaType, &url); err != nil {
+			return nil, cigExchange.NewDatabaseError("Fetch offering media failed", err)
+		}
+		if mediaType == MediaTypeImage {
+			images = append(images, url)
+		} else if mediaType == MediaTypeDocument {
+			documents = append(documents, url)
+		}
+	}
+	row["images"] = strings.Join(images, offeringMediaSeparator)
+	row["documents"] = strings.Join(documents, offeringMediaSeparator)
+
+	return row, nil
+}
+
+// stringValue returns the string or empty string for nil
+func stringValue(value *string) string {
+
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// floatValue formats the number without precision loss or returns empty string for nil
+func floatValue(value *float64) string {
+
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
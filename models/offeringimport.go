@@ -0,0 +1,320 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Constants defining the offerings import file format
+const (
+	OfferingFormatCSV  = "csv"
+	OfferingFormatJSON = "json"
+)
+
+// Offerings import rows are flat, multilang fields use "<field>_<lang>" columns (title_en, title_fr, ...),
+// "type" values are separated with "|" and the map point uses "map_lat" and "map_lng" columns
+var (
+	offeringMultilangColumns = []string{"title", "description", "location", "tagline1", "tagline2", "tagline3", "current_debt_level", "offering_direct_url"}
+	offeringLanguages        = []string{"en", "fr", "it", "de"}
+	offeringStringColumns    = []string{"rating", "slug", "origin", "closing_date", "current_debt_end_datetime"}
+	offeringFloatColumns     = []string{"amount", "interest", "amount_already_taken", "minimum_investment", "maximum_investment", "transaction_fee", "p2p_fee", "referral_reward"}
+	// offeringIgnoredColumns are accepted in the import file but not imported
+	offeringIgnoredColumns = []string{"id", "organisation_id", "images", "documents"}
+)
+
+// offeringTypeSeparator separates offering types in the "type" column
+const offeringTypeSeparator = "|"
+
+// ImportOfferings creates offerings of the organisation from the CSV or JSON file.
+// CSV file has a header row, JSON file is an array of objects with the same columns.
+// Rows are validated and created one by one, errors are returned for the failed rows only
+// with the 1-based row number in the field name, e.g. "row[3].title"
+func ImportOfferings(orgID string, r io.Reader, format string) ([]*Offering, []*cigExchange.APIError) {
+
+	offerings := make([]*Offering, 0)
+	apiErrors := make([]*cigExchange.APIError, 0)
+
+	if _, apiError := GetOrganisation(orgID); apiError != nil {
+		return offerings, append(apiErrors, apiError)
+	}
+
+	rows, apiError := readOfferingRows(r, format)
+	if apiError != nil {
+		return offerings, append(apiErrors, apiError)
+	}
+
+	for i, row := range rows {
+		offering, apiError := offeringFromRow(orgID, row)
+		if apiError == nil {
+			apiError = offering.Create()
+		}
+		if apiError != nil {
+			apiErrors = append(apiErrors, withRowNumber(apiError, i+1))
+			continue
+		}
+		offerings = append(offerings, offering)
+	}
+	return offerings, apiErrors
+}
+
+// withRowNumber prefixes the nested errors field names with the row number
+func withRowNumber(apiError *cigExchange.APIError, row int) *cigExchange.APIError {
+
+	prefix := fmt.Sprintf("row[%d]", row)
+	for _, nested := range apiError.Errors {
+		if len(nested.Field) == 0 {
+			nested.Field = prefix
+		} else {
+			nested.Field = prefix + "." + nested.Field
+		}
+	}
+	return apiError
+}
+
+// readOfferingRows reads all rows of the import file as column to value maps
+func readOfferingRows(r io.Reader, format string) ([]map[string]string, *cigExchange.APIError) {
+
+	rows := make([]map[string]string, 0)
+	switch format {
+	case OfferingFormatCSV:
+		records, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return rows, cigExchange.NewReadError("CSV parsing failed", err)
+		}
+		if len(records) == 0 {
+			return rows, nil
+		}
+		header := records[0]
+		for _, record := range records[1:] {
+			row := make(map[string]string, len(header))
+			for i, column := range header {
+				row[strings.TrimSpace(column)] = record[i]
+			}
+			rows = append(rows, row)
+		}
+	case OfferingFormatJSON:
+		objects := make([]map[string]interface{}, 0)
+		decoder := json.NewDecoder(r)
+		decoder.UseNumber()
+		if err := decoder.Decode(&objects); err != nil {
+			return rows, cigExchange.NewRequestDecodingError(err)
+		}
+		for _, object := range objects {
+			row := make(map[string]string, len(object))
+			for column, value := range object {
+				switch v := value.(type) {
+				case nil:
+					row[column] = ""
+				case string:
+					row[column] = v
+				case []interface{}:
+					values := make([]string, 0, len(v))
+					for _, item := range v {
+						values = append(values, fmt.Sprint(item))
+					}
+					row[column] = strings.Join(values, offeringTypeSeparator)
+				default:
+					row[column] = fmt.Sprint(v)
+				}
+			}
+			rows = append(rows, row)
+		}
+	default:
+		return rows, cigExchange.NewInvalidFieldError("format", "Format must be 'csv' or 'json'")
+	}
+	return rows, nil
+}
+
+// offeringFromRow converts the import row to the organisation offering, empty values are skipped
+func offeringFromRow(orgID string, row map[string]string) (*Offering, *cigExchange.APIError) {
+
+	values := make(map[string]interface{})
+	geoPoint := make(map[string]float64)
+	for column, value := range row {
+		value = strings.TrimSpace(value)
+		if len(value) == 0 || slices.Contains(offeringIgnoredColumns, column) {
+			continue
+		}
+
+		switch {
+		case slices.Contains(offeringStringColumns, column):
+			values[column] = value
+		case slices.Contains(offeringFloatColumns, column):
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, cigExchange.NewInvalidFieldError(column, "Field '"+column+"' must be a number")
+			}
+			values[column] = number
+		case column == "period":
+			period, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, cigExchange.NewInvalidFieldError(column, "Field 'period' must be an integer")
+			}
+			values[column] = period
+		case column == "is_visible":
+			visible, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, cigExchange.NewInvalidFieldError(column, "Field 'is_visible' must be a boolean")
+			}
+			values[column] = visible
+		case column == "type":
+			values[column] = strings.Split(value, offeringTypeSeparator)
+		case column == "map_lat" || column == "map_lng":
+			coordinate, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, cigExchange.NewInvalidFieldError(column, "Field '"+column+"' must be a number")
+			}
+			geoPoint[strings.TrimPrefix(column, "map_")] = coordinate
+		default:
+			// multilang column "<field>_<lang>"
+			i := strings.LastIndex(column, "_")
+			if i < 0 || !slices.Contains(offeringMultilangColumns, column[:i]) || !slices.Contains(offeringLanguages, column[i+1:]) {
+				return nil, cigExchange.NewInvalidFieldError(column, "Unknown column '"+column+"'")
+			}
+			field, lang := column[:i], column[i+1:]
+			multilang, ok := values[field].(map[string]string)
+			if !ok {
+				multilang = make(map[string]string)
+				values[field] = multilang
+			}
+			multilang[lang] = value
+		}
+	}
+
+	if len(geoPoint) > 0 {
+		if len(geoPoint) != 2 {
+			return nil, cigExchange.NewRequiredFieldError([]string{"map_lat", "map_lng"})
+		}
+		values["map"] = geoPoint
+	}
+
+	jsonBytes, err := json.Marshal(values)
+	if err != nil {
+		return nil, cigExchange.NewJSONEncodingError(cigExchange.MessageJSONEncoding, err)
+	}
+	offering := &Offering{}
+	if err := json.Unmarshal(jsonBytes, offering); err != nil {
+		return nil, cigExchange.NewRequestDecodingError(err)
+	}
+	offering.OrganisationID = orgID
+	return offering, nil
+}
+
+// DiffOffering returns the fields of the incoming offering that differ from the existing one
+// as json field name to {"old": value, "new": value}, so the import can be previewed before applying.
+// Multilang and map fields are compared by content. Missing incoming values (nil pointers, empty multilang fields,
+// origin and type) mean "no change", existing offerings loaded with processOffering have 0 instead of nil amounts
+func DiffOffering(existing, incoming *Offering) (map[string]interface{}, *cigExchange.APIError) {
+
+	diff := make(map[string]interface{})
+	if existing == nil || incoming == nil {
+		return diff, cigExchange.NewInvalidFieldError("offering", "Offering is missing")
+	}
+
+	addDiff := func(field string, oldValue, newValue interface{}) {
+		diff[field] = map[string]interface{}{
+			"old": oldValue,
+			"new": newValue,
+		}
+	}
+
+	stringFields := map[string][2]*string{
+		"rating":                    {existing.Rating, incoming.Rating},
+		"slug":                      {existing.Slug, incoming.Slug},
+		"closing_date":              {existing.ClosingDate, incoming.ClosingDate},
+		"current_debt_end_datetime": {existing.CurrentDebtEndDatetime, incoming.CurrentDebtEndDatetime},
+	}
+	for field, values := range stringFields {
+		if values[1] != nil && !pointersEqual(values[0], values[1]) {
+			addDiff(field, values[0], values[1])
+		}
+	}
+
+	floatFields := map[string][2]*float64{
+		"amount":               {existing.Amount, incoming.Amount},
+		"interest":             {existing.Interest, incoming.Interest},
+		"amount_already_taken": {existing.AmountAlreadyTaken, incoming.AmountAlreadyTaken},
+		"minimum_investment":   {existing.MinimumInvestment, incoming.MinimumInvestment},
+		"maximum_investment":   {existing.MaximumInvestment, incoming.MaximumInvestment},
+		"transaction_fee":      {existing.TransactionFee, incoming.TransactionFee},
+		"p2p_fee":              {existing.P2PFee, incoming.P2PFee},
+		"referral_reward":      {existing.ReferralReward, incoming.ReferralReward},
+	}
+	for field, values := range floatFields {
+		if values[1] != nil && !pointersEqual(values[0], values[1]) {
+			addDiff(field, values[0], values[1])
+		}
+	}
+
+	if incoming.Period != nil && !pointersEqual(existing.Period, incoming.Period) {
+		addDiff("period", existing.Period, incoming.Period)
+	}
+	if len(incoming.Origin) > 0 && existing.Origin != incoming.Origin {
+		addDiff("origin", existing.Origin, incoming.Origin)
+	}
+	if existing.IsVisible != incoming.IsVisible {
+		addDiff("is_visible", existing.IsVisible, incoming.IsVisible)
+	}
+	// types order is not meaningful
+	existingTypes := slices.Sorted(slices.Values(existing.Type))
+	incomingTypes := slices.Sorted(slices.Values(incoming.Type))
+	if len(incomingTypes) > 0 && !slices.Equal(existingTypes, incomingTypes) {
+		addDiff("type", existing.Type, incoming.Type)
+	}
+
+	existingMap, apiError := existing.GetMap()
+	if apiError != nil {
+		return diff, apiError
+	}
+	incomingMap, apiError := incoming.GetMap()
+	if apiError != nil {
+		return diff, apiError
+	}
+	if incomingMap != nil && !pointersEqual(existingMap, incomingMap) {
+		addDiff("map", existingMap, incomingMap)
+	}
+
+	multilangFields := map[string][2]json.RawMessage{
+		"title":               {existing.Title.RawMessage, incoming.Title.RawMessage},
+		"description":         {existing.Description.RawMessage, incoming.Description.RawMessage},
+		"location":            {existing.Location.RawMessage, incoming.Location.RawMessage},
+		"tagline1":            {existing.Tagline1.RawMessage, incoming.Tagline1.RawMessage},
+		"tagline2":            {existing.Tagline2.RawMessage, incoming.Tagline2.RawMessage},
+		"tagline3":            {existing.Tagline3.RawMessage, incoming.Tagline3.RawMessage},
+		"current_debt_level":  {existing.CurrentDebtLevel.RawMessage, incoming.CurrentDebtLevel.RawMessage},
+		"offering_direct_url": {existing.OfferingDirectURL.RawMessage, incoming.OfferingDirectURL.RawMessage},
+	}
+	for field, values := range multilangFields {
+		if len(values[1]) == 0 {
+			continue
+		}
+		existingString, apiError := cigExchange.ParseMultilangString(field, values[0])
+		if apiError != nil {
+			return diff, apiError
+		}
+		incomingString, apiError := cigExchange.ParseMultilangString(field, values[1])
+		if apiError != nil {
+			return diff, apiError
+		}
+		if *existingString != *incomingString {
+			addDiff(field, existingString, incomingString)
+		}
+	}
+
+	return diff, nil
+}
+
+// pointersEqual compares the pointed values, nil is equal only to nil
+func pointersEqual[T comparable](a, b *T) bool {
+
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestDiffOfferingMissingColumnsUnchanged(t *testing.T) {
+
+	existing := &Offering{Origin: "import"}
+	existing.processOffering(make(map[string]int32))
+
+	// only the interest column is present in the import row
+	incoming, apiError := offeringFromRow("org", map[string]string{"interest": "5"})
+	if apiError != nil {
+		t.Fatalf("unexpected error %v", apiError.ToString())
+	}
+
+	diff, apiError := DiffOffering(existing, incoming)
+	if apiError != nil {
+		t.Fatalf("unexpected error %v", apiError.ToString())
+	}
+	if len(diff) != 1 || diff["interest"] == nil {
+		t.Errorf("expected only interest diff, got %v", diff)
+	}
+}
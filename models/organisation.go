@@ -2,10 +2,10 @@ package models
 
 import (
 	cigExchange "cig-exchange-libs"
+	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
-	"log"
+	"net/url"
 	"sort"
 	"strings"
 	"time"
@@ -24,6 +24,14 @@ const (
 const (
 	OrganisationStatusVerified   = "verified"
 	OrganisationStatusUnverified = "unverified"
+	OrganisationStatusSuspended  = "suspended"
+)
+
+// Constants defining the organisation multi-factor authentication policy.
+// OTP is always required, WebAuthn policy requires a security key after the OTP for all members
+const (
+	OrganisationMFAPolicyOTP      = "otp"
+	OrganisationMFAPolicyWebAuthn = "otp_webauthn"
 )
 
 // Organisation is a struct to represent an organisation
@@ -35,6 +43,8 @@ type Organisation struct {
 	ReferenceKey              string         `json:"reference_key" gorm:"column:reference_key"`
 	OfferingRatingDescription postgres.Jsonb `json:"offering_rating_description" gorm:"column:offering_rating_description"`
 	Status                    string         `json:"status" gorm:"column:status;default:'unverified'"`
+	MFAPolicy                 string         `json:"mfa_policy" gorm:"column:mfa_policy;default:'otp'"`
+	StatusBeforeSuspension    string         `json:"-" gorm:"column:status_before_suspension"`
 	CreatedAt                 time.Time      `json:"created_at" gorm:"column:created_at"`
 	UpdatedAt                 time.Time      `json:"updated_at" gorm:"column:updated_at"`
 	DeletedAt                 *time.Time     `json:"-" gorm:"column:deleted_at"`
@@ -58,8 +68,50 @@ func (*Organisation) GetMultilangFields() []string {
 	return []string{"offering_rating_description"}
 }
 
+// GetOfferingRatingDescription returns the offering rating description in all languages
+func (organisation *Organisation) GetOfferingRatingDescription() (*cigExchange.MultilangString, *cigExchange.APIError) {
+	return cigExchange.ParseMultilangString("offering_rating_description", organisation.OfferingRatingDescription.RawMessage)
+}
+
+// SetOfferingRatingDescription sets the offering rating description in all languages
+func (organisation *Organisation) SetOfferingRatingDescription(description *cigExchange.MultilangString) *cigExchange.APIError {
+
+	if description == nil {
+		description = &cigExchange.MultilangString{}
+	}
+
+	descriptionBytes, err := json.Marshal(description)
+	if err != nil {
+		return cigExchange.NewJSONEncodingError(cigExchange.MessageJSONEncoding, err)
+	}
+	organisation.OfferingRatingDescription = postgres.Jsonb{RawMessage: descriptionBytes}
+	return nil
+}
+
+// validateOfferingRatingDescription checks the offering rating description jsonb shape
+func validateOfferingRatingDescription(value interface{}) *cigExchange.APIError {
+
+	var raw json.RawMessage
+	switch v := value.(type) {
+	case postgres.Jsonb:
+		raw = v.RawMessage
+	case *postgres.Jsonb:
+		raw = v.RawMessage
+	default:
+		return cigExchange.NewInvalidFieldError("offering_rating_description", "Field 'offering_rating_description' has invalid type")
+	}
+
+	_, apiErr := cigExchange.ParseMultilangString("offering_rating_description", raw)
+	return apiErr
+}
+
 // Create inserts new organisation object into db
 func (organisation *Organisation) Create() *cigExchange.APIError {
+	return organisation.CreateCtx(context.Background())
+}
+
+// CreateCtx inserts new organisation object into db with the context
+func (organisation *Organisation) CreateCtx(ctx context.Context) *cigExchange.APIError {
 
 	// invalidate the uuid
 	organisation.ID = ""
@@ -71,48 +123,318 @@ func (organisation *Organisation) Create() *cigExchange.APIError {
 		return apiErr
 	}
 
-	db := cigExchange.GetDB().Create(organisation)
+	return cigExchange.WithTransactionCtx(ctx, func(tx *gorm.DB) *cigExchange.APIError {
+		err := tx.Create(organisation).Error
+		if err != nil {
+			// reference key is unique among not deleted organisations
+			if cigExchange.IsUniqueConstraintViolation(err, organisationReferenceKeyIndex) {
+				return cigExchange.NewInvalidFieldError("reference_key", "Organisation reference key already in use")
+			}
+			return cigExchange.NewDatabaseError("Failed to create organisation", err)
+		}
+		// reference key is a signup secret and isn't published
+		payload := map[string]interface{}{
+			"id":     organisation.ID,
+			"name":   organisation.Name,
+			"type":   organisation.Type,
+			"status": organisation.Status,
+		}
+		return createEvent(tx, EventTypeOrganisationCreated, organisation.ID, payload)
+	})
+}
+
+// organisationReferenceKeyIndex is the unique index of the organisation reference key
+const organisationReferenceKeyIndex = "organisation_reference_key_unique_idx"
+
+// CreateOrganisationIndexes creates the organisation table indexes.
+// Reference key is unique among not deleted organisations, existing duplicates fail the migration
+func CreateOrganisationIndexes() *cigExchange.APIError {
+
+	apiError := checkUniqueIndexDuplicates("organisation", "reference_key", "deleted_at IS NULL")
+	if apiError != nil {
+		return apiError
+	}
+
+	query := `CREATE UNIQUE INDEX IF NOT EXISTS ` + organisationReferenceKeyIndex + ` ON public.organisation (reference_key)
+		WHERE deleted_at IS NULL;`
+	db := cigExchange.GetDB().Exec(query)
 	if db.Error != nil {
-		return cigExchange.NewDatabaseError("Failed to create organisation", db.Error)
+		return cigExchange.NewDatabaseError("Failed to create organisation reference key index", db.Error)
 	}
 	return nil
 }
 
 // Update existing organisation object in db
 func (organisation *Organisation) Update(update map[string]interface{}) *cigExchange.APIError {
+	return organisation.UpdateCtx(context.Background(), update)
+}
+
+// UpdateCtx updates existing organisation object in db with the context
+func (organisation *Organisation) UpdateCtx(ctx context.Context, update map[string]interface{}) *cigExchange.APIError {
 
 	// check that UUID is set
 	if _, ok := update["id"]; !ok || len(organisation.ID) == 0 {
 		return cigExchange.NewInvalidFieldError("organisation_id", "Invalid organisation id")
 	}
 
-	err := cigExchange.GetDB().Model(organisation).Updates(update).Error
-	if err != nil {
-		return cigExchange.NewDatabaseError("Failed to update organisation ", err)
+	// validate offering rating description if changed
+	if descriptionVal, ok := update["offering_rating_description"]; ok {
+		if apiErr := validateOfferingRatingDescription(descriptionVal); apiErr != nil {
+			return apiErr
+		}
 	}
-	return nil
+
+	// validate mfa policy if changed
+	if policyVal, ok := update["mfa_policy"]; ok {
+		policy, ok := policyVal.(string)
+		if !ok || !isValidMFAPolicy(policy) {
+			return cigExchange.NewInvalidFieldError("mfa_policy", "MFA policy must be 'otp' or 'otp_webauthn'")
+		}
+	}
+
+	// validate website if changed
+	if websiteVal, ok := update["website"]; ok {
+		websiteStr, ok := websiteVal.(string)
+		if !ok {
+			return cigExchange.NewInvalidFieldError("website", "Website is not a string")
+		}
+		website, apiErr := normalizeWebsite(websiteStr)
+		if apiErr != nil {
+			return apiErr
+		}
+		update["website"] = website
+	}
+
+	payload := updateEventPayload(organisation.ID, update)
+	return cigExchange.WithTransactionCtx(ctx, func(tx *gorm.DB) *cigExchange.APIError {
+		err := tx.Model(organisation).Updates(update).Error
+		if err != nil {
+			if cigExchange.IsUniqueConstraintViolation(err, organisationReferenceKeyIndex) {
+				return cigExchange.NewInvalidFieldError("reference_key", "Organisation reference key already in use")
+			}
+			return cigExchange.NewDatabaseError("Failed to update organisation ", err)
+		}
+		return createEvent(tx, EventTypeOrganisationUpdated, organisation.ID, payload)
+	})
 }
 
 // Delete existing organisation object in db
 func (organisation *Organisation) Delete() *cigExchange.APIError {
+	return organisation.DeleteCtx(context.Background())
+}
+
+// DeleteCtx deletes existing organisation object in db with the context
+func (organisation *Organisation) DeleteCtx(ctx context.Context) *cigExchange.APIError {
 
 	// check that UUID is set
 	if len(organisation.ID) == 0 {
 		return cigExchange.NewInvalidFieldError("organisation_id", "Invalid organisation id")
 	}
 
-	db := cigExchange.GetDB().Delete(organisation)
+	return cigExchange.WithTransactionCtx(ctx, func(tx *gorm.DB) *cigExchange.APIError {
+		db := tx.Delete(organisation)
+		if db.Error != nil {
+			return cigExchange.NewDatabaseError("Failed to delete organisation", db.Error)
+		}
+		if db.RowsAffected == 0 {
+			return cigExchange.NewInvalidFieldError("organisation_id", "Organisation with provided id doesn't exist")
+		}
+		return createEvent(tx, EventTypeOrganisationDeleted, organisation.ID, map[string]interface{}{"id": organisation.ID})
+	})
+}
+
+// Restore restores soft deleted organisation in db, only platform admins can restore organisations
+func (organisation *Organisation) Restore(userUUID string) *cigExchange.APIError {
+
+	// check that UUID is set
+	if len(organisation.ID) == 0 {
+		return cigExchange.NewInvalidFieldError("organisation_id", "Invalid organisation id")
+	}
+
+	if apiError := checkRestorePermission(userUUID, nil); apiError != nil {
+		return apiError
+	}
+
+	db := cigExchange.GetDB().Unscoped().Model(organisation).Where("deleted_at IS NOT NULL").Update("deleted_at", nil)
 	if db.Error != nil {
-		return cigExchange.NewDatabaseError("Failed to delete organisation", db.Error)
+		if cigExchange.IsUniqueConstraintViolation(db.Error, organisationReferenceKeyIndex) {
+			return cigExchange.NewInvalidFieldError("reference_key", "Organisation reference key already in use")
+		}
+		return cigExchange.NewDatabaseError("Failed to restore organisation", db.Error)
 	}
 	if db.RowsAffected == 0 {
-		return cigExchange.NewInvalidFieldError("organisation_id", "Organisation with provided id doesn't exist")
+		return cigExchange.NewInvalidFieldError("organisation_id", "Deleted organisation with provided id doesn't exist")
+	}
+	organisation.DeletedAt = nil
+	return nil
+}
+
+// checkRestorePermission returns access forbidden error unless the user is a platform admin
+// or an active admin of all organisations owning the deleted records. Empty organisationIDs allow only platform admins
+func checkRestorePermission(userUUID string, organisationIDs []string) *cigExchange.APIError {
+
+	userRole, apiError := GetUserRole(userUUID)
+	if apiError != nil {
+		return apiError
+	}
+	if userRole == UserRoleAdmin {
+		return nil
+	}
+	if len(organisationIDs) == 0 {
+		return cigExchange.NewAccessForbiddenError("Only platform admins can restore the record")
+	}
+
+	for _, organisationID := range organisationIDs {
+		searchOrgUser := &OrganisationUser{
+			OrganisationID: organisationID,
+			UserID:         userUUID,
+		}
+		orgUser, apiError := searchOrgUser.Find()
+		if apiError != nil {
+			if len(apiError.Errors) > 0 && apiError.Errors[0].Reason == cigExchange.ReasonOrganisationUserDoesntExist {
+				return cigExchange.NewAccessForbiddenError("User doesn't belong to the organisation")
+			}
+			return apiError
+		}
+		if orgUser.Status != OrganisationUserStatusActive || orgUser.OrganisationRole != OrganisationRoleAdmin {
+			return cigExchange.NewAccessForbiddenError("Organisation role '" + OrganisationRoleAdmin + "' is required")
+		}
 	}
 	return nil
 }
 
+// SuspendOrganisation suspends the organisation in a transaction.
+// Visible offerings of the organisation are hidden and, once the suspension is committed,
+// organisation tokens of active members are revoked
+func SuspendOrganisation(orgID string) *cigExchange.APIError {
+
+	organisation, apiError := GetOrganisation(orgID)
+	if apiError != nil {
+		return apiError
+	}
+	if organisation.Status == OrganisationStatusSuspended {
+		return cigExchange.NewInvalidFieldError("organisation_id", "Organisation is already suspended")
+	}
+
+	memberIDs := make([]string, 0)
+	apiError = cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		update := map[string]interface{}{
+			"status":                   OrganisationStatusSuspended,
+			"status_before_suspension": organisation.Status,
+		}
+		err := tx.Model(organisation).Updates(update).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Failed to suspend organisation", err)
+		}
+		apiError := createEvent(tx, EventTypeOrganisationUpdated, orgID, updateEventPayload(orgID, update))
+		if apiError != nil {
+			return apiError
+		}
+
+		// offerings hidden by suspension are shown again on unsuspend
+		update = map[string]interface{}{
+			"is_visible":           false,
+			"hidden_by_suspension": true,
+		}
+		err = tx.Model(&Offering{}).Where("organisation_id = ? AND is_visible = ?", orgID, true).Updates(update).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Failed to hide organisation offerings", err)
+		}
+
+		// members are read in the transaction, so members activated concurrently are not missed
+		orgUserWhere := &OrganisationUser{OrganisationID: orgID, Status: OrganisationUserStatusActive}
+		err = tx.Model(&OrganisationUser{}).Where(orgUserWhere).Pluck("user_id", &memberIDs).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Organisation Users lookup failed", err)
+		}
+		return nil
+	})
+	if apiError != nil {
+		return apiError
+	}
+
+	// tokens are revoked after the commit, so a rolled back suspension keeps them.
+	// Only the organisation sessions are revoked, members stay signed in to their other organisations.
+	// Revocation failures are returned after all members are processed, the organisation
+	// membership check refuses tokens of suspended organisations anyway
+	for _, memberID := range memberIDs {
+		if _, err := cigExchange.GetStore().Del(memberID + "|" + orgID); err != nil {
+			apiError = cigExchange.NewRedisError("Del token failure", err)
+			cigExchange.LogAPIError("SuspendOrganisation: token revocation failed", apiError)
+			continue
+		}
+		if revokeError := cigExchange.RevokeOrganisationSessions(memberID, orgID); revokeError != nil {
+			apiError = revokeError
+			cigExchange.LogAPIError("SuspendOrganisation: sessions revocation failed", apiError)
+		}
+	}
+	return apiError
+}
+
+// UnsuspendOrganisation restores the organisation status from before the suspension in a transaction.
+// Only offerings hidden by the suspension are shown again, manually hidden offerings stay hidden
+func UnsuspendOrganisation(orgID string) *cigExchange.APIError {
+
+	organisation, apiError := GetOrganisation(orgID)
+	if apiError != nil {
+		return apiError
+	}
+	if organisation.Status != OrganisationStatusSuspended {
+		return cigExchange.NewInvalidFieldError("organisation_id", "Organisation is not suspended")
+	}
+
+	status := organisation.StatusBeforeSuspension
+	if len(status) == 0 {
+		status = OrganisationStatusUnverified
+	}
+
+	return cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		update := map[string]interface{}{
+			"status":                   status,
+			"status_before_suspension": "",
+		}
+		err := tx.Model(organisation).Updates(update).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Failed to unsuspend organisation", err)
+		}
+		apiError := createEvent(tx, EventTypeOrganisationUpdated, orgID, updateEventPayload(orgID, update))
+		if apiError != nil {
+			return apiError
+		}
+
+		update = map[string]interface{}{
+			"is_visible":           true,
+			"hidden_by_suspension": false,
+		}
+		err = tx.Model(&Offering{}).Where("organisation_id = ? AND hidden_by_suspension = ?", orgID, true).Updates(update).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Failed to show organisation offerings", err)
+		}
+		return nil
+	})
+}
+
+// IsOrganisationSuspendedCtx returns true if the organisation is suspended, missing organisation isn't suspended
+func IsOrganisationSuspendedCtx(ctx context.Context, UUID string) (bool, *cigExchange.APIError) {
+
+	organisation := &Organisation{}
+	db := cigExchange.GetDBWithContext(ctx).Select("status").Where("id = ?", UUID).First(organisation)
+	if db.Error != nil {
+		if !db.RecordNotFound() {
+			return false, cigExchange.NewDatabaseError("Organisation lookup failed", db.Error)
+		}
+		return false, nil
+	}
+	return organisation.Status == OrganisationStatusSuspended, nil
+}
+
 // GetOrganisation queries a single organisation from db
 func GetOrganisation(UUID string) (*Organisation, *cigExchange.APIError) {
+	return GetOrganisationCtx(context.Background(), UUID)
+}
+
+// GetOrganisationCtx queries a single organisation from db with the context
+func GetOrganisationCtx(ctx context.Context, UUID string) (*Organisation, *cigExchange.APIError) {
 
 	// check that UUID is set
 	if len(UUID) == 0 {
@@ -122,7 +444,7 @@ func GetOrganisation(UUID string) (*Organisation, *cigExchange.APIError) {
 	organisation := &Organisation{
 		ID: UUID,
 	}
-	db := cigExchange.GetDB().First(organisation)
+	db := cigExchange.GetDBWithContext(ctx).First(organisation)
 
 	if db.Error != nil {
 		if !db.RecordNotFound() {
@@ -134,8 +456,38 @@ func GetOrganisation(UUID string) (*Organisation, *cigExchange.APIError) {
 	return organisation, nil
 }
 
+// GetOrganisationByReferenceKey queries a single organisation by the reference key from db
+func GetOrganisationByReferenceKey(key string) (*Organisation, *cigExchange.APIError) {
+	return GetOrganisationByReferenceKeyCtx(context.Background(), key)
+}
+
+// GetOrganisationByReferenceKeyCtx queries a single organisation by the reference key from db with the context
+func GetOrganisationByReferenceKeyCtx(ctx context.Context, key string) (*Organisation, *cigExchange.APIError) {
+
+	key = strings.TrimSpace(key)
+	if len(key) == 0 {
+		return nil, cigExchange.NewInvalidFieldError("reference_key", "Organisation reference key is invalid")
+	}
+
+	organisation := &Organisation{}
+	db := cigExchange.GetDBWithContext(ctx).Where(&Organisation{ReferenceKey: key}).First(organisation)
+	if db.Error != nil {
+		if !db.RecordNotFound() {
+			return nil, cigExchange.NewDatabaseError("Organisation lookup failed", db.Error)
+		}
+		return nil, cigExchange.NewOrganisationDoesntExistError("Organisation with provided reference key doesn't exist")
+	}
+
+	return organisation, nil
+}
+
 // GetOrganisations queries all organisations for user from db
 func GetOrganisations(userUUID string) ([]*Organisation, *cigExchange.APIError) {
+	return GetOrganisationsCtx(context.Background(), userUUID)
+}
+
+// GetOrganisationsCtx queries all organisations for user from db with the context
+func GetOrganisationsCtx(ctx context.Context, userUUID string) ([]*Organisation, *cigExchange.APIError) {
 
 	// check that UUID is set
 	if len(userUUID) == 0 {
@@ -147,7 +499,7 @@ func GetOrganisations(userUUID string) ([]*Organisation, *cigExchange.APIError)
 	var orgUsers []OrganisationUser
 
 	// find all organisationUser objects for user
-	db := cigExchange.GetDB().Where(&OrganisationUser{UserID: userUUID}).Find(&orgUsers)
+	db := cigExchange.GetDBWithContext(ctx).Where(&OrganisationUser{UserID: userUUID}).Find(&orgUsers)
 	if db.Error != nil {
 		if !db.RecordNotFound() {
 			return nil, cigExchange.NewDatabaseError("OrganisationUser lookup failed", db.Error)
@@ -158,7 +510,7 @@ func GetOrganisations(userUUID string) ([]*Organisation, *cigExchange.APIError)
 		organisation := &Organisation{
 			ID: orgUser.OrganisationID,
 		}
-		db := cigExchange.GetDB().First(organisation)
+		db := cigExchange.GetDBWithContext(ctx).First(organisation)
 		if db.Error != nil {
 			if !db.RecordNotFound() {
 				return nil, cigExchange.NewDatabaseError("Organisation lookup failed", db.Error)
@@ -173,13 +525,75 @@ func GetOrganisations(userUUID string) ([]*Organisation, *cigExchange.APIError)
 // GetAllOrganisations queries all organisations from db
 func GetAllOrganisations() ([]*Organisation, *cigExchange.APIError) {
 
+	orgs, _, apiErr := GetOrganisationsFiltered("", time.Time{}, time.Time{}, 0, 0)
+	return orgs, apiErr
+}
+
+// GetOrganisationsFiltered queries a page of organisations from db and the total count of matching organisations.
+// Empty status, zero from / to times and non positive limit disable the corresponding filter
+func GetOrganisationsFiltered(status string, from, to time.Time, limit, offset int) ([]*Organisation, int, *cigExchange.APIError) {
+
 	orgs := make([]*Organisation, 0)
-	// find all userActivities objects for organisation
-	db := cigExchange.GetDB().Find(&orgs)
+	total := 0
+
+	db := cigExchange.GetReadDB().Model(&Organisation{})
+	if len(status) > 0 {
+		db = db.Where("status = ?", status)
+	}
+	if !from.IsZero() {
+		db = db.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		db = db.Where("created_at < ?", to)
+	}
+
+	// count all matching organisations
+	countDB := db.Count(&total)
+	if countDB.Error != nil {
+		return orgs, total, cigExchange.NewDatabaseError("Organisations count failed", countDB.Error)
+	}
+
+	db = db.Order("created_at desc").Order("id")
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	if offset > 0 {
+		db = db.Offset(offset)
+	}
+
+	db = db.Find(&orgs)
+	if db.Error != nil {
+		if !db.RecordNotFound() {
+			return orgs, total, cigExchange.NewDatabaseError("Organisations lookup failed", db.Error)
+		}
+	}
+	return orgs, total, nil
+}
+
+// default number of organisations returned by SearchOrganisations
+const defaultOrganisationSearchLimit = 20
+
+// SearchOrganisations queries organisations with name containing the query (case insensitive)
+// or reference key starting with the query, ordered by name
+func SearchOrganisations(query string, limit int) ([]*Organisation, *cigExchange.APIError) {
+
+	orgs := make([]*Organisation, 0)
+
+	query = strings.TrimSpace(query)
+	if len(query) == 0 {
+		return orgs, cigExchange.NewRequiredFieldError([]string{"query"})
+	}
+	if limit <= 0 {
+		limit = defaultOrganisationSearchLimit
+	}
+
+	// escape LIKE wildcards in user input
+	escaped := strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(query)
+
+	db := cigExchange.GetReadDB().Where("name ILIKE ? OR reference_key LIKE ?", "%"+escaped+"%", escaped+"%").Order("name").Limit(limit).Find(&orgs)
 	if db.Error != nil {
 		if !db.RecordNotFound() {
-			apiErr := cigExchange.NewDatabaseError("UserActivity lookup failed", db.Error)
-			return orgs, apiErr
+			return orgs, cigExchange.NewDatabaseError("Organisations search failed", db.Error)
 		}
 	}
 	return orgs, nil
@@ -191,18 +605,82 @@ func (organisation *Organisation) trimFieldsAndValidate() *cigExchange.APIError
 	organisation.Type = strings.TrimSpace(organisation.Type)
 	organisation.ReferenceKey = strings.TrimSpace(organisation.ReferenceKey)
 
-	missingFieldNames := make([]string, 0)
-	if len(organisation.Name) == 0 {
-		missingFieldNames = append(missingFieldNames, "name")
+	// mfa policy isn't required
+	if len(organisation.MFAPolicy) == 0 {
+		organisation.MFAPolicy = OrganisationMFAPolicyOTP
 	}
-	if len(organisation.ReferenceKey) == 0 {
-		missingFieldNames = append(missingFieldNames, "reference_key")
+
+	v := cigExchange.NewValidator().
+		Field("name", organisation.Name, cigExchange.Required).
+		Field("reference_key", organisation.ReferenceKey, cigExchange.Required).
+		Field("mfa_policy", organisation.MFAPolicy, cigExchange.OneOf(OrganisationMFAPolicyOTP, OrganisationMFAPolicyWebAuthn)).
+		Check(validateOfferingRatingDescription(organisation.OfferingRatingDescription))
+
+	// website isn't required
+	website, apiErr := normalizeWebsite(organisation.Website)
+	if apiErr == nil {
+		organisation.Website = website
 	}
+	v.Check(apiErr)
 
-	if len(missingFieldNames) > 0 {
-		return cigExchange.NewRequiredFieldError(missingFieldNames)
+	return v.Error()
+}
+
+// isValidMFAPolicy returns true for the known mfa policies
+func isValidMFAPolicy(policy string) bool {
+	return policy == OrganisationMFAPolicyOTP || policy == OrganisationMFAPolicyWebAuthn
+}
+
+// RequiresWebAuthn returns true if the user must pass WebAuthn after the OTP verification.
+// A user belonging to several organisations is subject to the strictest policy of the active memberships,
+// not only of the home organisation, because the organisation can be switched later without a new verification.
+// Unverified and invited memberships don't count, anyone knowing the email and the public reference key can create them
+func RequiresWebAuthn(userID string) (bool, *cigExchange.APIError) {
+	return RequiresWebAuthnCtx(context.Background(), userID)
+}
+
+// RequiresWebAuthnCtx checks the organisations mfa policies with the context, see RequiresWebAuthn
+func RequiresWebAuthnCtx(ctx context.Context, userID string) (bool, *cigExchange.APIError) {
+
+	// check that UUID is set
+	if len(userID) == 0 {
+		return false, cigExchange.NewInvalidFieldError("user_id", "User id is invalid")
 	}
-	return nil
+
+	count := 0
+	db := cigExchange.GetDBWithContext(ctx).Model(&OrganisationUser{}).
+		Joins("JOIN organisation ON organisation.id = organisation_user.organisation_id AND organisation.deleted_at IS NULL").
+		Where("organisation_user.user_id = ? AND organisation_user.status = ?", userID, OrganisationUserStatusActive).
+		Where("organisation.mfa_policy = ?", OrganisationMFAPolicyWebAuthn).Count(&count)
+	if db.Error != nil {
+		return false, cigExchange.NewDatabaseError("Organisation mfa policy lookup failed", db.Error)
+	}
+	return count > 0, nil
+}
+
+// normalizeWebsite validates website as absolute http(s) url, missing scheme is set to https
+func normalizeWebsite(website string) (string, *cigExchange.APIError) {
+
+	website = strings.TrimSpace(website)
+	if len(website) == 0 {
+		return website, nil
+	}
+
+	if !strings.Contains(website, "://") {
+		website = "https://" + website
+	}
+
+	websiteURL, err := url.Parse(website)
+	if err != nil {
+		return website, cigExchange.NewInvalidFieldError("website", "Website is not a valid url")
+	}
+	if websiteURL.Scheme != "http" && websiteURL.Scheme != "https" {
+		return website, cigExchange.NewInvalidFieldError("website", "Website must be http or https url")
+	}
+	if len(websiteURL.Hostname()) == 0 || !strings.Contains(websiteURL.Hostname(), ".") {
+		return website, cigExchange.NewInvalidFieldError("website", "Website host is invalid")
+	}
+	return websiteURL.String(), nil
 }
 
 // OrganisationInfo is a struct to store dashboard values
@@ -216,37 +694,152 @@ type OrganisationInfo struct {
 // GetOrganisationInfo returns values for organisation dashboard
 func GetOrganisationInfo(organisationID string) (*OrganisationInfo, *cigExchange.APIError) {
 
+	organisationsInfo, apiError := AggregateOrganisationAmounts([]string{organisationID})
+	if apiError != nil {
+		return nil, apiError
+	}
+	return organisationsInfo[organisationID], nil
+}
+
+// organisationInfoExpiration is the time the dashboard values are cached, changes show up with this delay
+const organisationInfoExpiration = time.Minute
+
+// AggregateOrganisationAmounts returns dashboard values for many organisations with grouped queries.
+// Values are cached per organisation for organisationInfoExpiration, only missing organisations are queried.
+// Every requested organisation id is present in the result map
+func AggregateOrganisationAmounts(organisationIDs []string) (map[string]*OrganisationInfo, *cigExchange.APIError) {
+
+	organisationsInfo := make(map[string]*OrganisationInfo)
+	missingIDs := make([]string, 0)
+	for _, organisationID := range organisationIDs {
+		if _, ok := organisationsInfo[organisationID]; ok {
+			continue
+		}
+		organisationInfo := getCachedOrganisationInfo(organisationID)
+		if organisationInfo == nil {
+			missingIDs = append(missingIDs, organisationID)
+			// placeholder keeps duplicated ids out of missingIDs
+			organisationsInfo[organisationID] = &OrganisationInfo{}
+			continue
+		}
+		organisationsInfo[organisationID] = organisationInfo
+	}
+	if len(missingIDs) == 0 {
+		return organisationsInfo, nil
+	}
+
+	queriedInfo, apiError := aggregateOrganisationAmounts(missingIDs)
+	if apiError != nil {
+		return nil, apiError
+	}
+	for organisationID, organisationInfo := range queriedInfo {
+		organisationsInfo[organisationID] = organisationInfo
+		setCachedOrganisationInfo(organisationID, organisationInfo)
+	}
+	return organisationsInfo, nil
+}
+
+// getCachedOrganisationInfo returns the cached dashboard values or nil, store failures are logged and ignored
+func getCachedOrganisationInfo(organisationID string) *OrganisationInfo {
+
+	rediskey := cigExchange.GenerateRedisKey(organisationID, cigExchange.KeyOrganisationInfo)
+	value, err := cigExchange.GetStore().Get(rediskey)
+	if err != nil {
+		if err != cigExchange.ErrKeyNotFound {
+			cigExchange.LogAPIError("Organisation info cache", cigExchange.NewRedisError("Get organisation info failure", err))
+		}
+		return nil
+	}
+
 	organisationInfo := &OrganisationInfo{}
+	if err = json.Unmarshal([]byte(value), organisationInfo); err != nil {
+		cigExchange.LogAPIError("Organisation info cache", cigExchange.NewJSONDecodingError("Cached organisation info decoding failed", err))
+		return nil
+	}
+	return organisationInfo
+}
 
-	// get total offerings
-	var count int
-	db := cigExchange.GetDB().Model(&Offering{}).Where("organisation_id = ?", organisationID).Count(&count)
-	if db.Error != nil {
-		return nil, cigExchange.NewDatabaseError("Get total offerings for organisation failed", db.Error)
+// setCachedOrganisationInfo caches the dashboard values, store failures are logged and ignored
+func setCachedOrganisationInfo(organisationID string, organisationInfo *OrganisationInfo) {
+
+	infoBytes, err := json.Marshal(organisationInfo)
+	if err != nil {
+		cigExchange.LogAPIError("Organisation info cache", cigExchange.NewJSONEncodingError("Organisation info encoding failed", err))
+		return
 	}
-	organisationInfo.TotalOfferings = count
 
-	// get total users
-	db = cigExchange.GetDB().Model(&OrganisationUser{}).Where("organisation_id = ? and status = ?", organisationID, OrganisationUserStatusActive).Count(&count)
-	if db.Error != nil {
-		return nil, cigExchange.NewDatabaseError("Get total users for organisation failed", db.Error)
+	rediskey := cigExchange.GenerateRedisKey(organisationID, cigExchange.KeyOrganisationInfo)
+	err = cigExchange.GetStore().Set(rediskey, infoBytes, organisationInfoExpiration)
+	if err != nil {
+		cigExchange.LogAPIError("Organisation info cache", cigExchange.NewRedisError("Set organisation info failure", err))
 	}
-	organisationInfo.TotalUsers = count
+}
 
-	// get offerings amount and amount already taken
-	row := cigExchange.GetDB().Model(&Offering{}).Select("sum(amount), sum(amount_already_taken)").Where("organisation_id = ?", organisationID).Row()
+// aggregateOrganisationAmounts queries dashboard values of the organisations with grouped queries
+func aggregateOrganisationAmounts(organisationIDs []string) (map[string]*OrganisationInfo, *cigExchange.APIError) {
 
-	var amount float32
-	var taken float32
-	err := row.Scan(&amount, &taken)
+	organisationsInfo := make(map[string]*OrganisationInfo)
+	for _, organisationID := range organisationIDs {
+		organisationsInfo[organisationID] = &OrganisationInfo{}
+	}
+
+	// get total offerings, offerings amount and amount already taken
+	rows, err := cigExchange.GetReadDB().Model(&Offering{}).
+		Select("organisation_id, count(*), coalesce(sum(amount), 0), coalesce(sum(amount_already_taken), 0)").
+		Where("organisation_id in (?)", organisationIDs).
+		Group("organisation_id").Rows()
 	if err != nil {
-		fmt.Println(cigExchange.NewDatabaseError("Get total and remaininig amount for organisation failed", err).ToString())
-		return organisationInfo, nil
+		return nil, cigExchange.NewDatabaseError("Get total offerings and amounts for organisations failed", err)
+	}
+	for rows.Next() {
+		var organisationID string
+		var count int
+		var amount float32
+		var taken float32
+		err = rows.Scan(&organisationID, &count, &amount, &taken)
+		if err != nil {
+			rows.Close()
+			return nil, cigExchange.NewDatabaseError("Get total offerings and amounts for organisations failed", err)
+		}
+		organisationInfo, ok := organisationsInfo[organisationID]
+		if !ok {
+			continue
+		}
+		organisationInfo.TotalOfferings = count
+		organisationInfo.TotalAmount = amount
+		organisationInfo.RemainingAmount = amount - taken
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, cigExchange.NewDatabaseError("Get total offerings and amounts for organisations failed", err)
+	}
+
+	// get total users
+	rows, err = cigExchange.GetReadDB().Model(&OrganisationUser{}).
+		Select("organisation_id, count(*)").
+		Where("organisation_id in (?) and status = ?", organisationIDs, OrganisationUserStatusActive).
+		Group("organisation_id").Rows()
+	if err != nil {
+		return nil, cigExchange.NewDatabaseError("Get total users for organisations failed", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var organisationID string
+		var count int
+		err = rows.Scan(&organisationID, &count)
+		if err != nil {
+			return nil, cigExchange.NewDatabaseError("Get total users for organisations failed", err)
+		}
+		if organisationInfo, ok := organisationsInfo[organisationID]; ok {
+			organisationInfo.TotalUsers = count
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, cigExchange.NewDatabaseError("Get total users for organisations failed", err)
 	}
-	organisationInfo.TotalAmount = amount
-	organisationInfo.RemainingAmount = amount - taken
 
-	return organisationInfo, nil
+	return organisationsInfo, nil
 }
 
 // OrganisationUserInfo is a struct to store dashboard values
@@ -268,7 +861,7 @@ func GetOrganisationUsersInfo(organisationID string) ([]*OrganisationUserInfo, *
 	whereS := "WHERE \"user\".role <> '" + UserRoleAdmin + "' AND \"user\".deleted_at IS NULL AND type = 'user_session' AND jwt @> '{\"organisation_id\": \"" + organisationID + "\"}' "
 	groupS := "GROUP BY user_id, \"user\".name, \"user\".lastname;"
 	// get user sessions
-	rows, err := cigExchange.GetDB().Raw(selectS + joinS + whereS + groupS).Rows()
+	rows, err := cigExchange.GetReadDB().Raw(selectS + joinS + whereS + groupS).Rows()
 	if err != nil {
 		return nil, cigExchange.NewDatabaseError("Get user sessions for organisation failed", err)
 	}
@@ -281,7 +874,7 @@ func GetOrganisationUsersInfo(organisationID string) ([]*OrganisationUserInfo, *
 			orgUserInfo.AverageTime = int(average)
 			organisationUsersInfo = append(organisationUsersInfo, orgUserInfo)
 		} else {
-			fmt.Printf("GetOrganisationUsersInfo error: %v\n", err.Error())
+			cigExchange.Logger().Warn("GetOrganisationUsersInfo: scan failed", "organisation_id", organisationID, "error", err.Error())
 		}
 	}
 
@@ -304,7 +897,7 @@ func GetOfferingsTypeBreakdown(organisationID string) ([]*OrganisationOfferingsT
 	whereS := "WHERE o.organisation_id = '" + organisationID + "' AND o.deleted_at IS NULL "
 	groupS := "GROUP BY x.offering_type ORDER BY total DESC;"
 	// get organisation offerings breakdown
-	rows, err := cigExchange.GetDB().Raw(selectS + lateralS + whereS + groupS).Rows()
+	rows, err := cigExchange.GetReadDB().Raw(selectS + lateralS + whereS + groupS).Rows()
 	if err != nil {
 		return nil, cigExchange.NewDatabaseError("Get offerings type breakdown for organisation failed", err)
 	}
@@ -336,7 +929,7 @@ func GetOfferingsClicks(organisationID string) ([]*OrganisationOfferingClicks, *
 	offeringsClicks := make([]*OrganisationOfferingClicks, 0)
 
 	// get all offerings for organisation
-	db := cigExchange.GetDB().Where(&Offering{OrganisationID: organisationID}).Find(&offerings)
+	db := cigExchange.GetReadDB().Where(&Offering{OrganisationID: organisationID}).Find(&offerings)
 	if db.Error != nil {
 		if !db.RecordNotFound() {
 			return offeringsClicks, cigExchange.NewDatabaseError("Offerings lookup failed", db.Error)
@@ -394,7 +987,7 @@ func GetOfferingsClicks(organisationID string) ([]*OrganisationOfferingClicks, *
 		}
 		selectS := "SELECT count(*) as total FROM public.user_activity WHERE type = 'offering_click' AND info ~ '" + offering.ID + "' AND deleted_at IS NULL;"
 		// get organisation offerings breakdown
-		row := cigExchange.GetDB().Raw(selectS).Row()
+		row := cigExchange.GetReadDB().Raw(selectS).Row()
 		var amount int
 		err = row.Scan(&amount)
 		if err == nil {
@@ -425,6 +1018,7 @@ type OrganisationUser struct {
 	OrganisationRole string     `gorm:"column:organisation_role"`
 	IsHome           bool       `gorm:"column:is_home"`
 	Status           string     `gorm:"column:status;default:'invited'"`
+	InviteCodeID     *string    `gorm:"column:invite_code_id"`
 	CreatedAt        time.Time  `gorm:"column:created_at"`
 	UpdatedAt        time.Time  `gorm:"column:updated_at"`
 	DeletedAt        *time.Time `gorm:"column:deleted_at"`
@@ -444,11 +1038,16 @@ func (*OrganisationUser) BeforeCreate(scope *gorm.Scope) error {
 
 // OrganisationUserByID queries a single OrganisationUser object from db
 func OrganisationUserByID(organisationUserID string) (*OrganisationUser, *cigExchange.APIError) {
+	return OrganisationUserByIDCtx(context.Background(), organisationUserID)
+}
+
+// OrganisationUserByIDCtx queries a single OrganisationUser object from db with the context
+func OrganisationUserByIDCtx(ctx context.Context, organisationUserID string) (*OrganisationUser, *cigExchange.APIError) {
 
 	orgUser := &OrganisationUser{
 		ID: organisationUserID,
 	}
-	db := cigExchange.GetDB().First(orgUser)
+	db := cigExchange.GetDBWithContext(ctx).First(orgUser)
 	if db.Error != nil {
 		if db.RecordNotFound() {
 			return nil, cigExchange.NewInvalidFieldError("organisation_user_id", "OrganisationUser with provided id doesn't exist")
@@ -459,8 +1058,81 @@ func OrganisationUserByID(organisationUserID string) (*OrganisationUser, *cigExc
 	return orgUser, nil
 }
 
+// OrganisationUserDetailed is a struct to represent an organisation to user link with the user and login email
+type OrganisationUserDetailed struct {
+	OrganisationUser *OrganisationUser `json:"organisation_user"`
+	User             *User             `json:"user"`
+	LoginEmail       *Contact          `json:"login_email"`
+}
+
+// GetOrganisationUserDetailed queries OrganisationUser with the user and login email from db in a single query.
+// LoginEmail is nil if the user has no login email
+func GetOrganisationUserDetailed(organisationUserID string) (*OrganisationUserDetailed, *cigExchange.APIError) {
+
+	// check that UUID is set
+	if len(organisationUserID) == 0 {
+		return nil, cigExchange.NewInvalidFieldError("organisation_user_id", "OrganisationUser id is invalid")
+	}
+
+	selectS := "SELECT organisation_user.id, organisation_user.organisation_id, organisation_user.user_id, organisation_user.organisation_role, " +
+		"organisation_user.is_home, organisation_user.status, organisation_user.created_at, organisation_user.updated_at, " +
+		"coalesce(\"user\".title, ''), coalesce(\"user\".role, ''), coalesce(\"user\".name, ''), coalesce(\"user\".lastname, ''), \"user\".login_email, \"user\".login_phone, \"user\".status, " +
+		"\"user\".created_at, \"user\".updated_at, contact.level, contact.type, contact.value1, contact.verified_at FROM public.organisation_user "
+	joinS := "INNER JOIN public.user ON \"user\".id = organisation_user.user_id AND \"user\".deleted_at IS NULL " +
+		"LEFT JOIN public.contact ON contact.id = \"user\".login_email AND contact.deleted_at IS NULL "
+	whereS := "WHERE organisation_user.id = ? AND organisation_user.deleted_at IS NULL;"
+
+	orgUser := &OrganisationUser{}
+	user := &User{}
+	var contactLevel, contactType, contactValue sql.NullString
+	var contactVerifiedAt *time.Time
+
+	row := cigExchange.GetDB().Raw(selectS+joinS+whereS, organisationUserID).Row()
+	err := row.Scan(&orgUser.ID, &orgUser.OrganisationID, &orgUser.UserID, &orgUser.OrganisationRole,
+		&orgUser.IsHome, &orgUser.Status, &orgUser.CreatedAt, &orgUser.UpdatedAt,
+		&user.Title, &user.Role, &user.Name, &user.LastName, &user.LoginEmailUUID, &user.LoginPhoneUUID, &user.Status,
+		&user.CreatedAt, &user.UpdatedAt, &contactLevel, &contactType, &contactValue, &contactVerifiedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, cigExchange.NewInvalidFieldError("organisation_user_id", "OrganisationUser with provided id doesn't exist")
+		}
+		return nil, cigExchange.NewDatabaseError("Fetch OrganisationUser failed", err)
+	}
+	user.ID = orgUser.UserID
+
+	detailed := &OrganisationUserDetailed{
+		OrganisationUser: orgUser,
+		User:             user,
+	}
+	if user.LoginEmailUUID != nil && contactValue.Valid {
+		detailed.LoginEmail = &Contact{
+			ID:         *user.LoginEmailUUID,
+			Level:      contactLevel.String,
+			Type:       contactType.String,
+			Value1:     contactValue.String,
+			VerifiedAt: contactVerifiedAt,
+		}
+		if err := detailed.LoginEmail.decryptValues(); err != nil {
+			return nil, cigExchange.NewEncryptionError("Contact decryption failed", err)
+		}
+		user.LoginEmail = detailed.LoginEmail
+	}
+
+	return detailed, nil
+}
+
 // Create inserts new organisation user object into db
 func (orgUser *OrganisationUser) Create() *cigExchange.APIError {
+	return orgUser.CreateCtx(context.Background())
+}
+
+// CreateCtx inserts new organisation user object into db with the context
+func (orgUser *OrganisationUser) CreateCtx(ctx context.Context) *cigExchange.APIError {
+	return orgUser.create(cigExchange.GetDBWithContext(ctx))
+}
+
+// create inserts new organisation user object using db, it can be a transaction
+func (orgUser *OrganisationUser) create(db *gorm.DB) *cigExchange.APIError {
 
 	// invalidate the uuid
 	orgUser.ID = ""
@@ -473,7 +1145,7 @@ func (orgUser *OrganisationUser) Create() *cigExchange.APIError {
 		return cigExchange.NewInvalidFieldError("organization_id", "OrganisationID is invalid")
 	}
 
-	db := cigExchange.GetDB().Create(orgUser)
+	db = db.Create(orgUser)
 	if db.Error != nil {
 		return cigExchange.NewDatabaseError("Create organization user link call failed", db.Error)
 	}
@@ -504,9 +1176,14 @@ func (orgUser *OrganisationUser) Update() *cigExchange.APIError {
 
 // Find queries organisation user from db
 func (orgUser *OrganisationUser) Find() (organisationUser *OrganisationUser, apiError *cigExchange.APIError) {
+	return orgUser.FindCtx(context.Background())
+}
+
+// FindCtx queries organisation user from db with the context
+func (orgUser *OrganisationUser) FindCtx(ctx context.Context) (organisationUser *OrganisationUser, apiError *cigExchange.APIError) {
 
 	organisationUser = &OrganisationUser{}
-	db := cigExchange.GetDB().Where(orgUser).First(organisationUser)
+	db := cigExchange.GetDBWithContext(ctx).Where(orgUser).First(organisationUser)
 	if db.Error != nil {
 		if db.RecordNotFound() {
 			return nil, cigExchange.NewOrganisationUserDoesntExistError("Organisation User with provided parameters doesn't exist")
@@ -516,8 +1193,52 @@ func (orgUser *OrganisationUser) Find() (organisationUser *OrganisationUser, api
 	return organisationUser, nil
 }
 
+// SetHomeOrganisation makes the organisation the user home organisation in a transaction.
+// User must be an active member of the organisation
+func SetHomeOrganisation(userID, organisationID string) *cigExchange.APIError {
+
+	// check that UUIDs are set
+	if len(userID) == 0 {
+		return cigExchange.NewInvalidFieldError("user_id", "UserID is invalid")
+	}
+	if len(organisationID) == 0 {
+		return cigExchange.NewInvalidFieldError("organisation_id", "OrganisationID is invalid")
+	}
+
+	// check membership
+	searchOrgUser := &OrganisationUser{
+		OrganisationID: organisationID,
+		UserID:         userID,
+	}
+	orgUser, apiError := searchOrgUser.Find()
+	if apiError != nil {
+		return apiError
+	}
+	if orgUser.Status != OrganisationUserStatusActive {
+		return cigExchange.NewInvalidFieldError("organisation_id", "User is not an active member of the organisation")
+	}
+
+	return cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		err := tx.Model(&OrganisationUser{}).Where("user_id = ? and id <> ?", userID, orgUser.ID).Update("is_home", false).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Failed to update organisation user", err)
+		}
+
+		err = tx.Model(&OrganisationUser{}).Where("id = ?", orgUser.ID).Update("is_home", true).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Failed to update organisation user", err)
+		}
+		return nil
+	})
+}
+
 // Delete existing user organisation object in db
 func (orgUser *OrganisationUser) Delete() *cigExchange.APIError {
+	return orgUser.DeleteCtx(context.Background())
+}
+
+// DeleteCtx deletes existing user organisation object in db with the context
+func (orgUser *OrganisationUser) DeleteCtx(ctx context.Context) *cigExchange.APIError {
 
 	// check that UUID is set
 	if len(orgUser.ID) == 0 {
@@ -527,12 +1248,18 @@ func (orgUser *OrganisationUser) Delete() *cigExchange.APIError {
 	// remove previous token from redis
 	redisKey := orgUser.UserID + "|" + orgUser.OrganisationID
 
-	intRedisCmd := cigExchange.GetRedis().Del(redisKey)
-	if intRedisCmd.Err() != nil {
-		return cigExchange.NewRedisError("Del token failure", intRedisCmd.Err())
+	_, err := cigExchange.GetStore().Del(redisKey)
+	if err != nil {
+		return cigExchange.NewRedisError("Del token failure", err)
+	}
+
+	// remove user sessions signed in to the organisation
+	apiError := cigExchange.RevokeOrganisationSessions(orgUser.UserID, orgUser.OrganisationID)
+	if apiError != nil {
+		return apiError
 	}
 
-	db := cigExchange.GetDB().Delete(orgUser)
+	db := cigExchange.GetDBWithContext(ctx).Delete(orgUser)
 	if db.Error != nil {
 		return cigExchange.NewDatabaseError("Error deleting organisation user", db.Error)
 	}
@@ -558,7 +1285,7 @@ func GetOrganisationUsersForOrganisation(organisationID string) (orgUsers []*Org
 
 // OrganisationUserResponse used in response for organisation/{organisation_id}/users api call
 type OrganisationUserResponse struct {
-	*User
+	*PublicUser
 	UserEmail string     `json:"email"`
 	LastLogin *time.Time `json:"last_login,omitempty"`
 	IsAdmin   bool       `json:"is_admin"`
@@ -579,27 +1306,28 @@ func GetUsersForOrganisation(organisationID string, invitedUsers bool) (usersRes
 		return
 	}
 
+	// return only list of invited or active users
+	status := OrganisationUserStatusActive
+	if invitedUsers {
+		status = OrganisationUserStatusInvited
+	}
+	userIDs := make([]string, 0, len(orgUsers))
 	for _, orgUser := range orgUsers {
-		if invitedUsers {
-			// return only list of invited users
-			if orgUser.Status != OrganisationUserStatusInvited {
-				continue
-			}
-		} else {
-			// return only list of active users
-			if orgUser.Status != OrganisationUserStatusActive {
-				continue
-			}
+		if orgUser.Status == status {
+			userIDs = append(userIDs, orgUser.UserID)
 		}
-		// get user with login email
-		var user User
-		db = cigExchange.GetDB().Preload("LoginEmail").Where(&User{ID: orgUser.UserID}).First(&user)
-		if db.Error != nil {
-			if db.RecordNotFound() {
-				continue
-			}
-			apiErr = cigExchange.NewDatabaseError("User lookup failed", db.Error)
-			return
+	}
+
+	// get users with login emails
+	usersByID, apiErr := GetUsersByIDs(userIDs)
+	if apiErr != nil {
+		return
+	}
+
+	for _, orgUser := range orgUsers {
+		user, ok := usersByID[orgUser.UserID]
+		if orgUser.Status != status || !ok {
+			continue
 		}
 		if user.LoginEmail == nil || len(user.LoginEmail.Value1) == 0 {
 			apiErr = cigExchange.NewDatabaseError("Invalid login email", db.Error)
@@ -614,7 +1342,7 @@ func GetUsersForOrganisation(organisationID string, invitedUsers bool) (usersRes
 		err := row.Scan(&lastLogin)
 		if err != nil {
 			if err != sql.ErrNoRows {
-				fmt.Println(cigExchange.NewDatabaseError("Last login error: ", err).ToString())
+				cigExchange.LogAPIError("Last login error", cigExchange.NewDatabaseError("Last login error: ", err))
 				return
 			}
 		}
@@ -625,10 +1353,10 @@ func GetUsersForOrganisation(organisationID string, invitedUsers bool) (usersRes
 
 		// fill response struct
 		userResponse := &OrganisationUserResponse{
-			User:      &user,
-			UserEmail: user.LoginEmail.Value1,
-			LastLogin: lastLoginP,
-			IsAdmin:   orgUser.OrganisationRole == OrganisationRoleAdmin,
+			PublicUser: user.ToPublic(),
+			UserEmail:  user.LoginEmail.Value1,
+			LastLogin:  lastLoginP,
+			IsAdmin:    orgUser.OrganisationRole == OrganisationRoleAdmin,
 		}
 		// add user to response
 		usersResponse = append(usersResponse, userResponse)
@@ -643,8 +1371,8 @@ func DeleteExpiredInvitations() {
 	// delete invited user with updated_at < now() - interval '30 days'
 	db := cigExchange.GetDB().Where("status = ? and updated_at < now() - interval '30 days'", OrganisationUserStatusInvited).Delete(&OrganisationUser{})
 	if db.Error != nil {
-		log.Printf("Failed to delete invited users with error: %v\n", db.Error.Error())
+		cigExchange.Logger().Error("DeleteExpiredInvitations: failed to delete invited users", "error", db.Error.Error())
 		return
 	}
-	log.Printf("%d invitations deleted\n", db.RowsAffected)
+	cigExchange.Logger().Info("DeleteExpiredInvitations: invitations deleted", "count", db.RowsAffected)
 }
@@ -0,0 +1,91 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"testing"
+)
+
+func TestAggregateOrganisationAmountsCached(t *testing.T) {
+
+	cigExchange.SetStore(cigExchange.NewMemoryStore())
+	defer cigExchange.SetStore(nil)
+
+	cached := map[string]*OrganisationInfo{
+		"org-a": {TotalOfferings: 2, TotalUsers: 1, TotalAmount: 300, RemainingAmount: 100},
+		"org-b": {TotalOfferings: 1, TotalUsers: 3, TotalAmount: 50, RemainingAmount: 50},
+	}
+	for organisationID, organisationInfo := range cached {
+		setCachedOrganisationInfo(organisationID, organisationInfo)
+	}
+
+	// cached organisations are not queried, the read db isn't needed
+	organisationsInfo, apiError := AggregateOrganisationAmounts([]string{"org-a", "org-b", "org-a"})
+	if apiError != nil {
+		t.Fatalf("unexpected error: %v", apiError.ToString())
+	}
+	if len(organisationsInfo) != len(cached) {
+		t.Fatalf("expected %d organisations, got %d", len(cached), len(organisationsInfo))
+	}
+	for organisationID, expected := range cached {
+		if got := organisationsInfo[organisationID]; got == nil || *got != *expected {
+			t.Errorf("%s: expected %+v, got %+v", organisationID, expected, got)
+		}
+	}
+}
+
+func TestAggregateOrganisationAmounts(t *testing.T) {
+
+	requireDB(t)
+	cigExchange.SetStore(cigExchange.NewMemoryStore())
+	defer cigExchange.SetStore(nil)
+
+	amount := func(value float64) *float64 { return &value }
+
+	orgA := createTestOrganisation(t)
+	offeringA1 := createTestOffering(t, orgA.ID, "aggregate-"+cigExchange.RandomUUID())
+	offeringA2 := createTestOffering(t, orgA.ID, "aggregate-"+cigExchange.RandomUUID())
+	createTestOrganisationAdmin(t, orgA.ID)
+
+	orgB := createTestOrganisation(t)
+	offeringB := createTestOffering(t, orgB.ID, "aggregate-"+cigExchange.RandomUUID())
+	createTestOrganisationAdmin(t, orgB.ID)
+	createTestOrganisationAdmin(t, orgB.ID)
+
+	orgC := createTestOrganisation(t)
+
+	amounts := []struct {
+		offering *Offering
+		amount   *float64
+		taken    *float64
+	}{
+		{offeringA1, amount(100), amount(40)},
+		{offeringA2, amount(200), nil},
+		{offeringB, amount(50), amount(50)},
+	}
+	for _, a := range amounts {
+		err := cigExchange.GetDB().Model(a.offering).Updates(map[string]interface{}{"amount": a.amount, "amount_already_taken": a.taken}).Error
+		if err != nil {
+			t.Fatalf("update failed: %v", err)
+		}
+	}
+
+	expected := map[string]OrganisationInfo{
+		orgA.ID: {TotalOfferings: 2, TotalUsers: 1, TotalAmount: 300, RemainingAmount: 260},
+		orgB.ID: {TotalOfferings: 1, TotalUsers: 2, TotalAmount: 50, RemainingAmount: 0},
+		orgC.ID: {},
+	}
+
+	organisationsInfo, apiError := AggregateOrganisationAmounts([]string{orgA.ID, orgB.ID, orgC.ID})
+	if apiError != nil {
+		t.Fatalf("unexpected error: %v", apiError.ToString())
+	}
+	for organisationID, info := range expected {
+		if got := organisationsInfo[organisationID]; got == nil || *got != info {
+			t.Errorf("%s: expected %+v, got %+v", organisationID, info, got)
+		}
+		// the result is cached
+		if cachedInfo := getCachedOrganisationInfo(organisationID); cachedInfo == nil || *cachedInfo != info {
+			t.Errorf("%s: expected cached %+v, got %+v", organisationID, info, cachedInfo)
+		}
+	}
+}
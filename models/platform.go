@@ -0,0 +1,98 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+)
+
+// PlatformStats is a struct to store platform wide admin dashboard values
+type PlatformStats struct {
+	TotalUsers          int     `json:"total_users"`
+	VerifiedUsers       int     `json:"verified_users"`
+	UnverifiedUsers     int     `json:"unverified_users"`
+	TotalOrganisations  int     `json:"total_organisations"`
+	TotalOfferings      int     `json:"total_offerings"`
+	VisibleOfferings    int     `json:"visible_offerings"`
+	TotalOfferingAmount float64 `json:"total_offering_amount"`
+	ActiveSessions24h   int     `json:"active_sessions_24h"`
+}
+
+// GetPlatformStats returns all platform wide admin dashboard values
+func GetPlatformStats() (*PlatformStats, *cigExchange.APIError) {
+
+	stats := &PlatformStats{}
+
+	var apiError *cigExchange.APIError
+	stats.TotalUsers, stats.VerifiedUsers, stats.UnverifiedUsers, apiError = GetPlatformUserCounts()
+	if apiError != nil {
+		return nil, apiError
+	}
+
+	stats.TotalOrganisations, apiError = GetPlatformOrganisationCount()
+	if apiError != nil {
+		return nil, apiError
+	}
+
+	stats.TotalOfferings, stats.VisibleOfferings, stats.TotalOfferingAmount, apiError = GetPlatformOfferingStats()
+	if apiError != nil {
+		return nil, apiError
+	}
+
+	stats.ActiveSessions24h, apiError = GetPlatformActiveSessionCount()
+	if apiError != nil {
+		return nil, apiError
+	}
+
+	return stats, nil
+}
+
+// GetPlatformUserCounts returns total, verified and unverified users count
+func GetPlatformUserCounts() (total, verified, unverified int, apiError *cigExchange.APIError) {
+
+	row := cigExchange.GetReadDB().Model(&User{}).
+		Select("count(*), count(*) filter (where status = ?), count(*) filter (where status = ?)", UserStatusVerified, UserStatusUnverified).
+		Row()
+	err := row.Scan(&total, &verified, &unverified)
+	if err != nil {
+		return 0, 0, 0, cigExchange.NewDatabaseError("Get platform users count failed", err)
+	}
+	return total, verified, unverified, nil
+}
+
+// GetPlatformOrganisationCount returns total organisations count
+func GetPlatformOrganisationCount() (int, *cigExchange.APIError) {
+
+	var count int
+	db := cigExchange.GetReadDB().Model(&Organisation{}).Count(&count)
+	if db.Error != nil {
+		return 0, cigExchange.NewDatabaseError("Get platform organisations count failed", db.Error)
+	}
+	return count, nil
+}
+
+// GetPlatformOfferingStats returns total and visible offerings count and the total amount across offerings
+func GetPlatformOfferingStats() (total, visible int, amount float64, apiError *cigExchange.APIError) {
+
+	row := cigExchange.GetReadDB().Model(&Offering{}).
+		Select("count(*), count(*) filter (where is_visible = ?), coalesce(sum(amount), 0)", true).
+		Row()
+	err := row.Scan(&total, &visible, &amount)
+	if err != nil {
+		return 0, 0, 0, cigExchange.NewDatabaseError("Get platform offerings stats failed", err)
+	}
+	return total, visible, amount, nil
+}
+
+// GetPlatformActiveSessionCount returns number of users with sessions in the last 24 hours
+func GetPlatformActiveSessionCount() (int, *cigExchange.APIError) {
+
+	var count int
+	row := cigExchange.GetReadDB().Model(&UserActivity{}).
+		Select("count(distinct user_id)").
+		Where("type = ? and updated_at > now() - interval '24 hours'", ActivityTypeSessionLength).
+		Row()
+	err := row.Scan(&count)
+	if err != nil {
+		return 0, cigExchange.NewDatabaseError("Get platform active sessions count failed", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// softDeleteModels returns models with soft delete, link tables go first
+func softDeleteModels() []interface{} {
+	return []interface{}{
+		&UserContact{},
+		&OfferingMedia{},
+		&OrganisationUser{},
+		&OrganisationInviteCode{},
+		&UserActivity{},
+		&Contact{},
+		&Media{},
+		&Offering{},
+		&User{},
+		&Organisation{},
+		&Info{},
+	}
+}
+
+// PurgeSoftDeletedOlderThan permanently removes records soft deleted more than d ago in a transaction.
+// Offerings, media links and memberships of purged organisations are removed with them even if not deleted
+func PurgeSoftDeletedOlderThan(d time.Duration) *cigExchange.APIError {
+
+	if d <= 0 {
+		return cigExchange.NewInvalidFieldError("retention", "Retention window must be positive")
+	}
+
+	deletedBefore := time.Now().Add(-d)
+	return cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		apiError := purgeOrganisationDependents(tx, deletedBefore)
+		if apiError != nil {
+			return apiError
+		}
+
+		for _, model := range softDeleteModels() {
+			db := tx.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).Delete(model)
+			if db.Error != nil {
+				return cigExchange.NewDatabaseError("Purge soft deleted records failed", db.Error)
+			}
+			logPurgedRecords(model, db.RowsAffected)
+		}
+		return nil
+	})
+}
+
+// purgeOrganisationDependents removes the records of organisations purged by the deletedBefore cutoff.
+// Media left without offering links is removed, media shared with other offerings is kept
+func purgeOrganisationDependents(tx *gorm.DB, deletedBefore time.Time) *cigExchange.APIError {
+
+	purgedOrganisations := tx.Unscoped().Model(&Organisation{}).Select("id").
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).QueryExpr()
+	purgedOfferings := tx.Unscoped().Model(&Offering{}).Select("id").
+		Where("organisation_id IN (?)", purgedOrganisations).QueryExpr()
+
+	mediaIDs := make([]string, 0)
+	db := tx.Unscoped().Model(&OfferingMedia{}).Where("offering_id IN (?)", purgedOfferings).Pluck("DISTINCT media_id", &mediaIDs)
+	if db.Error != nil && !db.RecordNotFound() {
+		return cigExchange.NewDatabaseError("Fetch purged organisation media failed", db.Error)
+	}
+
+	dependents := []struct {
+		model interface{}
+		where string
+		arg   interface{}
+	}{
+		{&OfferingMedia{}, "offering_id IN (?)", purgedOfferings},
+		{&Offering{}, "organisation_id IN (?)", purgedOrganisations},
+		{&OrganisationUser{}, "organisation_id IN (?)", purgedOrganisations},
+		{&OrganisationInviteCode{}, "organisation_id IN (?)", purgedOrganisations},
+	}
+	for _, dependent := range dependents {
+		db = tx.Unscoped().Where(dependent.where, dependent.arg).Delete(dependent.model)
+		if db.Error != nil {
+			return cigExchange.NewDatabaseError("Purge organisation records failed", db.Error)
+		}
+		logPurgedRecords(dependent.model, db.RowsAffected)
+	}
+
+	if len(mediaIDs) == 0 {
+		return nil
+	}
+	db = tx.Unscoped().Where("id IN (?) AND NOT EXISTS (SELECT 1 FROM offering_media WHERE offering_media.media_id = media.id)", mediaIDs).Delete(&Media{})
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Purge organisation media failed", db.Error)
+	}
+	logPurgedRecords(&Media{}, db.RowsAffected)
+	return nil
+}
+
+// logPurgedRecords logs the number of removed records of the model
+func logPurgedRecords(model interface{}, count int64) {
+
+	if count > 0 {
+		cigExchange.Logger().Info("PurgeSoftDeleted: records removed", "count", count, "model", fmt.Sprintf("%T", model))
+	}
+}
+
+// PurgeSoftDeleted permanently removes records soft deleted before the retention window
+// configured with SOFT_DELETE_RETENTION_DAYS
+func PurgeSoftDeleted() *cigExchange.APIError {
+	return PurgeSoftDeletedOlderThan(cigExchange.GetSoftDeleteRetention())
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"testing"
+	"time"
+)
+
+func TestPurgeOrganisationDependents(t *testing.T) {
+
+	requireDB(t)
+	organisation := createTestOrganisation(t)
+	offering := createTestOffering(t, organisation.ID, "purge-"+cigExchange.RandomUUID())
+	media := &Media{Type: "document", Title: "Purge test", URL: "https://example.com/purge.pdf"}
+	createTestRecord(t, media)
+	createTestRecord(t, &OfferingMedia{OfferingID: offering.ID, MediaID: media.ID})
+
+	// organisation is deleted before the retention window, its offering is live
+	deletedAt := time.Now().Add(-48 * time.Hour)
+	err := cigExchange.GetDB().Unscoped().Model(organisation).Update("deleted_at", deletedAt).Error
+	if err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	if apiError := PurgeSoftDeletedOlderThan(24 * time.Hour); apiError != nil {
+		t.Fatalf("purge failed: %v", apiError.ToString())
+	}
+
+	for _, record := range []interface{}{&Organisation{ID: organisation.ID}, &Offering{ID: offering.ID}, &Media{ID: media.ID}} {
+		count := 0
+		cigExchange.GetDB().Unscoped().Model(record).Where(record).Count(&count)
+		if count != 0 {
+			t.Errorf("%T is not purged", record)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"encoding/json"
+	"testing"
+
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+func createTestOrganisation(t *testing.T) *Organisation {
+
+	organisation := &Organisation{Name: "Restore test", ReferenceKey: cigExchange.RandomUUID()}
+	createTestRecord(t, organisation)
+	return organisation
+}
+
+func createTestUser(t *testing.T, role string) *User {
+
+	user := &User{Name: "Restore", LastName: "Test", Role: role, Status: UserStatusVerified}
+	createTestRecord(t, user)
+	return user
+}
+
+func createTestOrganisationAdmin(t *testing.T, organisationID string) *User {
+
+	user := createTestUser(t, UserRoleUser)
+	orgUser := &OrganisationUser{
+		OrganisationID:   organisationID,
+		UserID:           user.ID,
+		OrganisationRole: OrganisationRoleAdmin,
+		Status:           OrganisationUserStatusActive,
+	}
+	createTestRecord(t, orgUser)
+	return user
+}
+
+func createTestOffering(t *testing.T, organisationID, slug string) *Offering {
+
+	offering := &Offering{
+		OrganisationID: organisationID,
+		Slug:           &slug,
+		Title:          postgres.Jsonb{RawMessage: json.RawMessage(`{"en":"Restore test"}`)},
+	}
+	createTestRecord(t, offering)
+	return offering
+}
+
+func TestOfferingDeleteRestore(t *testing.T) {
+
+	requireDB(t)
+	organisation := createTestOrganisation(t)
+	offering := createTestOffering(t, organisation.ID, "restore-"+cigExchange.RandomUUID())
+	orgAdmin := createTestOrganisationAdmin(t, organisation.ID)
+
+	if apiError := offering.Delete(); apiError != nil {
+		t.Fatalf("delete failed: %v", apiError.ToString())
+	}
+	if _, apiError := GetOffering(offering.ID); apiError == nil {
+		t.Fatal("deleted offering is returned")
+	}
+
+	// other users can't restore the offering
+	regular := createTestUser(t, UserRoleUser)
+	apiError := (&Offering{ID: offering.ID}).Restore(regular.ID)
+	if apiError == nil || apiError.Code != 403 {
+		t.Fatalf("expected forbidden error, got %v", apiError)
+	}
+
+	if apiError := (&Offering{ID: offering.ID}).Restore(orgAdmin.ID); apiError != nil {
+		t.Fatalf("restore failed: %v", apiError.ToString())
+	}
+	if _, apiError := GetOffering(offering.ID); apiError != nil {
+		t.Fatalf("restored offering is not returned: %v", apiError.ToString())
+	}
+}
+
+func TestOfferingRestoreSlugCollision(t *testing.T) {
+
+	requireDB(t)
+	organisation := createTestOrganisation(t)
+	admin := createTestUser(t, UserRoleAdmin)
+	slug := "restore-" + cigExchange.RandomUUID()
+
+	deleted := createTestOffering(t, organisation.ID, slug)
+	if apiError := deleted.Delete(); apiError != nil {
+		t.Fatalf("delete failed: %v", apiError.ToString())
+	}
+
+	// the slug is free after the delete and is taken by a new offering
+	live := createTestOffering(t, organisation.ID, slug)
+
+	restored := &Offering{ID: deleted.ID}
+	if apiError := restored.Restore(admin.ID); apiError != nil {
+		t.Fatalf("restore failed: %v", apiError.ToString())
+	}
+	if restored.Slug == nil || *restored.Slug != slug+"-2" {
+		t.Errorf("expected slug %v-2, got %v", slug, restored.Slug)
+	}
+
+	stored, apiError := GetOffering(live.ID)
+	if apiError != nil {
+		t.Fatalf("fetch failed: %v", apiError.ToString())
+	}
+	if stored.Slug == nil || *stored.Slug != slug {
+		t.Errorf("live offering slug changed to %v", stored.Slug)
+	}
+}
+
+func TestOrganisationDeleteRestore(t *testing.T) {
+
+	requireDB(t)
+	organisation := createTestOrganisation(t)
+	orgAdmin := createTestOrganisationAdmin(t, organisation.ID)
+	admin := createTestUser(t, UserRoleAdmin)
+
+	if apiError := organisation.Delete(); apiError != nil {
+		t.Fatalf("delete failed: %v", apiError.ToString())
+	}
+	if _, apiError := GetOrganisation(organisation.ID); apiError == nil {
+		t.Fatal("deleted organisation is returned")
+	}
+
+	// organisations are restored only by platform admins
+	apiError := (&Organisation{ID: organisation.ID}).Restore(orgAdmin.ID)
+	if apiError == nil || apiError.Code != 403 {
+		t.Fatalf("expected forbidden error, got %v", apiError)
+	}
+
+	if apiError := (&Organisation{ID: organisation.ID}).Restore(admin.ID); apiError != nil {
+		t.Fatalf("restore failed: %v", apiError.ToString())
+	}
+	if _, apiError := GetOrganisation(organisation.ID); apiError != nil {
+		t.Fatalf("restored organisation is not returned: %v", apiError.ToString())
+	}
+}
+
+func TestMediaDeleteRestore(t *testing.T) {
+
+	requireDB(t)
+	organisation := createTestOrganisation(t)
+	offering := createTestOffering(t, organisation.ID, "restore-"+cigExchange.RandomUUID())
+	orgAdmin := createTestOrganisationAdmin(t, organisation.ID)
+
+	media := &Media{Type: "document", Title: "Restore test", URL: "https://example.com/restore.pdf"}
+	createTestRecord(t, media)
+	createTestRecord(t, &OfferingMedia{OfferingID: offering.ID, MediaID: media.ID})
+
+	if apiError := DeleteOfferingMedia(media.ID); apiError != nil {
+		t.Fatalf("delete failed: %v", apiError.ToString())
+	}
+
+	// admins of other organisations can't restore the media
+	otherAdmin := createTestOrganisationAdmin(t, createTestOrganisation(t).ID)
+	apiError := (&Media{ID: media.ID}).Restore(otherAdmin.ID)
+	if apiError == nil || apiError.Code != 403 {
+		t.Fatalf("expected forbidden error, got %v", apiError)
+	}
+
+	if apiError := (&Media{ID: media.ID}).Restore(orgAdmin.ID); apiError != nil {
+		t.Fatalf("restore failed: %v", apiError.ToString())
+	}
+	offeringMedia, apiError := GetOfferingMediaForOffering(offering.ID)
+	if apiError != nil {
+		t.Fatalf("fetch failed: %v", apiError.ToString())
+	}
+	if len(offeringMedia) != 1 || offeringMedia[0].MediaID != media.ID {
+		t.Errorf("offering media link is not restored: %v", offeringMedia)
+	}
+}
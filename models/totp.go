@@ -0,0 +1,110 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"errors"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// TOTP settings compatible with the authenticator apps
+const (
+	totpIssuer = "CIG Exchange"
+	totpPeriod = 30
+	// codes of one period before and after are accepted for the clock skew
+	totpSkew = 1
+)
+
+// GenerateTOTP generates a new TOTP secret for the user and stores it encrypted.
+// Returns the secret and the otpauth url for the QR code.
+// TOTP verification stays disabled until the secret is confirmed with ConfirmTOTP
+func (user *User) GenerateTOTP() (string, string, *cigExchange.APIError) {
+
+	// check that UUID is set
+	if len(user.ID) == 0 {
+		return "", "", cigExchange.NewInvalidFieldError("user_id", "User UUID is not set")
+	}
+
+	accountName := user.ID
+	if user.LoginEmail != nil && len(user.LoginEmail.Value1) > 0 {
+		accountName = user.LoginEmail.Value1
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: accountName,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return "", "", cigExchange.NewTokenError("TOTP secret generation failed", err)
+	}
+
+	// secret is encrypted by the column type
+	update := map[string]interface{}{
+		"totp_secret":  cigExchange.EncryptedString(key.Secret()),
+		"totp_enabled": false,
+	}
+	err = cigExchange.GetDB().Model(user).Updates(update).Error
+	if err != nil {
+		if errors.Is(err, cigExchange.ErrEncryptionKeyMissing) {
+			return "", "", cigExchange.NewEncryptionError("TOTP secret encryption failed", err)
+		}
+		return "", "", cigExchange.NewDatabaseError("Failed to update user", err)
+	}
+	return key.Secret(), key.URL(), nil
+}
+
+// ConfirmTOTP enables TOTP verification if the code matches the generated secret
+func (user *User) ConfirmTOTP(code string) *cigExchange.APIError {
+
+	valid, apiError := user.ValidateTOTP(code)
+	if apiError != nil {
+		return apiError
+	}
+	if !valid {
+		return cigExchange.NewInvalidFieldError("code", "Invalid code")
+	}
+
+	err := cigExchange.GetDB().Model(user).Update("totp_enabled", true).Error
+	if err != nil {
+		return cigExchange.NewDatabaseError("Failed to update user", err)
+	}
+	return nil
+}
+
+// ValidateTOTP returns true if the code matches the user TOTP secret within the clock skew window
+func (user *User) ValidateTOTP(code string) (bool, *cigExchange.APIError) {
+
+	_, valid, apiError := user.ValidateTOTPStep(code)
+	return valid, apiError
+}
+
+// ValidateTOTPStep checks the code like ValidateTOTP and returns the time step the code was generated for.
+// The step identifies the code within the skew window, used steps are rejected by the caller to stop replays
+func (user *User) ValidateTOTPStep(code string) (int64, bool, *cigExchange.APIError) {
+
+	if len(user.TOTPSecret) == 0 {
+		return 0, false, cigExchange.NewInvalidFieldError("type", "User doesn't have TOTP secret")
+	}
+
+	current := time.Now().UTC().Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		valid, err := totp.ValidateCustom(code, string(user.TOTPSecret), time.Unix(step*totpPeriod, 0).UTC(), totp.ValidateOpts{
+			Period:    totpPeriod,
+			Skew:      0,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			// malformed code
+			return 0, false, nil
+		}
+		if valid {
+			return step, true, nil
+		}
+	}
+	return 0, false, nil
+}
@@ -2,8 +2,8 @@ package models
 
 import (
 	cigExchange "cig-exchange-libs"
+	"context"
 	"encoding/json"
-	"log"
 	"strings"
 	"time"
 
@@ -23,24 +23,51 @@ const (
 	UserRoleUser  = "regular-p2p-user"
 )
 
+// UserPlatformUnknown is the platform of users registered before the signup platform was recorded
+const UserPlatformUnknown = "unknown"
+
 // User is a struct to represent a user
 type User struct {
-	ID             string     `json:"id" gorm:"column:id;primary_key"`
-	Title          string     `json:"title" gorm:"column:title"`
-	Role           string     `json:"-" gorm:"column:role;default:'regular-p2p-user'"`
-	Name           string     `json:"name" gorm:"column:name"`
-	LastName       string     `json:"lastname" gorm:"column:lastname"`
-	LoginEmail     *Contact   `json:"-" gorm:"foreignkey:LoginEmailUUID;association_foreignkey:ID"`
-	LoginEmailUUID *string    `json:"-" gorm:"column:login_email"`
-	LoginPhone     *Contact   `json:"-" gorm:"foreignkey:LoginPhoneUUID;association_foreignkey:ID"`
-	LoginPhoneUUID *string    `json:"-" gorm:"column:login_phone"`
-	LoginWebAuthn  string     `json:"-" gorm:"column:login_webauthn"`
-	Info           *Info      `json:"-" gorm:"foreignkey:InfoUUID;association_foreignkey:ID"`
-	InfoUUID       *string    `json:"-" gorm:"column:info"`
-	Status         string     `json:"-" gorm:"column:status;default:'unverified'"`
-	CreatedAt      time.Time  `json:"-" gorm:"column:created_at"`
-	UpdatedAt      time.Time  `json:"-" gorm:"column:updated_at"`
-	DeletedAt      *time.Time `json:"-" gorm:"column:deleted_at"`
+	ID             string                      `json:"id" gorm:"column:id;primary_key"`
+	Title          string                      `json:"title" gorm:"column:title"`
+	Role           string                      `json:"-" gorm:"column:role;default:'regular-p2p-user'"`
+	Name           string                      `json:"name" gorm:"column:name"`
+	LastName       string                      `json:"lastname" gorm:"column:lastname"`
+	LoginEmail     *Contact                    `json:"-" gorm:"foreignkey:LoginEmailUUID;association_foreignkey:ID"`
+	LoginEmailUUID *string                     `json:"-" gorm:"column:login_email"`
+	LoginPhone     *Contact                    `json:"-" gorm:"foreignkey:LoginPhoneUUID;association_foreignkey:ID"`
+	LoginPhoneUUID *string                     `json:"-" gorm:"column:login_phone"`
+	LoginWebAuthn  string                      `json:"-" gorm:"column:login_webauthn"`
+	TOTPSecret     cigExchange.EncryptedString `json:"-" gorm:"column:totp_secret;type:text"`
+	TOTPEnabled    bool                        `json:"-" gorm:"column:totp_enabled"`
+	Info           *Info                       `json:"-" gorm:"foreignkey:InfoUUID;association_foreignkey:ID"`
+	InfoUUID       *string                     `json:"-" gorm:"column:info"`
+	Status         string                      `json:"-" gorm:"column:status;default:'unverified'"`
+	Platform       string                      `json:"platform" gorm:"column:platform;default:'unknown'"`
+	CreatedAt      time.Time                   `json:"created_at" gorm:"column:created_at"`
+	UpdatedAt      time.Time                   `json:"updated_at" gorm:"column:updated_at"`
+	DeletedAt      *time.Time                  `json:"-" gorm:"column:deleted_at"`
+}
+
+// PublicUser is the user view safe to return to other users, e.g. in organisation member lists
+type PublicUser struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Name      string    `json:"name"`
+	LastName  string    `json:"lastname"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ToPublic returns the public view of the user
+func (user *User) ToPublic() *PublicUser {
+
+	return &PublicUser{
+		ID:        user.ID,
+		Title:     user.Title,
+		Name:      user.Name,
+		LastName:  user.LastName,
+		CreatedAt: user.CreatedAt,
+	}
 }
 
 // TableName returns table name for struct
@@ -67,8 +94,28 @@ func (user *User) UseWebAuthn() bool {
 	return len(user.LoginWebAuthn) > 0
 }
 
+// IsLoginContact returns true if contact is the user login email or phone
+func (user *User) IsLoginContact(contactID string) bool {
+
+	if len(contactID) == 0 {
+		return false
+	}
+	if user.LoginEmailUUID != nil && *user.LoginEmailUUID == contactID {
+		return true
+	}
+	if user.LoginPhoneUUID != nil && *user.LoginPhoneUUID == contactID {
+		return true
+	}
+	return false
+}
+
 // CreateUser inserts new user object into db
 func CreateUser(user *User, referenceKey string) (*User, *cigExchange.APIError) {
+	return CreateUserCtx(context.Background(), user, referenceKey)
+}
+
+// CreateUserCtx inserts new user object into db with the context
+func CreateUserCtx(ctx context.Context, user *User, referenceKey string) (*User, *cigExchange.APIError) {
 
 	// invalidate the uuid
 	user.ID = ""
@@ -79,20 +126,11 @@ func CreateUser(user *User, referenceKey string) (*User, *cigExchange.APIError)
 	}
 
 	org := &Organisation{}
-	// verify organisation reference key if present
+	var inviteCode *OrganisationInviteCode
+	// verify organisation invite code or reference key if present
 	if len(referenceKey) > 0 {
-
-		orgWhere := &Organisation{
-			ReferenceKey: referenceKey,
-		}
-		db := cigExchange.GetDB().Where(orgWhere).First(org)
-		if db.Error != nil {
-			// handle wrong reference key error and database error separately
-			if db.RecordNotFound() {
-				apiErr = cigExchange.NewInvalidFieldError("reference_key", "Organisation reference key is invalid")
-			} else {
-				apiErr = cigExchange.NewDatabaseError("Organization lookup failed", db.Error)
-			}
+		org, inviteCode, apiErr = resolveReferenceKey(referenceKey)
+		if apiErr != nil {
 			return nil, apiErr
 		}
 	}
@@ -100,7 +138,7 @@ func CreateUser(user *User, referenceKey string) (*User, *cigExchange.APIError)
 	contacts := make([]Contact, 0)
 
 	// check that email is unique
-	db := cigExchange.GetDB().Where("value1 = ?", user.LoginEmail.Value1).Find(&contacts)
+	db := whereContactEmail(cigExchange.GetDBWithContext(ctx), user.LoginEmail.Value1).Find(&contacts)
 	if db.Error != nil {
 		// we expect record not found error here
 		if !db.RecordNotFound() {
@@ -111,16 +149,21 @@ func CreateUser(user *User, referenceKey string) (*User, *cigExchange.APIError)
 		for _, contact := range contacts {
 			// handle existing users
 			existingUser := &User{}
-			if cigExchange.GetDB().Model(contact).Related(existingUser, "LoginEmail").Error == nil {
+			if cigExchange.GetDBWithContext(ctx).Model(contact).Related(existingUser, "LoginEmail").Error == nil {
 				if existingUser.Status == UserStatusVerified {
 					// return real user
 
 					// create organisation link for the user if necessary
 					if len(referenceKey) > 0 {
 						// check existing link to organisation
-						_, apiError := GetOrgUserRole(existingUser.ID, org.ID)
+						_, apiError := GetOrgUserRoleCtx(ctx, existingUser.ID, org.ID)
 						if apiError != nil {
 							// user don't belong to organisation
+							if inviteCode != nil {
+								if apiErr := inviteCode.use(cigExchange.GetDBWithContext(ctx)); apiErr != nil {
+									return nil, apiErr
+								}
+							}
 							orgUser := &OrganisationUser{
 								UserID:           existingUser.ID,
 								OrganisationID:   org.ID,
@@ -128,7 +171,10 @@ func CreateUser(user *User, referenceKey string) (*User, *cigExchange.APIError)
 								OrganisationRole: OrganisationRoleUser,
 								Status:           OrganisationUserStatusUnverified,
 							}
-							apiErr := orgUser.Create()
+							if inviteCode != nil {
+								orgUser.InviteCodeID = &inviteCode.ID
+							}
+							apiErr := orgUser.CreateCtx(ctx)
 							if apiErr != nil {
 								return nil, apiErr
 							}
@@ -150,31 +196,79 @@ func CreateUser(user *User, referenceKey string) (*User, *cigExchange.APIError)
 		}
 	}
 
-	// create new user
-	err := cigExchange.GetDB().Create(user).Error
-	if err != nil {
-		return nil, cigExchange.NewDatabaseError("Create user call failed", err)
-	}
+	// check that phone is unique, phone is normalized in TrimFieldsAndValidate
+	phoneContacts := make([]Contact, 0)
+	db = whereContactPhone(cigExchange.GetDBWithContext(ctx), user.LoginPhone.Value1, user.LoginPhone.Value2).Find(&phoneContacts)
+	if db.Error != nil {
+		// we expect record not found error here
+		if !db.RecordNotFound() {
+			return nil, cigExchange.NewDatabaseError("Contact lookup failed", db.Error)
+		}
+	} else {
+		unverifiedUsers := make([]*User, 0)
+		for _, contact := range phoneContacts {
+			existingUser := &User{}
+			if cigExchange.GetDBWithContext(ctx).Model(contact).Related(existingUser, "LoginPhone").Error == nil {
+				if existingUser.Status == UserStatusVerified {
+					return nil, cigExchange.NewUserAlreadyExistsError("User with provided phone number already exists")
+				}
+				unverifiedUsers = append(unverifiedUsers, existingUser)
+			}
+		}
 
-	// create user contacts links
-	apiError := createUserContacts(user)
-	if apiError != nil {
-		return nil, apiError
+		for _, unverifiedUser := range unverifiedUsers {
+			apiError := DeleteUnverifiedUser(unverifiedUser)
+			if apiError != nil {
+				return nil, apiError
+			}
+		}
 	}
 
-	// create organisation link for the user if necessary
-	if len(referenceKey) > 0 {
-		orgUser := &OrganisationUser{
-			UserID:           user.ID,
-			OrganisationID:   org.ID,
-			IsHome:           false,
-			OrganisationRole: OrganisationRoleUser,
-			Status:           OrganisationUserStatusUnverified,
-		}
-		apiErr := orgUser.Create()
-		if apiErr != nil {
-			return nil, apiErr
+	// create new user with contacts and organisation links in a transaction
+	apiError := cigExchange.WithTransactionCtx(ctx, func(tx *gorm.DB) *cigExchange.APIError {
+		err := tx.Create(user).Error
+		if err != nil {
+			// concurrent signup with the same email
+			if cigExchange.IsUniqueViolation(err) {
+				return cigExchange.NewUserAlreadyExistsError("User with provided email already exists")
+			}
+			return cigExchange.NewDatabaseError("Create user call failed", err)
+		}
+
+		// create user contacts links
+		apiError := createUserContacts(tx, user)
+		if apiError != nil {
+			return apiError
 		}
+
+		apiError = createEvent(tx, EventTypeUserCreated, user.ID, map[string]interface{}{"id": user.ID, "platform": user.Platform})
+		if apiError != nil {
+			return apiError
+		}
+
+		// create organisation link for the user if necessary
+		if len(referenceKey) > 0 {
+			if inviteCode != nil {
+				if apiErr := inviteCode.use(tx); apiErr != nil {
+					return apiErr
+				}
+			}
+			orgUser := &OrganisationUser{
+				UserID:           user.ID,
+				OrganisationID:   org.ID,
+				IsHome:           false,
+				OrganisationRole: OrganisationRoleUser,
+				Status:           OrganisationUserStatusUnverified,
+			}
+			if inviteCode != nil {
+				orgUser.InviteCodeID = &inviteCode.ID
+			}
+			return orgUser.create(tx)
+		}
+		return nil
+	})
+	if apiError != nil {
+		return nil, apiError
 	}
 
 	return user, nil
@@ -182,8 +276,13 @@ func CreateUser(user *User, referenceKey string) (*User, *cigExchange.APIError)
 
 // Save writes the user object changes into db
 func (user *User) Save() *cigExchange.APIError {
+	return user.SaveCtx(context.Background())
+}
+
+// SaveCtx writes the user object changes into db with the context
+func (user *User) SaveCtx(ctx context.Context) *cigExchange.APIError {
 
-	err := cigExchange.GetDB().Save(user).Error
+	err := cigExchange.GetDBWithContext(ctx).Save(user).Error
 	if err != nil {
 		return cigExchange.NewDatabaseError("Save user call failed", err)
 	}
@@ -192,19 +291,51 @@ func (user *User) Save() *cigExchange.APIError {
 
 // Update existing user object in db
 func (user *User) Update(update map[string]interface{}) *cigExchange.APIError {
+	return user.UpdateCtx(context.Background(), update)
+}
+
+// UpdateCtx updates existing user object in db with the context
+func (user *User) UpdateCtx(ctx context.Context, update map[string]interface{}) *cigExchange.APIError {
 
 	// check that UUID is set
 	if _, ok := update["id"]; !ok {
 		return cigExchange.NewInvalidFieldError("user_id", "User UUID is not set")
 	}
 
-	db := cigExchange.GetDB().Model(user).Updates(update)
+	db := cigExchange.GetDBWithContext(ctx).Model(user).Updates(update)
 	if db.Error != nil {
 		return cigExchange.NewDatabaseError("Failed to update user ", db.Error)
 	}
 	return nil
 }
 
+// MarkVerified sets the verified user status in db and records the user verified event
+func (user *User) MarkVerified() *cigExchange.APIError {
+
+	// check that UUID is set
+	if len(user.ID) == 0 {
+		return cigExchange.NewInvalidFieldError("user_id", "User UUID is not set")
+	}
+
+	return cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		err := tx.Model(user).Update("status", UserStatusVerified).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Failed to update user ", err)
+		}
+		return createEvent(tx, EventTypeUserVerified, user.ID, map[string]interface{}{"id": user.ID})
+	})
+}
+
+// BackfillUserPlatform sets the unknown platform for users without the signup platform
+func BackfillUserPlatform() *cigExchange.APIError {
+
+	db := cigExchange.GetDB().Exec(`UPDATE public.user SET platform = ? WHERE platform IS NULL OR platform = ''`, UserPlatformUnknown)
+	if db.Error != nil {
+		return cigExchange.NewDatabaseError("Failed to backfill user platform", db.Error)
+	}
+	return nil
+}
+
 // HasUserHomeOrganisation checks for user home organisation in db
 func (user *User) HasUserHomeOrganisation() (bool, *cigExchange.APIError) {
 
@@ -229,9 +360,30 @@ func (user *User) HasUserHomeOrganisation() (bool, *cigExchange.APIError) {
 	return true, nil
 }
 
-// DeleteUnverifiedUser deletes user, contacts, userContact, organisationUser
+// DeleteUnverifiedUser deletes user, contacts, userContact, organisationUser in a transaction.
+// The user status is checked again in the transaction, user verified in the meantime isn't deleted
 func DeleteUnverifiedUser(user *User) *cigExchange.APIError {
 
+	deleted, apiError := deleteUnverifiedUser(user, nil)
+	if apiError != nil {
+		return apiError
+	}
+	if !deleted {
+		return cigExchange.NewInvalidFieldError("user_id", "User is already verified")
+	}
+	return nil
+}
+
+// deleteUnverifiedUser deletes the user if it's still unverified and, if createdBefore is set, created before it.
+// The user row is locked, so concurrent verification waits for the deletion or prevents it.
+// Returns false if the user doesn't match anymore
+func deleteUnverifiedUser(user *User, createdBefore *time.Time) (bool, *cigExchange.APIError) {
+
+	// check that UUID is set
+	if len(user.ID) == 0 {
+		return false, cigExchange.NewInvalidFieldError("user_id", "User id is invalid")
+	}
+
 	// prefill the uuid
 	orgUserWhere := &OrganisationUser{
 		UserID: user.ID,
@@ -239,38 +391,263 @@ func DeleteUnverifiedUser(user *User) *cigExchange.APIError {
 	userContactWhere := &UserContact{
 		UserID: user.ID,
 	}
-	contactWhere := &Contact{
-		ID: *user.LoginEmailUUID,
+
+	deleted := false
+	apiError := cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		locked := &User{}
+		query := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ? AND status = ?", user.ID, UserStatusUnverified)
+		if createdBefore != nil {
+			query = query.Where("created_at < ?", *createdBefore)
+		}
+		db := query.First(locked)
+		if db.Error != nil {
+			if db.RecordNotFound() {
+				return nil
+			}
+			return cigExchange.NewDatabaseError("User lookup failed", db.Error)
+		}
+
+		// delete contact
+		if locked.LoginEmailUUID != nil && len(*locked.LoginEmailUUID) > 0 {
+			contactWhere := &Contact{
+				ID: *locked.LoginEmailUUID,
+			}
+			err := tx.Where(contactWhere).Delete(Contact{}).Error
+			if err != nil {
+				return cigExchange.NewDatabaseError("Delete contact call failed", err)
+			}
+		}
+
+		// delete user contact connections
+		err := tx.Where(userContactWhere).Delete(UserContact{}).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Delete user contact links call failed", err)
+		}
+
+		// delete unverified user
+		err = tx.Delete(locked).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Delete user call failed", err)
+		}
+
+		// invite code uses of the never verified signup are given back
+		apiError := releaseInviteCodeUses(tx, user.ID)
+		if apiError != nil {
+			return apiError
+		}
+
+		// delete organization user connections
+		err = tx.Where(orgUserWhere).Delete(OrganisationUser{}).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Delete organization user links call failed", err)
+		}
+		deleted = true
+		return nil
+	})
+	return deleted, apiError
+}
+
+// PurgeStaleUnverifiedUsers deletes unverified users created more than olderThan ago.
+// Returns the number of deleted users
+func PurgeStaleUnverifiedUsers(olderThan time.Duration) (int64, *cigExchange.APIError) {
+
+	if olderThan <= 0 {
+		return 0, cigExchange.NewInvalidFieldError("older_than", "Purge age must be positive")
+	}
+
+	createdBefore := time.Now().Add(-olderThan)
+	users := make([]*User, 0)
+	db := cigExchange.GetDB().Where("status = ? and created_at < ?", UserStatusUnverified, createdBefore).Find(&users)
+	if db.Error != nil && !db.RecordNotFound() {
+		return 0, cigExchange.NewDatabaseError("Stale unverified users lookup failed", db.Error)
 	}
 
-	// delete contact
-	err := cigExchange.GetDB().Where(contactWhere).Delete(Contact{}).Error
-	if err != nil {
-		return cigExchange.NewDatabaseError("Delete contact call failed", err)
+	var count int64
+	for _, user := range users {
+		// users verified since the lookup are skipped
+		deleted, apiError := deleteUnverifiedUser(user, &createdBefore)
+		if apiError != nil {
+			return count, apiError
+		}
+		if deleted {
+			count++
+		}
 	}
 
-	// delete user contact connections
-	err = cigExchange.GetDB().Where(userContactWhere).Delete(UserContact{}).Error
-	if err != nil {
-		return cigExchange.NewDatabaseError("Delete user contact links call failed", err)
+	if count > 0 {
+		cigExchange.Logger().Info("PurgeStaleUnverifiedUsers: users removed", "count", count)
 	}
+	return count, nil
+}
 
-	// delete unverified user
-	err = cigExchange.GetDB().Delete(user).Error
-	if err != nil {
-		return cigExchange.NewDatabaseError("Delete user call failed", err)
+// HardDelete permanently removes the user with contacts, contact and organisation links,
+// info and activities from db. Used for the legally required data erasure
+func (user *User) HardDelete() *cigExchange.APIError {
+
+	// check that UUID is set
+	if len(user.ID) == 0 {
+		return cigExchange.NewInvalidFieldError("user_id", "User id is invalid")
 	}
 
-	// delete organization user connections
-	err = cigExchange.GetDB().Where(orgUserWhere).Delete(OrganisationUser{}).Error
-	if err != nil {
-		return cigExchange.NewDatabaseError("Delete organization user links call failed", err)
+	// query all user contacts including soft deleted
+	userContacts := make([]*UserContact, 0)
+	db := cigExchange.GetDB().Unscoped().Where(&UserContact{UserID: user.ID}).Find(&userContacts)
+	if db.Error != nil && !db.RecordNotFound() {
+		return cigExchange.NewDatabaseError("Fetch user contacts failed", db.Error)
+	}
+	contactIDs := make([]string, 0)
+	for _, userContact := range userContacts {
+		contactIDs = append(contactIDs, userContact.ContactID)
 	}
 
-	return nil
+	apiError := cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&UserContact{}).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Delete user contact links call failed", err)
+		}
+
+		err = tx.Unscoped().Where("user_id = ?", user.ID).Delete(&OrganisationUser{}).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Delete organization user links call failed", err)
+		}
+
+		err = tx.Unscoped().Where("user_id = ?", user.ID).Delete(&UserActivity{}).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Delete user activities call failed", err)
+		}
+
+		err = tx.Unscoped().Delete(user).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Delete user call failed", err)
+		}
+
+		if len(contactIDs) > 0 {
+			err = tx.Unscoped().Where("id IN (?)", contactIDs).Delete(&Contact{}).Error
+			if err != nil {
+				return cigExchange.NewDatabaseError("Delete contacts call failed", err)
+			}
+		}
+
+		if user.InfoUUID != nil && len(*user.InfoUUID) > 0 {
+			err = tx.Unscoped().Delete(&Info{ID: *user.InfoUUID}).Error
+			if err != nil {
+				return cigExchange.NewDatabaseError("Delete user info call failed", err)
+			}
+		}
+		return nil
+	})
+	if apiError != nil {
+		return apiError
+	}
+
+	// erased user can't be signed in anymore
+	return cigExchange.InvalidateUserTokens(user.ID)
 }
 
-func createUserContacts(user *User) *cigExchange.APIError {
+// SetPrimaryLoginEmail makes the user email contact the login email
+func SetPrimaryLoginEmail(userID, contactID string) *cigExchange.APIError {
+	return setPrimaryLoginContact(userID, contactID, ContactTypeEmail)
+}
+
+// SetPrimaryLoginPhone makes the user phone contact the login phone
+func SetPrimaryLoginPhone(userID, contactID string) *cigExchange.APIError {
+	return setPrimaryLoginContact(userID, contactID, ContactTypePhone)
+}
+
+// setPrimaryLoginContact swaps the user login contact of contactType in a transaction.
+// The contact must be verified with its current value.
+// Previous login contact becomes secondary, all user tokens are invalidated
+func setPrimaryLoginContact(userID, contactID, contactType string) *cigExchange.APIError {
+
+	// check that UUIDs are set
+	if len(userID) == 0 {
+		return cigExchange.NewInvalidFieldError("user_id", "User id is invalid")
+	}
+	if len(contactID) == 0 {
+		return cigExchange.NewInvalidFieldError("contact_id", "Contact id is invalid")
+	}
+
+	// check that contact belongs to user
+	userContact := &UserContact{}
+	db := cigExchange.GetDB().Where(&UserContact{UserID: userID, ContactID: contactID}).First(userContact)
+	if db.Error != nil {
+		if db.RecordNotFound() {
+			return cigExchange.NewInvalidFieldError("user_id, contact_id", "Contact with provided user_id and contact_id doesn't exist")
+		}
+		return cigExchange.NewDatabaseError("Fetch user_contact failed", db.Error)
+	}
+
+	contact, apiError := GetContact(contactID)
+	if apiError != nil {
+		return apiError
+	}
+	if contact.Type != contactType {
+		return cigExchange.NewInvalidFieldError("contact_id", "Contact type is not "+contactType)
+	}
+	// only verified contacts can be used for login
+	if !contact.IsVerified() {
+		return cigExchange.NewInvalidFieldError("contact_id", "Contact is not verified")
+	}
+
+	user, apiError := GetUser(userID)
+	if apiError != nil {
+		return apiError
+	}
+
+	column := "login_email"
+	previousContactID := user.LoginEmailUUID
+	if contactType == ContactTypePhone {
+		column = "login_phone"
+		previousContactID = user.LoginPhoneUUID
+	}
+
+	// contact is already the login contact
+	if previousContactID != nil && *previousContactID == contactID {
+		return nil
+	}
+
+	apiError = cigExchange.WithTransaction(func(tx *gorm.DB) *cigExchange.APIError {
+		// contact value could be updated since it was checked, the update clears the verification status
+		locked := &Contact{}
+		db := tx.Set("gorm:query_option", "FOR UPDATE").Where(&Contact{ID: contactID}).First(locked)
+		if db.Error != nil {
+			if db.RecordNotFound() {
+				return cigExchange.NewInvalidFieldError("contact_id", "Contact with provided id doesn't exist")
+			}
+			return cigExchange.NewDatabaseError("Fetch contact failed", db.Error)
+		}
+		if !locked.IsVerified() || locked.Value1 != contact.Value1 || locked.Value2 != contact.Value2 {
+			return cigExchange.NewInvalidFieldError("contact_id", "Contact changed after verification")
+		}
+
+		err := tx.Model(user).Update(column, contactID).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Failed to update user login contact", err)
+		}
+
+		err = tx.Model(contact).Update("level", ContactLevelPrimary).Error
+		if err != nil {
+			return cigExchange.NewDatabaseError("Failed to update contact level", err)
+		}
+
+		if previousContactID != nil && len(*previousContactID) > 0 {
+			err = tx.Model(&Contact{ID: *previousContactID}).Update("level", ContactLevelSecondary).Error
+			if err != nil {
+				return cigExchange.NewDatabaseError("Failed to update contact level", err)
+			}
+		}
+		return nil
+	})
+	if apiError != nil {
+		return apiError
+	}
+
+	// login identity changed, user has to sign in again
+	return cigExchange.InvalidateUserTokens(userID)
+}
+
+// createUserContacts creates the login contacts links of the new user using db, it can be a transaction
+func createUserContacts(db *gorm.DB, user *User) *cigExchange.APIError {
 
 	if user.LoginEmailUUID != nil && len(*user.LoginEmailUUID) > 0 {
 		// create email UserContact
@@ -279,7 +656,7 @@ func createUserContacts(user *User) *cigExchange.APIError {
 			ContactID: *user.LoginEmailUUID,
 		}
 
-		err := cigExchange.GetDB().Create(userContact).Error
+		err := db.Create(userContact).Error
 		if err != nil {
 			return cigExchange.NewDatabaseError("Create user contact link failed", err)
 		}
@@ -292,7 +669,7 @@ func createUserContacts(user *User) *cigExchange.APIError {
 			ContactID: *user.LoginPhoneUUID,
 		}
 
-		err := cigExchange.GetDB().Create(userContact).Error
+		err := db.Create(userContact).Error
 		if err != nil {
 			return cigExchange.NewDatabaseError("Create user contact link failed", err)
 		}
@@ -303,6 +680,11 @@ func createUserContacts(user *User) *cigExchange.APIError {
 
 // GetUser queries a single user from db
 func GetUser(UUID string) (user *User, apiErr *cigExchange.APIError) {
+	return GetUserCtx(context.Background(), UUID)
+}
+
+// GetUserCtx queries a single user from db with the context
+func GetUserCtx(ctx context.Context, UUID string) (user *User, apiErr *cigExchange.APIError) {
 
 	user = &User{}
 	userWhere := &User{
@@ -313,7 +695,7 @@ func GetUser(UUID string) (user *User, apiErr *cigExchange.APIError) {
 		return
 	}
 
-	db := cigExchange.GetDB().Preload("LoginEmail").Preload("LoginPhone").Where(userWhere).First(user)
+	db := cigExchange.GetDBWithContext(ctx).Preload("LoginEmail").Preload("LoginPhone").Where(userWhere).First(user)
 	if db.Error != nil {
 		if db.RecordNotFound() {
 			apiErr = cigExchange.NewUserDoesntExistError("User with provided uuid doesn't exist")
@@ -325,70 +707,163 @@ func GetUser(UUID string) (user *User, apiErr *cigExchange.APIError) {
 	return
 }
 
+// GetUsersByIDs queries users with login emails from db in a single query.
+// Returns users by id, missing ids are skipped
+func GetUsersByIDs(ids []string) (map[string]*User, *cigExchange.APIError) {
+
+	usersByID := make(map[string]*User, len(ids))
+	if len(ids) == 0 {
+		return usersByID, nil
+	}
+
+	users := make([]*User, 0, len(ids))
+	db := cigExchange.GetDB().Preload("LoginEmail").Where("id IN (?)", ids).Find(&users)
+	if db.Error != nil && !db.RecordNotFound() {
+		return usersByID, cigExchange.NewDatabaseError("Users lookup failed", db.Error)
+	}
+
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+	return usersByID, nil
+}
+
+// GetUsersByStatus queries a page of users with the status from db and the total count of matching users.
+// Zero createdBefore time and non positive limit disable the corresponding filter
+func GetUsersByStatus(status string, createdBefore time.Time, limit, offset int) ([]*User, int, *cigExchange.APIError) {
+
+	users := make([]*User, 0)
+	total := 0
+
+	if status != UserStatusUnverified && status != UserStatusVerified {
+		return users, total, cigExchange.NewInvalidFieldError("status", "User status is invalid")
+	}
+
+	db := cigExchange.GetDB().Model(&User{}).Where("status = ?", status)
+	if !createdBefore.IsZero() {
+		db = db.Where("created_at < ?", createdBefore)
+	}
+
+	// count all matching users
+	countDB := db.Count(&total)
+	if countDB.Error != nil {
+		return users, total, cigExchange.NewDatabaseError("Users count failed", countDB.Error)
+	}
+
+	db = db.Preload("LoginEmail").Order("created_at").Order("id")
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	if offset > 0 {
+		db = db.Offset(offset)
+	}
+
+	db = db.Find(&users)
+	if db.Error != nil {
+		if !db.RecordNotFound() {
+			return users, total, cigExchange.NewDatabaseError("Users lookup failed", db.Error)
+		}
+	}
+	return users, total, nil
+}
+
+// GetUsersByReferenceKey resolves the organisation reference key and queries users linked to the organisation.
+// Used for partner onboarding reports
+func GetUsersByReferenceKey(referenceKey string) (*Organisation, []*User, *cigExchange.APIError) {
+
+	users := make([]*User, 0)
+
+	referenceKey = strings.TrimSpace(referenceKey)
+	if len(referenceKey) == 0 {
+		return nil, users, cigExchange.NewRequiredFieldError([]string{"reference_key"})
+	}
+
+	org, apiError := GetOrganisationByReferenceKey(referenceKey)
+	if apiError != nil {
+		return nil, users, apiError
+	}
+
+	db := cigExchange.GetDB().Preload("LoginEmail").
+		Joins("INNER JOIN organisation_user ON organisation_user.user_id = \"user\".id AND organisation_user.deleted_at IS NULL").
+		Where("organisation_user.organisation_id = ?", org.ID).
+		Order("\"user\".created_at").Find(&users)
+	if db.Error != nil {
+		if !db.RecordNotFound() {
+			return org, users, cigExchange.NewDatabaseError("Organisation users lookup failed", db.Error)
+		}
+	}
+	return org, users, nil
+}
+
 // GetUserByEmail queries a single user from db
 // Fucntions can return (nil, nil) if ignoreRecordNotFound is true
 func GetUserByEmail(email string, ignoreRecordNotFound bool) (user *User, apiErr *cigExchange.APIError) {
+	return GetUserByEmailCtx(context.Background(), email, ignoreRecordNotFound)
+}
 
-	contWhere := &Contact{
-		Value1: strings.TrimSpace(email),
-	}
+// GetUserByEmailCtx queries a single user from db
+// Fucntions can return (nil, nil) if ignoreRecordNotFound is true with the context.
+// Verified user is preferred over unverified users with the same email, the latest unverified user is returned otherwise.
+// Several verified users with the same email are reported as an error
+func GetUserByEmailCtx(ctx context.Context, email string, ignoreRecordNotFound bool) (user *User, apiErr *cigExchange.APIError) {
+
+	email = strings.TrimSpace(email)
 	// check email length
-	if len(contWhere.Value1) == 0 {
+	if len(email) == 0 {
 		apiErr = cigExchange.NewRequiredFieldError([]string{"email"})
 		return
 	}
 
-	user = nil
+	// query all users with login email contacts matching the email, latest first
+	contactIDs := whereContactEmail(cigExchange.GetDBWithContext(ctx).Model(&Contact{}).Select("id"), email).QueryExpr()
+	users := make([]*User, 0)
+	db := cigExchange.GetDBWithContext(ctx).Preload("LoginEmail").Preload("LoginPhone").
+		Where("login_email IN (?)", contactIDs).Order("created_at desc").Find(&users)
+	if db.Error != nil && !db.RecordNotFound() {
+		apiErr = cigExchange.NewDatabaseError("User lookup failed", db.Error)
+		return
+	}
 
-	// query all contacts
-	conts := make([]*Contact, 0)
-	db := cigExchange.GetDB().Where(contWhere).Find(&conts)
-	if db.Error != nil {
-		if db.RecordNotFound() {
-			if ignoreRecordNotFound {
-				return nil, nil
-			}
-			apiErr = cigExchange.NewUserDoesntExistError("Contact with provided email doesn't exist")
-		} else {
-			apiErr = cigExchange.NewDatabaseError("Contact lookup failed", db.Error)
+	if len(users) == 0 {
+		if !ignoreRecordNotFound {
+			apiErr = cigExchange.NewUserDoesntExistError("User with provided email doesn't exist")
 		}
 		return
 	}
 
-	for _, cont := range conts {
-		u := &User{}
-		db = cigExchange.GetDB().Model(cont).Preload("LoginEmail").Preload("LoginPhone").Related(u, "LoginEmail")
-		if db.Error != nil {
-			// ignore contacts
-			if !db.RecordNotFound() {
-				apiErr = cigExchange.NewUserDoesntExistError("User with provided email doesn't exist")
-			}
-		} else {
-			user = u
+	for _, u := range users {
+		if u.Status != UserStatusVerified {
+			continue
 		}
+		if user != nil {
+			cigExchange.Logger().Error("GetUserByEmail: several verified users share the email", "user_ids", []string{user.ID, u.ID})
+			return nil, cigExchange.NewInternalServerError(cigExchange.ReasonDatabaseFailure, "Several users share the email")
+		}
+		user = u
 	}
 
-	if user == nil && !ignoreRecordNotFound {
-		apiErr = cigExchange.NewUserDoesntExistError("User lookup failed")
+	if user == nil {
+		user = users[0]
 	}
-
 	return
 }
 
 // GetUserByMobile queries a single user from db
 func GetUserByMobile(code, number string) (user *User, apiErr *cigExchange.APIError) {
+	return GetUserByMobileCtx(context.Background(), code, number)
+}
 
-	cont := &Contact{}
-	contWhere := &Contact{
-		Value1: strings.TrimSpace(code),
-		Value2: strings.TrimSpace(number),
-	}
+// GetUserByMobileCtx queries a single user from db with the context
+func GetUserByMobileCtx(ctx context.Context, code, number string) (user *User, apiErr *cigExchange.APIError) {
+
+	code = strings.TrimSpace(code)
+	number = strings.TrimSpace(number)
 
 	missingFieldNames := make([]string, 0)
-	if len(contWhere.Value1) == 0 {
+	if len(code) == 0 {
 		missingFieldNames = append(missingFieldNames, "phone_country_code")
 	}
-	if len(contWhere.Value2) == 0 {
+	if len(number) == 0 {
 		missingFieldNames = append(missingFieldNames, "phone_number")
 	}
 	if len(missingFieldNames) > 0 {
@@ -396,7 +871,14 @@ func GetUserByMobile(code, number string) (user *User, apiErr *cigExchange.APIEr
 		return
 	}
 
-	db := cigExchange.GetDB().Where(contWhere).First(cont)
+	// phone contacts are stored in the canonical form
+	code, number, apiErr = cigExchange.NormalizePhone(code, number)
+	if apiErr != nil {
+		return
+	}
+
+	cont := &Contact{}
+	db := whereContactPhone(cigExchange.GetDBWithContext(ctx), code, number).First(cont)
 	if db.Error != nil {
 		if db.RecordNotFound() {
 			apiErr = cigExchange.NewUserDoesntExistError("User with provided phone number doesn't exist")
@@ -407,7 +889,7 @@ func GetUserByMobile(code, number string) (user *User, apiErr *cigExchange.APIEr
 	}
 
 	user = &User{}
-	db = cigExchange.GetDB().Model(cont).Preload("LoginEmail").Preload("LoginPhone").Related(user, "LoginPhone")
+	db = cigExchange.GetDBWithContext(ctx).Model(cont).Preload("LoginEmail").Preload("LoginPhone").Related(user, "LoginPhone")
 	if db.Error != nil {
 		if db.RecordNotFound() {
 			apiErr = cigExchange.NewUserDoesntExistError("User with provided phone number doesn't exist")
@@ -420,8 +902,33 @@ func GetUserByMobile(code, number string) (user *User, apiErr *cigExchange.APIEr
 	return
 }
 
+// GetUserByEmailOrPhone queries a single user by email or, if email is empty, by phone number from db.
+// Required field error is returned if neither is provided
+func GetUserByEmailOrPhone(email, code, number string) (*User, *cigExchange.APIError) {
+	return GetUserByEmailOrPhoneCtx(context.Background(), email, code, number)
+}
+
+// GetUserByEmailOrPhoneCtx queries a single user by email or phone number from db with the context
+func GetUserByEmailOrPhoneCtx(ctx context.Context, email, code, number string) (*User, *cigExchange.APIError) {
+
+	// login using email or phone number
+	if len(email) > 0 {
+		return GetUserByEmailCtx(ctx, email, false)
+	}
+	if len(code) > 0 && len(number) > 0 {
+		return GetUserByMobileCtx(ctx, code, number)
+	}
+	// neither email or phone specified
+	return nil, cigExchange.NewRequiredFieldError([]string{"email", "phone_number", "phone_country_code"})
+}
+
 // GetUserRole returns user role
 func GetUserRole(userUUID string) (role string, apiError *cigExchange.APIError) {
+	return GetUserRoleCtx(context.Background(), userUUID)
+}
+
+// GetUserRoleCtx returns user role with the context
+func GetUserRoleCtx(ctx context.Context, userUUID string) (role string, apiError *cigExchange.APIError) {
 
 	// check user id
 	if len(userUUID) == 0 {
@@ -429,7 +936,7 @@ func GetUserRole(userUUID string) (role string, apiError *cigExchange.APIError)
 	}
 
 	// get user
-	user, apiErr := GetUser(userUUID)
+	user, apiErr := GetUserCtx(ctx, userUUID)
 	if apiErr != nil {
 		return "", apiErr
 	}
@@ -439,6 +946,11 @@ func GetUserRole(userUUID string) (role string, apiError *cigExchange.APIError)
 
 // GetOrgUserRole returns user role in organisation
 func GetOrgUserRole(userUUID, organisationUUID string) (role string, apiError *cigExchange.APIError) {
+	return GetOrgUserRoleCtx(context.Background(), userUUID, organisationUUID)
+}
+
+// GetOrgUserRoleCtx returns user role in organisation with the context
+func GetOrgUserRoleCtx(ctx context.Context, userUUID, organisationUUID string) (role string, apiError *cigExchange.APIError) {
 
 	// check user id
 	if len(userUUID) == 0 {
@@ -463,7 +975,7 @@ func GetOrgUserRole(userUUID, organisationUUID string) (role string, apiError *c
 	return orgUser.OrganisationRole, nil
 }
 
-// TrimFieldsAndValidate checks user for invalid fields
+// TrimFieldsAndValidate checks user for invalid fields, all missing and invalid fields are returned as nested errors
 func (user *User) TrimFieldsAndValidate() *cigExchange.APIError {
 
 	user.Name = strings.TrimSpace(user.Name)
@@ -472,31 +984,25 @@ func (user *User) TrimFieldsAndValidate() *cigExchange.APIError {
 	user.LoginPhone.Value1 = strings.TrimSpace(user.LoginPhone.Value1)
 	user.LoginPhone.Value2 = strings.TrimSpace(user.LoginPhone.Value2)
 
-	missingFieldNames := make([]string, 0)
-	if len(user.Name) == 0 {
-		missingFieldNames = append(missingFieldNames, "name")
-	}
-	if len(user.LastName) == 0 {
-		missingFieldNames = append(missingFieldNames, "lastname")
-	}
-	if len(user.LoginEmail.Value1) == 0 {
-		missingFieldNames = append(missingFieldNames, "email")
-	}
-	if len(user.LoginPhone.Value1) == 0 {
-		missingFieldNames = append(missingFieldNames, "phone_country_code")
-	}
-	if len(user.LoginPhone.Value2) == 0 {
-		missingFieldNames = append(missingFieldNames, "phone_number")
-	}
-	if len(missingFieldNames) > 0 {
-		return cigExchange.NewRequiredFieldError(missingFieldNames)
-	}
-
-	if !strings.Contains(user.LoginEmail.Value1, "@") {
-		return cigExchange.NewInvalidFieldError("email", "Invalid email address")
+	// missing and invalid fields are reported together
+	v := cigExchange.NewValidator().
+		Field("name", user.Name, cigExchange.Required).
+		Field("lastname", user.LastName, cigExchange.Required).
+		Field("email", user.LoginEmail.Value1, cigExchange.Required, cigExchange.Email).
+		Field("phone_country_code", user.LoginPhone.Value1, cigExchange.Required).
+		Field("phone_number", user.LoginPhone.Value2, cigExchange.Required)
+
+	// phone is stored in the canonical form
+	if v.IsValid("phone_country_code") && v.IsValid("phone_number") {
+		code, number, apiError := cigExchange.NormalizePhone(user.LoginPhone.Value1, user.LoginPhone.Value2)
+		if apiError == nil {
+			user.LoginPhone.Value1 = code
+			user.LoginPhone.Value2 = number
+		}
+		v.Check(apiError)
 	}
 
-	return nil
+	return v.Error()
 }
 
 // WebAuthnID returns the user ID as a byte slice
@@ -532,7 +1038,7 @@ func (user *User) WebAuthnCredentials() []webauthn.Credential {
 	if len(user.LoginWebAuthn) > 0 {
 		credential := webauthn.Credential{}
 		if err := json.Unmarshal([]byte(user.LoginWebAuthn), &credential); err != nil {
-			log.Printf("Web Authn: Can't parse credential %v\n", err.Error())
+			cigExchange.Logger().Warn("Web Authn: can't parse credential", "user_id", user.ID, "error", err.Error())
 
 			return creadentials
 		}
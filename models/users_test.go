@@ -0,0 +1,280 @@
+package models
+
+import (
+	cigExchange "cig-exchange-libs"
+	"testing"
+	"time"
+)
+
+// createTestLoginUser creates the verified user with login email and phone contacts
+func createTestLoginUser(t *testing.T, email, code, number string) *User {
+
+	loginEmail := &Contact{Level: ContactLevelPrimary, Type: ContactTypeEmail, Value1: email}
+	createTestRecord(t, loginEmail)
+	loginPhone := &Contact{Level: ContactLevelPrimary, Type: ContactTypePhone, Value1: code, Value2: number}
+	createTestRecord(t, loginPhone)
+
+	user := &User{
+		Name:           "Lookup",
+		LastName:       "Test",
+		Role:           UserRoleUser,
+		Status:         UserStatusVerified,
+		LoginEmailUUID: &loginEmail.ID,
+		LoginPhoneUUID: &loginPhone.ID,
+	}
+	createTestRecord(t, user)
+	return user
+}
+
+func TestGetUserByEmailOrPhoneRequiresEmailOrPhone(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		code   string
+		number string
+	}{
+		{"nothing", "", ""},
+		{"only country code", "41", ""},
+		{"only number", "", "791234567"},
+	}
+
+	for _, test := range tests {
+		user, apiError := GetUserByEmailOrPhone("", test.code, test.number)
+		if user != nil || apiError == nil {
+			t.Errorf("%s: expected error, got user %v", test.name, user)
+			continue
+		}
+		if apiError.Code != 400 || len(apiError.Errors) != 3 || apiError.Errors[0].Reason != cigExchange.ReasonFieldMissing {
+			t.Errorf("%s: expected missing email and phone, got %v", test.name, apiError.ToString())
+		}
+	}
+}
+
+func TestGetUserByEmailOrPhone(t *testing.T) {
+
+	requireDB(t)
+	email := "lookup-" + cigExchange.RandomUUID() + "@example.com"
+	user := createTestLoginUser(t, email, "41", "791234567")
+
+	tests := []struct {
+		name   string
+		email  string
+		code   string
+		number string
+	}{
+		{"email", email, "", ""},
+		{"phone", "", "41", "791234567"},
+		{"phone in other form", "", "+41", "079 123 45 67"},
+		// email is preferred
+		{"email and wrong phone", email, "41", "790000000"},
+	}
+
+	for _, test := range tests {
+		found, apiError := GetUserByEmailOrPhone(test.email, test.code, test.number)
+		if apiError != nil {
+			t.Errorf("%s: lookup failed: %v", test.name, apiError.ToString())
+			continue
+		}
+		if found.ID != user.ID || found.LoginEmail == nil || found.LoginPhone == nil {
+			t.Errorf("%s: expected user %v with login contacts, got %+v", test.name, user.ID, found)
+		}
+	}
+
+	// missing users are reported with the silenced error
+	missing := []struct {
+		name   string
+		email  string
+		code   string
+		number string
+	}{
+		{"missing email", "missing-" + cigExchange.RandomUUID() + "@example.com", "", ""},
+		{"missing phone", "", "41", "790000000"},
+	}
+
+	for _, test := range missing {
+		found, apiError := GetUserByEmailOrPhone(test.email, test.code, test.number)
+		if apiError == nil {
+			t.Errorf("%s: expected error, got user %v", test.name, found.ID)
+			continue
+		}
+		if apiError.Errors[0].Reason != cigExchange.ReasonUserDoesntExist || !apiError.ShouldSilenceError() {
+			t.Errorf("%s: expected silenced user doesn't exist error, got %v", test.name, apiError.ToString())
+		}
+	}
+}
+
+func TestGetUserByEmailDuplicateContacts(t *testing.T) {
+
+	requireDB(t)
+
+	// duplicate email contacts exist only in data created before the unique indexes,
+	// the indexes are recreated after the test records are removed
+	err := cigExchange.GetDB().Exec("DROP INDEX IF EXISTS contact_email_unique_idx; DROP INDEX IF EXISTS contact_email_hash_unique_idx;").Error
+	if err != nil {
+		t.Fatalf("drop indexes failed: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, createIndexes := range []func() *cigExchange.APIError{CreateContactIndexes, CreateContactHashIndexes} {
+			if apiError := createIndexes(); apiError != nil {
+				t.Errorf("create indexes failed: %v", apiError.ToString())
+			}
+		}
+	})
+
+	// createEmailUser creates the user with its own login contact for the email
+	createEmailUser := func(email, status string, createdAt time.Time) *User {
+		loginEmail := &Contact{Level: ContactLevelPrimary, Type: ContactTypeEmail, Value1: email}
+		createTestRecord(t, loginEmail)
+		user := &User{Name: "Duplicate", LastName: "Test", Role: UserRoleUser, Status: status, LoginEmailUUID: &loginEmail.ID, CreatedAt: createdAt}
+		createTestRecord(t, user)
+		return user
+	}
+	now := time.Now()
+
+	// verified user is preferred over the newer unverified one
+	email := "duplicate-" + cigExchange.RandomUUID() + "@example.com"
+	verified := createEmailUser(email, UserStatusVerified, now.Add(-time.Hour))
+	createEmailUser(email, UserStatusUnverified, now)
+	user, apiError := GetUserByEmail(email, false)
+	if apiError != nil || user.ID != verified.ID {
+		t.Errorf("expected verified user %v, got %v %v", verified.ID, user, apiError)
+	}
+
+	// latest unverified user is returned without verified users
+	email = "duplicate-" + cigExchange.RandomUUID() + "@example.com"
+	createEmailUser(email, UserStatusUnverified, now.Add(-time.Hour))
+	latest := createEmailUser(email, UserStatusUnverified, now)
+	user, apiError = GetUserByEmail(email, false)
+	if apiError != nil || user.ID != latest.ID {
+		t.Errorf("expected latest user %v, got %v %v", latest.ID, user, apiError)
+	}
+
+	// several verified users are ambiguous
+	email = "duplicate-" + cigExchange.RandomUUID() + "@example.com"
+	createEmailUser(email, UserStatusVerified, now.Add(-time.Hour))
+	createEmailUser(email, UserStatusVerified, now)
+	user, apiError = GetUserByEmail(email, false)
+	if apiError == nil || apiError.Code != 500 {
+		t.Errorf("expected internal error, got %v %v", user, apiError)
+	}
+}
+
+func TestGetUsersByIDs(t *testing.T) {
+
+	requireDB(t)
+	first := createTestLoginUser(t, "batch-"+cigExchange.RandomUUID()+"@example.com", "41", "791234501")
+	second := createTestUser(t, UserRoleUser)
+	missingID := cigExchange.RandomUUID()
+
+	usersByID, apiError := GetUsersByIDs([]string{first.ID, missingID, second.ID, first.ID})
+	if apiError != nil {
+		t.Fatalf("lookup failed: %v", apiError.ToString())
+	}
+	if len(usersByID) != 2 {
+		t.Fatalf("expected 2 users, got %d", len(usersByID))
+	}
+	if _, ok := usersByID[missingID]; ok {
+		t.Error("missing id is returned")
+	}
+	if user := usersByID[first.ID]; user == nil || user.LoginEmail == nil || user.LoginEmail.ID != *first.LoginEmailUUID {
+		t.Errorf("expected user %v with login email, got %+v", first.ID, user)
+	}
+	if user := usersByID[second.ID]; user == nil || user.LoginEmail != nil {
+		t.Errorf("expected user %v without login email, got %+v", second.ID, user)
+	}
+}
+
+func TestGetUsersByIDsEmpty(t *testing.T) {
+
+	// no ids don't query the db
+	usersByID, apiError := GetUsersByIDs(nil)
+	if apiError != nil || usersByID == nil || len(usersByID) != 0 {
+		t.Errorf("expected empty map, got %v %v", usersByID, apiError)
+	}
+}
+
+func TestTrimFieldsAndValidateNormalizesPhone(t *testing.T) {
+
+	for _, phone := range [][2]string{{"41", "791234567"}, {"+41", "079 123 45 67"}, {"0041", "+41 79 123 45 67"}} {
+		user := &User{
+			Name:       "Phone",
+			LastName:   "Test",
+			LoginEmail: &Contact{Value1: "phone@example.com"},
+			LoginPhone: &Contact{Value1: phone[0], Value2: phone[1]},
+		}
+		if apiError := user.TrimFieldsAndValidate(); apiError != nil {
+			t.Errorf("%v: unexpected error %v", phone, apiError.ToString())
+			continue
+		}
+		if user.LoginPhone.Value1 != "41" || user.LoginPhone.Value2 != "791234567" {
+			t.Errorf("%v: expected canonical phone, got %q %q", phone, user.LoginPhone.Value1, user.LoginPhone.Value2)
+		}
+	}
+}
+
+func TestGetUserByMobileEquivalentForms(t *testing.T) {
+
+	requireDB(t)
+	user := createTestLoginUser(t, "mobile-"+cigExchange.RandomUUID()+"@example.com", "41", "791234502")
+
+	for _, phone := range [][2]string{{"41", "791234502"}, {"+41", "0791234502"}, {"0041", "079 123 45 02"}, {"41", "+41 79 123 45 02"}} {
+		found, apiError := GetUserByMobile(phone[0], phone[1])
+		if apiError != nil {
+			t.Errorf("%v: lookup failed: %v", phone, apiError.ToString())
+			continue
+		}
+		if found.ID != user.ID {
+			t.Errorf("%v: expected user %v, got %v", phone, user.ID, found.ID)
+		}
+	}
+}
+
+func TestCreateUserDuplicatePhone(t *testing.T) {
+
+	requireDB(t)
+	createTestLoginUser(t, "phone-"+cigExchange.RandomUUID()+"@example.com", "41", "791234503")
+
+	// same phone in other form with a new email
+	user := &User{
+		Name:       "Duplicate",
+		LastName:   "Phone",
+		LoginEmail: &Contact{Level: ContactLevelPrimary, Type: ContactTypeEmail, Value1: "phone-" + cigExchange.RandomUUID() + "@example.com"},
+		LoginPhone: &Contact{Level: ContactLevelPrimary, Type: ContactTypePhone, Value1: "+41", Value2: "079 123 45 03"},
+	}
+	created, apiError := CreateUser(user, "")
+	if apiError == nil {
+		cigExchange.GetDB().Unscoped().Delete(created)
+		t.Fatal("user with duplicate phone created")
+	}
+	if apiError.Errors[0].Reason != cigExchange.ReasonUserAlreadyExists || !apiError.ShouldSilenceError() {
+		t.Errorf("expected silenced user already exists error, got %v", apiError.ToString())
+	}
+}
+
+func TestTrimFieldsAndValidateReportsAllErrors(t *testing.T) {
+
+	user := &User{
+		Name:       " ",
+		LoginEmail: &Contact{Value1: "not-an-email"},
+		LoginPhone: &Contact{Value1: "41", Value2: "12"},
+	}
+	apiError := user.TrimFieldsAndValidate()
+	if apiError == nil {
+		t.Fatal("invalid user accepted")
+	}
+
+	expected := map[string]string{
+		"name":         cigExchange.ReasonFieldMissing,
+		"lastname":     cigExchange.ReasonFieldMissing,
+		"email":        cigExchange.ReasonFieldInvalid,
+		"phone_number": cigExchange.ReasonFieldInvalid,
+	}
+	if apiError.Code != 400 || len(apiError.Errors) != len(expected) {
+		t.Fatalf("expected %d nested errors, got %v", len(expected), apiError.ToString())
+	}
+	for _, nestedError := range apiError.Errors {
+		if reason, ok := expected[nestedError.Field]; !ok || nestedError.Reason != reason {
+			t.Errorf("unexpected error %+v", nestedError)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package cigExchange
+
+import (
+	"strings"
+)
+
+// maximum number of digits in E.164 number including the country code
+const maxE164Digits = 15
+
+// country codes keeping the leading zero of the national number in E.164
+var leadingZeroCountryCodes = []string{"39", "378", "379"}
+
+// NormalizePhone returns the canonical country code and national number, the E.164 number parts without "+".
+// Country code accepts "+41", "0041" and "41" forms, spaces, dashes, dots and brackets are removed
+// and the national trunk prefix "0" is dropped, so "+41"/"079 123 45 67" and "41"/"791234567" are equal
+func NormalizePhone(code, number string) (string, string, *APIError) {
+
+	code = stripPhoneSeparators(code)
+	code = strings.TrimPrefix(code, "+")
+	code = strings.TrimPrefix(code, "00")
+	if len(code) == 0 || len(code) > 3 || !isDigits(code) || code[0] == '0' {
+		return "", "", NewInvalidFieldError("phone_country_code", "Invalid phone country code")
+	}
+
+	number = stripPhoneSeparators(number)
+	// number can be provided in the international format
+	if strings.HasPrefix(number, "+"+code) {
+		number = strings.TrimPrefix(number, "+"+code)
+	} else if strings.HasPrefix(number, "00"+code) {
+		number = strings.TrimPrefix(number, "00"+code)
+	}
+	keepLeadingZero := false
+	for _, leadingZeroCode := range leadingZeroCountryCodes {
+		if code == leadingZeroCode {
+			keepLeadingZero = true
+			break
+		}
+	}
+	if !keepLeadingZero {
+		number = strings.TrimLeft(number, "0")
+	}
+	if len(number) < 4 || len(code)+len(number) > maxE164Digits || !isDigits(number) {
+		return "", "", NewInvalidFieldError("phone_number", "Invalid phone number")
+	}
+	return code, number, nil
+}
+
+// FormatE164 returns the E.164 phone number of the normalized country code and national number
+func FormatE164(code, number string) string {
+	return "+" + code + number
+}
+
+// stripPhoneSeparators removes whitespace and the formatting characters
+func stripPhoneSeparators(value string) string {
+
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '-', '.', '(', ')', '/':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(value))
+}
+
+// isDigits returns true if the value consists of ASCII digits only
+func isDigits(value string) bool {
+
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
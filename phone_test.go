@@ -0,0 +1,68 @@
+package cigExchange
+
+import (
+	"testing"
+)
+
+func TestNormalizePhoneEquivalentForms(t *testing.T) {
+
+	tests := []struct {
+		code           string
+		number         string
+		expectedCode   string
+		expectedNumber string
+	}{
+		{"41", "791234567", "41", "791234567"},
+		{"+41", "791234567", "41", "791234567"},
+		{"0041", "791234567", "41", "791234567"},
+		{" +41 ", "079 123 45 67", "41", "791234567"},
+		{"41", "079-123.45.67", "41", "791234567"},
+		{"41", "(0)79 123 45 67", "41", "791234567"},
+		{"41", "+41 79 123 45 67", "41", "791234567"},
+		{"41", "0041791234567", "41", "791234567"},
+		// italian numbers keep the leading zero
+		{"+39", "06 1234 5678", "39", "0612345678"},
+	}
+
+	for _, test := range tests {
+		code, number, apiError := NormalizePhone(test.code, test.number)
+		if apiError != nil {
+			t.Errorf("%q %q: unexpected error %v", test.code, test.number, apiError.ToString())
+			continue
+		}
+		if code != test.expectedCode || number != test.expectedNumber {
+			t.Errorf("%q %q: expected %q %q, got %q %q", test.code, test.number, test.expectedCode, test.expectedNumber, code, number)
+		}
+	}
+
+	code, number, _ := NormalizePhone("+41", "079 123 45 67")
+	if e164 := FormatE164(code, number); e164 != "+41791234567" {
+		t.Errorf("expected +41791234567, got %q", e164)
+	}
+}
+
+func TestNormalizePhoneInvalid(t *testing.T) {
+
+	tests := []struct {
+		code   string
+		number string
+		field  string
+	}{
+		{"", "791234567", "phone_country_code"},
+		{"+", "791234567", "phone_country_code"},
+		{"041", "791234567", "phone_country_code"},
+		{"4111", "791234567", "phone_country_code"},
+		{"4a", "791234567", "phone_country_code"},
+		{"41", "", "phone_number"},
+		{"41", "079", "phone_number"},
+		{"41", "79123abc", "phone_number"},
+		{"41", "7912345678901234", "phone_number"},
+	}
+
+	for _, test := range tests {
+		_, _, apiError := NormalizePhone(test.code, test.number)
+		if apiError == nil || apiError.Errors[0].Field != test.field {
+			t.Errorf("%q %q: expected invalid %s, got %v", test.code, test.number, test.field, apiError)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package cigExchange
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Session is a struct to represent a signed in user session stored in redis.
+// Every device sign in creates a separate session
+type Session struct {
+	ID               string    `json:"id"`
+	UserUUID         string    `json:"user_id"`
+	OrganisationUUID string    `json:"organisation_id"`
+	UserAgent        string    `json:"user_agent"`
+	RemoteAddr       string    `json:"ip"`
+	Remember         bool      `json:"remember"`
+	CreatedAt        time.Time `json:"created_at"`
+	Token            string    `json:"token,omitempty"`
+}
+
+// NewSession creates new session for the user, info is optional and provides device metadata
+func NewSession(userUUID, organisationUUID string, info *ActivityInformation) *Session {
+
+	session := &Session{
+		ID:               RandomUUID(),
+		UserUUID:         userUUID,
+		OrganisationUUID: organisationUUID,
+		CreatedAt:        time.Now().UTC(),
+	}
+	if info != nil {
+		session.UserAgent = info.UserAgent
+		session.RemoteAddr = info.RemoteAddr
+	}
+	return session
+}
+
+// SessionRedisKey returns redis key of the session.
+// Key starts with the user UUID so InvalidateUserTokens revokes sessions too
+func SessionRedisKey(userUUID, sessionID string) string {
+	return userUUID + "|session|" + sessionID
+}
+
+// SessionRefreshRedisKey returns redis key of the session refresh token
+func SessionRefreshRedisKey(userUUID, sessionID string) string {
+	return userUUID + "|refresh|" + sessionID
+}
+
+// Save stores the session in redis with the expiration
+func (session *Session) Save(expiration time.Duration) *APIError {
+
+	// check that UUIDs are set
+	if len(session.UserUUID) == 0 {
+		return NewInvalidFieldError("user_id", "User id is invalid")
+	}
+	if len(session.ID) == 0 {
+		return NewInvalidFieldError("session_id", "Session id is invalid")
+	}
+
+	sessionBytes, err := json.Marshal(session)
+	if err != nil {
+		return NewJSONEncodingError(MessageJSONEncoding, err)
+	}
+
+	err = GetStore().Set(SessionRedisKey(session.UserUUID, session.ID), sessionBytes, expiration)
+	if err != nil {
+		return NewRedisError("Set session failure", err)
+	}
+	return nil
+}
+
+// GetSession queries a single session from redis
+func GetSession(userUUID, sessionID string) (*Session, *APIError) {
+
+	// check that UUIDs are set
+	if len(userUUID) == 0 {
+		return nil, NewInvalidFieldError("user_id", "User id is invalid")
+	}
+	if len(sessionID) == 0 {
+		return nil, NewInvalidFieldError("session_id", "Session id is invalid")
+	}
+
+	value, err := GetStore().Get(SessionRedisKey(userUUID, sessionID))
+	if err != nil {
+		if err == ErrKeyNotFound {
+			return nil, NewNotFoundError("session_id", "Session with provided id doesn't exist")
+		}
+		return nil, NewRedisError("Get session failure", err)
+	}
+
+	session := &Session{}
+	err = json.Unmarshal([]byte(value), session)
+	if err != nil {
+		return nil, NewJSONDecodingError(MessageJSONDecoding, err)
+	}
+	return session, nil
+}
+
+// ListSessions queries all user sessions from redis ordered by creation time.
+// Session tokens are not returned
+func ListSessions(userUUID string) ([]*Session, *APIError) {
+
+	sessions := make([]*Session, 0)
+
+	// check that UUID is set
+	if len(userUUID) == 0 {
+		return sessions, NewInvalidFieldError("user_id", "User id is invalid")
+	}
+
+	prefix := SessionRedisKey(userUUID, "")
+	keys, err := GetStore().Scan(prefix + "*")
+	if err != nil {
+		return sessions, NewRedisError("Scan sessions failure", err)
+	}
+
+	for _, key := range keys {
+		// session can expire during the scan
+		session, apiError := GetSession(userUUID, strings.TrimPrefix(key, prefix))
+		if apiError != nil {
+			if apiError.Type == ErrorTypeNotFound {
+				continue
+			}
+			return sessions, apiError
+		}
+		session.Token = ""
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// RevokeSession removes the user session and its refresh token from redis
+func RevokeSession(userUUID, sessionID string) *APIError {
+
+	// check that UUIDs are set
+	if len(userUUID) == 0 {
+		return NewInvalidFieldError("user_id", "User id is invalid")
+	}
+	if len(sessionID) == 0 {
+		return NewInvalidFieldError("session_id", "Session id is invalid")
+	}
+
+	removed, err := GetStore().Del(SessionRedisKey(userUUID, sessionID), SessionRefreshRedisKey(userUUID, sessionID))
+	if err != nil {
+		return NewRedisError("Del session failure", err)
+	}
+	if removed == 0 {
+		return NewNotFoundError("session_id", "Session with provided id doesn't exist")
+	}
+	return nil
+}
+
+// LimitSessions revokes the oldest user sessions so a new session fits into
+// the MAX_SESSIONS_PER_USER limit. Should be called before a new session is saved
+func LimitSessions(userUUID string) *APIError {
+
+	maxSessions := GetMaxSessionsPerUser()
+	if maxSessions <= 0 {
+		return nil
+	}
+
+	sessions, apiError := ListSessions(userUUID)
+	if apiError != nil {
+		return apiError
+	}
+
+	// sessions are ordered from the oldest
+	for i := 0; len(sessions)-i >= maxSessions; i++ {
+		apiError = RevokeSession(userUUID, sessions[i].ID)
+		if apiError != nil && apiError.Type != ErrorTypeNotFound {
+			return apiError
+		}
+	}
+	return nil
+}
+
+// RevokeOrganisationSessions removes all user sessions signed in to the organisation
+func RevokeOrganisationSessions(userUUID, organisationUUID string) *APIError {
+
+	sessions, apiError := ListSessions(userUUID)
+	if apiError != nil {
+		return apiError
+	}
+
+	for _, session := range sessions {
+		if session.OrganisationUUID != organisationUUID {
+			continue
+		}
+		apiError = RevokeSession(userUUID, session.ID)
+		if apiError != nil && apiError.Type != ErrorTypeNotFound {
+			return apiError
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package cigExchange
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLimitSessionsEvictsOldest(t *testing.T) {
+
+	SetStore(NewMemoryStore())
+	defer SetStore(nil)
+
+	defaultMaxSessions := maxSessionsPerUser
+	maxSessionsPerUser = 3
+	defer func() { maxSessionsPerUser = defaultMaxSessions }()
+
+	// create one session above the limit
+	created := make([]*Session, 0)
+	for i := 0; i <= maxSessionsPerUser; i++ {
+		if apiError := LimitSessions("user"); apiError != nil {
+			t.Fatalf("limit failed: %v", apiError.ToString())
+		}
+		session := NewSession("user", "organisation", nil)
+		session.ID = "session-" + strconv.Itoa(i)
+		session.CreatedAt = session.CreatedAt.Add(time.Duration(i) * time.Second)
+		if apiError := session.Save(time.Hour); apiError != nil {
+			t.Fatalf("save failed: %v", apiError.ToString())
+		}
+		GetStore().Set(SessionRefreshRedisKey("user", session.ID), "refresh", time.Hour)
+		created = append(created, session)
+	}
+
+	sessions, apiError := ListSessions("user")
+	if apiError != nil {
+		t.Fatalf("list failed: %v", apiError.ToString())
+	}
+	if len(sessions) != maxSessionsPerUser {
+		t.Fatalf("expected %d sessions, got %d", maxSessionsPerUser, len(sessions))
+	}
+	for i, session := range sessions {
+		if session.ID != created[i+1].ID {
+			t.Errorf("session %d: expected %v, got %v", i, created[i+1].ID, session.ID)
+		}
+	}
+
+	// the oldest session and its refresh token are revoked
+	oldest := created[0]
+	if _, apiError := GetSession("user", oldest.ID); apiError == nil || apiError.Type != ErrorTypeNotFound {
+		t.Errorf("oldest session is not evicted: %v", apiError)
+	}
+	if _, err := GetStore().Get(SessionRefreshRedisKey("user", oldest.ID)); err != ErrKeyNotFound {
+		t.Errorf("oldest refresh token is not evicted: %v", err)
+	}
+}
+
+func TestLimitSessionsUnlimited(t *testing.T) {
+
+	SetStore(NewMemoryStore())
+	defer SetStore(nil)
+
+	defaultMaxSessions := maxSessionsPerUser
+	maxSessionsPerUser = 0
+	defer func() { maxSessionsPerUser = defaultMaxSessions }()
+
+	for i := 0; i < 5; i++ {
+		if apiError := LimitSessions("user"); apiError != nil {
+			t.Fatalf("limit failed: %v", apiError.ToString())
+		}
+		session := NewSession("user", "organisation", nil)
+		session.ID = "session-" + strconv.Itoa(i)
+		session.Save(time.Hour)
+	}
+
+	sessions, _ := ListSessions("user")
+	if len(sessions) != 5 {
+		t.Errorf("expected 5 sessions, got %d", len(sessions))
+	}
+}
@@ -0,0 +1,55 @@
+package cigExchange
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// background tasks that must finish before the shutdown
+var asyncTasks sync.WaitGroup
+
+// RunAsync runs fn in goroutine, Shutdown waits for the started tasks to finish
+func RunAsync(fn func()) {
+
+	asyncTasks.Add(1)
+	go func() {
+		defer asyncTasks.Done()
+		fn()
+	}()
+}
+
+// Shutdown waits for the async tasks (email and OTP sends) and closes the database, read replica and redis connections.
+// Services should call it from the signal handler, ctx limits the wait for the async tasks
+func Shutdown(ctx context.Context) error {
+
+	errs := make([]error, 0)
+
+	done := make(chan struct{})
+	go func() {
+		asyncTasks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, errors.New("async tasks didn't finish before shutdown: "+ctx.Err().Error()))
+	}
+
+	if db != nil {
+		if err := db.Close(); err != nil {
+			errs = append(errs, errors.New("database close failed: "+err.Error()))
+		}
+	}
+	if readDB != nil {
+		if err := readDB.Close(); err != nil {
+			errs = append(errs, errors.New("read replica close failed: "+err.Error()))
+		}
+	}
+	if redisD != nil {
+		if err := redisD.Close(); err != nil {
+			errs = append(errs, errors.New("redis close failed: "+err.Error()))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,336 @@
+package cigExchange
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ErrKeyNotFound is returned by Store.Get for missing or expired keys
+var ErrKeyNotFound = errors.New("store: key not found")
+
+// Store is a key value storage of codes, tokens and sessions.
+// Redis is the default store, MemoryStore is used in tests
+type Store interface {
+	// Get returns the key value or ErrKeyNotFound
+	Get(key string) (string, error)
+	// Set stores the value for ttl, zero ttl means no expiration
+	Set(key string, value interface{}, ttl time.Duration) error
+	// SetNX stores the value for ttl only if the key is missing, returns true if the value was stored
+	SetNX(key string, value interface{}, ttl time.Duration) (bool, error)
+	// Del removes the keys and returns the number of removed keys
+	Del(keys ...string) (int64, error)
+	// Incr increments the integer key value and returns the new value, missing key starts from 0
+	Incr(key string) (int64, error)
+	// IncrWithExpire increments like Incr and sets the ttl of the key created by the increment in the same operation
+	IncrWithExpire(key string, ttl time.Duration) (int64, error)
+	// SetIfGreater stores the integer value for ttl only if the key is missing or holds a lower value,
+	// returns true if the value was stored
+	SetIfGreater(key string, value int64, ttl time.Duration) (bool, error)
+	// Expire sets the key ttl
+	Expire(key string, ttl time.Duration) error
+	// Scan returns all keys matching the glob pattern
+	Scan(match string) ([]string, error)
+}
+
+var store Store = &redisStore{}
+
+// GetStore returns the key value store singletone
+func GetStore() Store {
+	return store
+}
+
+// SetStore replaces the key value store, nil restores the redis store
+func SetStore(s Store) {
+
+	if s == nil {
+		s = &redisStore{}
+	}
+	store = s
+}
+
+// redisStore is the Store using the redis client singletone
+type redisStore struct{}
+
+func (*redisStore) Get(key string) (string, error) {
+
+	value, err := GetRedis().Get(key).Result()
+	if err == redis.Nil {
+		return "", ErrKeyNotFound
+	}
+	return value, err
+}
+
+func (*redisStore) Set(key string, value interface{}, ttl time.Duration) error {
+	return GetRedis().Set(key, value, ttl).Err()
+}
+
+func (*redisStore) SetNX(key string, value interface{}, ttl time.Duration) (bool, error) {
+	return GetRedis().SetNX(key, value, ttl).Result()
+}
+
+// Del removes keys one by one, cluster can't delete keys from different slots at once
+func (*redisStore) Del(keys ...string) (int64, error) {
+
+	removed := int64(0)
+	for _, key := range keys {
+		count, err := GetRedis().Del(key).Result()
+		if err != nil {
+			return removed, err
+		}
+		removed += count
+	}
+	return removed, nil
+}
+
+func (*redisStore) Incr(key string) (int64, error) {
+	return GetRedis().Incr(key).Result()
+}
+
+// incrWithExpireScript sets the expiration of the new counter atomically with the increment,
+// so a failure between the two calls can't leave the counter without ttl
+var incrWithExpireScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+func (*redisStore) IncrWithExpire(key string, ttl time.Duration) (int64, error) {
+	return incrWithExpireScript.Run(GetRedis(), []string{key}, ttl.Milliseconds()).Int64()
+}
+
+// setIfGreaterScript compares and sets the value in one operation, so concurrent callers can't lower it
+var setIfGreaterScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if current and tonumber(current) >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return 1
+`)
+
+func (*redisStore) SetIfGreater(key string, value int64, ttl time.Duration) (bool, error) {
+
+	stored, err := setIfGreaterScript.Run(GetRedis(), []string{key}, value, ttl.Milliseconds()).Int64()
+	return stored == 1, err
+}
+
+func (*redisStore) Expire(key string, ttl time.Duration) error {
+	return GetRedis().Expire(key, ttl).Err()
+}
+
+func (*redisStore) Scan(match string) ([]string, error) {
+	return ScanRedisKeys(match)
+}
+
+// memoryItem is a MemoryStore value with the expiration time
+type memoryItem struct {
+	value     string
+	expiresAt time.Time
+}
+
+// newMemoryItem converts the value to string like redis does, zero ttl means no expiration
+func newMemoryItem(value interface{}, ttl time.Duration) *memoryItem {
+
+	item := &memoryItem{}
+	switch v := value.(type) {
+	case string:
+		item.value = v
+	case []byte:
+		item.value = string(v)
+	default:
+		item.value = fmt.Sprint(v)
+	}
+	if ttl > 0 {
+		item.expiresAt = time.Now().Add(ttl)
+	}
+	return item
+}
+
+func (item *memoryItem) expired(now time.Time) bool {
+	return !item.expiresAt.IsZero() && !now.Before(item.expiresAt)
+}
+
+// MemoryStore is the in-memory Store for tests
+type MemoryStore struct {
+	mutex sync.Mutex
+	items map[string]*memoryItem
+}
+
+// NewMemoryStore creates empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: make(map[string]*memoryItem)}
+}
+
+// item returns the not expired key item, expired items are removed. Mutex must be locked
+func (memoryStore *MemoryStore) item(key string) (*memoryItem, bool) {
+
+	item, ok := memoryStore.items[key]
+	if !ok {
+		return nil, false
+	}
+	if item.expired(time.Now()) {
+		delete(memoryStore.items, key)
+		return nil, false
+	}
+	return item, true
+}
+
+// Get returns the key value or ErrKeyNotFound
+func (memoryStore *MemoryStore) Get(key string) (string, error) {
+
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	item, ok := memoryStore.item(key)
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	return item.value, nil
+}
+
+// Set stores the value for ttl, zero ttl means no expiration
+func (memoryStore *MemoryStore) Set(key string, value interface{}, ttl time.Duration) error {
+
+	item := newMemoryItem(value, ttl)
+
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	memoryStore.items[key] = item
+	return nil
+}
+
+// SetNX stores the value for ttl only if the key is missing, returns true if the value was stored
+func (memoryStore *MemoryStore) SetNX(key string, value interface{}, ttl time.Duration) (bool, error) {
+
+	item := newMemoryItem(value, ttl)
+
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	if _, ok := memoryStore.item(key); ok {
+		return false, nil
+	}
+	memoryStore.items[key] = item
+	return true, nil
+}
+
+// Del removes the keys and returns the number of removed keys
+func (memoryStore *MemoryStore) Del(keys ...string) (int64, error) {
+
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	removed := int64(0)
+	for _, key := range keys {
+		if _, ok := memoryStore.item(key); ok {
+			delete(memoryStore.items, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Incr increments the integer key value and returns the new value, missing key starts from 0
+func (memoryStore *MemoryStore) Incr(key string) (int64, error) {
+
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	item, ok := memoryStore.item(key)
+	if !ok {
+		item = &memoryItem{value: "0"}
+		memoryStore.items[key] = item
+	}
+
+	value, err := strconv.ParseInt(item.value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("store: value of %v is not an integer", key)
+	}
+	value++
+	item.value = strconv.FormatInt(value, 10)
+	return value, nil
+}
+
+// IncrWithExpire increments like Incr and sets the ttl of the key created by the increment
+func (memoryStore *MemoryStore) IncrWithExpire(key string, ttl time.Duration) (int64, error) {
+
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	item, ok := memoryStore.item(key)
+	if !ok {
+		item = newMemoryItem("0", ttl)
+		memoryStore.items[key] = item
+	}
+
+	value, err := strconv.ParseInt(item.value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("store: value of %v is not an integer", key)
+	}
+	value++
+	item.value = strconv.FormatInt(value, 10)
+	return value, nil
+}
+
+// SetIfGreater stores the integer value for ttl only if the key is missing or holds a lower value,
+// returns true if the value was stored
+func (memoryStore *MemoryStore) SetIfGreater(key string, value int64, ttl time.Duration) (bool, error) {
+
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	if item, ok := memoryStore.item(key); ok {
+		current, err := strconv.ParseInt(item.value, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("store: value of %v is not an integer", key)
+		}
+		if current >= value {
+			return false, nil
+		}
+	}
+	memoryStore.items[key] = newMemoryItem(value, ttl)
+	return true, nil
+}
+
+// Expire sets the key ttl
+func (memoryStore *MemoryStore) Expire(key string, ttl time.Duration) error {
+
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	if item, ok := memoryStore.item(key); ok {
+		item.expiresAt = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+// Scan returns all keys matching the glob pattern
+func (memoryStore *MemoryStore) Scan(match string) ([]string, error) {
+
+	memoryStore.mutex.Lock()
+	defer memoryStore.mutex.Unlock()
+
+	keys := make([]string, 0)
+	for key := range memoryStore.items {
+		if _, ok := memoryStore.item(key); !ok {
+			continue
+		}
+		matched, err := path.Match(match, key)
+		if err != nil {
+			return keys, err
+		}
+		if matched {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,162 @@
+package cigExchange
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreGetSet(t *testing.T) {
+
+	memoryStore := NewMemoryStore()
+
+	if _, err := memoryStore.Get("missing"); err != ErrKeyNotFound {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	// values are stored as strings like in redis
+	memoryStore.Set("int", 42, 0)
+	memoryStore.Set("bytes", []byte("value"), 0)
+	for key, expected := range map[string]string{"int": "42", "bytes": "value"} {
+		if value, err := memoryStore.Get(key); err != nil || value != expected {
+			t.Errorf("%s: expected %q, got %q %v", key, expected, value, err)
+		}
+	}
+
+	memoryStore.Set("short", "value", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := memoryStore.Get("short"); err != ErrKeyNotFound {
+		t.Errorf("expired key returned, error %v", err)
+	}
+}
+
+func TestMemoryStoreSetNX(t *testing.T) {
+
+	memoryStore := NewMemoryStore()
+
+	stored, _ := memoryStore.SetNX("key", "first", 10*time.Millisecond)
+	if !stored {
+		t.Fatal("missing key not stored")
+	}
+	stored, _ = memoryStore.SetNX("key", "second", 0)
+	if stored {
+		t.Fatal("existing key overwritten")
+	}
+	if value, _ := memoryStore.Get("key"); value != "first" {
+		t.Errorf("expected first, got %q", value)
+	}
+
+	// expired key is missing
+	time.Sleep(20 * time.Millisecond)
+	stored, _ = memoryStore.SetNX("key", "third", 0)
+	if !stored {
+		t.Error("expired key not replaced")
+	}
+}
+
+func TestMemoryStoreDel(t *testing.T) {
+
+	memoryStore := NewMemoryStore()
+	memoryStore.Set("a", "1", 0)
+	memoryStore.Set("b", "1", 0)
+
+	removed, err := memoryStore.Del("a", "b", "missing")
+	if err != nil || removed != 2 {
+		t.Fatalf("expected 2 removed, got %d %v", removed, err)
+	}
+	removed, _ = memoryStore.Del("a")
+	if removed != 0 {
+		t.Errorf("removed key removed again")
+	}
+}
+
+func TestMemoryStoreIncrExpire(t *testing.T) {
+
+	memoryStore := NewMemoryStore()
+
+	for expected := int64(1); expected <= 3; expected++ {
+		if count, err := memoryStore.Incr("counter"); err != nil || count != expected {
+			t.Fatalf("expected %d, got %d %v", expected, count, err)
+		}
+	}
+
+	memoryStore.Set("text", "abc", 0)
+	if _, err := memoryStore.Incr("text"); err == nil {
+		t.Error("not integer value incremented")
+	}
+
+	memoryStore.Expire("counter", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if count, _ := memoryStore.Incr("counter"); count != 1 {
+		t.Errorf("expired counter not restarted, got %d", count)
+	}
+}
+
+func TestMemoryStoreIncrWithExpire(t *testing.T) {
+
+	memoryStore := NewMemoryStore()
+
+	count, err := memoryStore.IncrWithExpire("key", time.Minute)
+	if err != nil || count != 1 {
+		t.Fatalf("expected 1, got %d %v", count, err)
+	}
+	expiresAt := memoryStore.items["key"].expiresAt
+	if expiresAt.IsZero() {
+		t.Fatal("new counter has no expiration")
+	}
+
+	// later increments keep the window
+	count, err = memoryStore.IncrWithExpire("key", time.Hour)
+	if err != nil || count != 2 {
+		t.Fatalf("expected 2, got %d %v", count, err)
+	}
+	if !memoryStore.items["key"].expiresAt.Equal(expiresAt) {
+		t.Error("increment moved the expiration")
+	}
+}
+
+func TestMemoryStoreScan(t *testing.T) {
+
+	memoryStore := NewMemoryStore()
+	memoryStore.Set("user1|token1", "1", 0)
+	memoryStore.Set("user1|token2", "1", 0)
+	memoryStore.Set("user2|token1", "1", 0)
+	memoryStore.Set("user1|expired", "1", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	keys, err := memoryStore.Scan("user1|*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "user1|token1" || keys[1] != "user1|token2" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
+
+func TestMemoryStoreSetIfGreater(t *testing.T) {
+
+	memoryStore := NewMemoryStore()
+
+	for _, test := range []struct {
+		value    int64
+		expected bool
+	}{
+		{100, true},
+		{100, false},
+		{99, false},
+		{101, true},
+	} {
+		if stored, err := memoryStore.SetIfGreater("step", test.value, time.Minute); err != nil || stored != test.expected {
+			t.Errorf("%d: expected %v, got %v %v", test.value, test.expected, stored, err)
+		}
+	}
+	if value, _ := memoryStore.Get("step"); value != "101" {
+		t.Errorf("expected 101, got %q", value)
+	}
+
+	memoryStore.Set("text", "abc", 0)
+	if _, err := memoryStore.SetIfGreater("text", 1, 0); err == nil {
+		t.Error("not integer value compared")
+	}
+}
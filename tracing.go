@@ -0,0 +1,101 @@
+package cigExchange
+
+import (
+	"net/http"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer instrumentation name
+const tracerName = "cig-exchange-libs"
+
+// Tracer returns the OpenTelemetry tracer of the library.
+// Tracing is a no-op until the service registers a tracer provider with an exporter
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// EndSpan marks the span as failed if err is set and ends it
+func EndSpan(span trace.Span, err error) {
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TracingHandler starts the server span of the request continuing the trace propagated in the request headers
+func TracingHandler(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Tracer().Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.target", r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// scope key of the query span
+const tracingSpanKey = "cig:tracing_span"
+
+// registerDBTracingCallbacks registers gorm callbacks creating a span for every query
+func registerDBTracingCallbacks(db *gorm.DB) {
+
+	before := func(operation string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			_, span := Tracer().Start(scopeContext(scope), "db."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("db.system", "postgresql"),
+					attribute.String("db.operation", operation),
+				),
+			)
+			scope.InstanceSet(tracingSpanKey, span)
+		}
+	}
+	after := func(scope *gorm.Scope) {
+		value, ok := scope.InstanceGet(tracingSpanKey)
+		if !ok {
+			return
+		}
+		span, ok := value.(trace.Span)
+		if !ok {
+			return
+		}
+		span.SetAttributes(
+			attribute.String("db.sql.table", scope.TableName()),
+			attribute.String("db.statement", scope.SQL),
+		)
+		err := scope.DB().Error
+		if err == gorm.ErrRecordNotFound {
+			err = nil
+		}
+		EndSpan(span, err)
+	}
+
+	callback := db.Callback()
+	callback.Create().Before("gorm:create").Register("cig:tracing_before_create", before("create"))
+	callback.Create().After("gorm:create").Register("cig:tracing_after_create", after)
+	callback.Query().Before("gorm:query").Register("cig:tracing_before_query", before("query"))
+	callback.Query().After("gorm:query").Register("cig:tracing_after_query", after)
+	callback.Update().Before("gorm:update").Register("cig:tracing_before_update", before("update"))
+	callback.Update().After("gorm:update").Register("cig:tracing_after_update", after)
+	callback.Delete().Before("gorm:delete").Register("cig:tracing_before_delete", before("delete"))
+	callback.Delete().After("gorm:delete").Register("cig:tracing_after_delete", after)
+	callback.RowQuery().Before("gorm:row_query").Register("cig:tracing_before_row_query", before("row_query"))
+	callback.RowQuery().After("gorm:row_query").Register("cig:tracing_after_row_query", after)
+}
@@ -1,12 +1,18 @@
 package twilio
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Twilio api urls
@@ -22,6 +28,9 @@ type OTP struct {
 
 const missingAPIKeyError = "Need to set Twilio api key"
 
+// tracer instrumentation name
+const tracerName = "cig-exchange-libs/twilio"
+
 // twilioResponse struct for parsing twilio response
 type twilioResponse struct {
 	Message string `json:"message"`
@@ -35,6 +44,16 @@ func NewOTP(apiKey string) *OTP {
 
 // ReceiveOTP sends request to receive OTP for phone number
 func (twilioOTP *OTP) ReceiveOTP(countryCode, phoneNumber string) (message string, err error) {
+	return twilioOTP.ReceiveOTPCtx(context.Background(), countryCode, phoneNumber)
+}
+
+// ReceiveOTPCtx sends request to receive OTP for phone number, the request is traced as a child span of ctx
+func (twilioOTP *OTP) ReceiveOTPCtx(ctx context.Context, countryCode, phoneNumber string) (message string, err error) {
+
+	ctx, span := startSpan(ctx, "twilio.receive_otp")
+	defer func() {
+		endSpan(span, err)
+	}()
 
 	// check api key
 	if len(twilioOTP.APIKey) == 0 {
@@ -48,7 +67,13 @@ func (twilioOTP *OTP) ReceiveOTP(countryCode, phoneNumber string) (message strin
 		"phone_number": {phoneNumber},
 		"country_code": {countryCode},
 	}
-	resp, err := http.PostForm(verificationStartURL, vals)
+	req, err := http.NewRequestWithContext(ctx, "POST", verificationStartURL, strings.NewReader(vals.Encode()))
+	if err != nil {
+		return "Can't create new request", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "Can't execute request", err
 	}
@@ -60,6 +85,16 @@ func (twilioOTP *OTP) ReceiveOTP(countryCode, phoneNumber string) (message strin
 
 // VerifyOTP verifies OTP for phone number
 func (twilioOTP *OTP) VerifyOTP(otp, countryCode, phoneNumber string) (message string, err error) {
+	return twilioOTP.VerifyOTPCtx(context.Background(), otp, countryCode, phoneNumber)
+}
+
+// VerifyOTPCtx verifies OTP for phone number, the request is traced as a child span of ctx
+func (twilioOTP *OTP) VerifyOTPCtx(ctx context.Context, otp, countryCode, phoneNumber string) (message string, err error) {
+
+	ctx, span := startSpan(ctx, "twilio.verify_otp")
+	defer func() {
+		endSpan(span, err)
+	}()
 
 	// check api key
 	if len(twilioOTP.APIKey) == 0 {
@@ -68,7 +103,7 @@ func (twilioOTP *OTP) VerifyOTP(otp, countryCode, phoneNumber string) (message s
 
 	client := &http.Client{}
 
-	req, err := http.NewRequest("GET", verificationCheckURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", verificationCheckURL, nil)
 	if err != nil {
 		return "Can't create new request", err
 	}
@@ -91,6 +126,22 @@ func (twilioOTP *OTP) VerifyOTP(otp, countryCode, phoneNumber string) (message s
 	return twilioOTP.parseTwilioResponse(resp.Body)
 }
 
+// startSpan starts client span of the Twilio call.
+// Tracing is a no-op until the service registers a tracer provider with an exporter
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+}
+
+// endSpan marks the span as failed if err is set and ends it
+func endSpan(span trace.Span, err error) {
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
 func (twilioOTP *OTP) parseTwilioResponse(rBody io.ReadCloser) (message string, err error) {
 
 	// read response
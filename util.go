@@ -1,9 +1,13 @@
 package cigExchange
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
-	"math/rand"
+	"math/big"
+	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -11,25 +15,60 @@ import (
 
 	"github.com/mattbaird/gochimp"
 	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-const letterBytes = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+// alphabets for random codes generation
+const (
+	letterBytes = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	digitBytes  = "0123456789"
+)
 
 // RandCode generates random access code for email auth
+// using cryptographically secure random source
 func RandCode(n int) string {
+	return RandCodeFromAlphabet(n, letterBytes)
+}
+
+// RandNumericCode generates random digits only code (easy keypad entry for SMS OTP)
+func RandNumericCode(n int) string {
+	return RandCodeFromAlphabet(n, digitBytes)
+}
+
+// RandCodeFromAlphabet generates random code of length n using characters from alphabet
+func RandCodeFromAlphabet(n int, alphabet string) string {
+	if len(alphabet) == 0 {
+		return ""
+	}
 	b := make([]byte, n)
+	max := big.NewInt(int64(len(alphabet)))
 	for i := range b {
-		b[i] = letterBytes[rand.Intn(len(letterBytes))]
+		index, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			// secure random source is unavailable, codes can't be generated safely
+			panic(fmt.Sprintf("RandCodeFromAlphabet: crypto/rand failure: %v", err.Error()))
+		}
+		b[i] = alphabet[index.Int64()]
 	}
 	return string(b)
 }
 
+// CompareCodes compares the stored and submitted codes in constant time.
+// Codes of different length never match
+func CompareCodes(storedCode, code string) bool {
+	if len(storedCode) == 0 || len(storedCode) != len(code) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(storedCode), []byte(code)) == 1
+}
+
 // RandomUUID generates new random V4 UUID string
 func RandomUUID() string {
 	UUID, err := uuid.NewV4()
 	if err != nil {
 		// uuid for an unlikely event of NewV4 failure
-		fmt.Printf("[WARNING] Error creating V4 UUID, generating it manually: %v", err.Error())
+		logger.Warn("V4 UUID creation failed, generating it manually", "error", err)
 		res := RandCode(8) + "-" + RandCode(4) + "-" + RandCode(4) + "-" + RandCode(4) + "-" + RandCode(12)
 		return strings.ToLower(res)
 	}
@@ -39,15 +78,52 @@ func RandomUUID() string {
 // keys for storing strings in redis
 const (
 	KeySignUp           = "_signup_key"
+	KeySignUpPhone      = "_signup_phone_key"
+	KeyOTPAttempts      = "_otp_attempts"
 	KeyWebAuthnRegister = "_web_authn_register"
 	KeyWebAuthnLogin    = "_web_authn_login"
+	KeyWebAuthnEnroll   = "_web_authn_enroll"
+	KeyIPRateLimit      = "_ip_rate_limit"
+	KeyTOTPUsed         = "_totp_used"
+	KeyOrganisationInfo = "_organisation_info"
+
+	KeyIdempotencySignUp             = "_idempotency_signup"
+	KeyIdempotencyOrganisationSignUp = "_idempotency_org_signup"
 )
 
+// DevPhoneOTPCode is the fixed phone OTP code used instead of Twilio SMS
+// when IsOTPInResponseAllowed() is true (ENV=dev and ALLOW_OTP_IN_RESPONSE=true).
+// Automated tests of the phone flow can always verify with "123456"
+const DevPhoneOTPCode = "123456"
+
 // GenerateRedisKey generates key for storing strings in redis
 func GenerateRedisKey(UUID, suffix string) string {
 	return fmt.Sprintf("%s%s", UUID, suffix)
 }
 
+// InvalidateUserTokens removes all jwt tokens and sessions issued for the user from redis.
+// Tokens and sessions are stored with "userUUID|..." keys
+func InvalidateUserTokens(userUUID string) *APIError {
+
+	// check that UUID is set
+	if len(userUUID) == 0 {
+		return NewInvalidFieldError("user_id", "User id is invalid")
+	}
+
+	keys, err := GetStore().Scan(userUUID + "|*")
+	if err != nil {
+		return NewRedisError("Scan tokens failure", err)
+	}
+
+	if len(keys) > 0 {
+		_, err = GetStore().Del(keys...)
+		if err != nil {
+			return NewRedisError("Del token failure", err)
+		}
+	}
+	return nil
+}
+
 // BEGIN SECTION: this api will be deprecated soon
 
 // apiError is a struct representing server error response
@@ -92,7 +168,7 @@ func RespondWithAPIError(w http.ResponseWriter, apiErr *APIError) {
 // PrintAPIError prints apiError
 func PrintAPIError(info *ActivityInformation) {
 	if info.APIError != nil {
-		fmt.Println(info.APIError.ToString())
+		LogAPIError("API error", info.APIError)
 	}
 }
 
@@ -100,15 +176,83 @@ func PrintAPIError(info *ActivityInformation) {
 type LoggedInUser struct {
 	UserUUID         string    `json:"user_id"`
 	OrganisationUUID string    `json:"organisation_id"`
+	SessionID        string    `json:"session_id,omitempty"`
 	CreationDate     time.Time `json:"creation_date"`
 	ExpirationDate   time.Time `json:"expiration_date"`
 }
 
+// actorContextKey is the context key of the acting user UUID
+type actorContextKey struct{}
+
+// ContextWithActor returns the context carrying the UUID of the user making the changes
+func ContextWithActor(ctx context.Context, userUUID string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, userUUID)
+}
+
+// ActorFromContext returns the UUID of the user making the changes, empty for system changes
+func ActorFromContext(ctx context.Context) string {
+
+	if ctx == nil {
+		return ""
+	}
+	userUUID, _ := ctx.Value(actorContextKey{}).(string)
+	return userUUID
+}
+
 // ActivityInformation stores activity information for logging
 type ActivityInformation struct {
 	APIError     *APIError
 	LoggedInUser *LoggedInUser
 	RemoteAddr   string
+	UserAgent    string
+}
+
+// ClientIP returns the client IP address of the request.
+// Forwarding headers are used only for requests from the TRUSTED_PROXIES,
+// X-Real-IP is examined first, then the rightmost untrusted X-Forwarded-For address
+func ClientIP(r *http.Request) string {
+
+	remoteIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteIP = host
+	}
+	if !isTrustedProxy(remoteIP) {
+		return remoteIP
+	}
+
+	realIP := strings.TrimSpace(r.Header.Get("X-Real-IP"))
+	if net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	// addresses are appended by every proxy, the first untrusted from the right is the client
+	forwardedForParts := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwardedForParts) - 1; i >= 0; i-- {
+		forwardedIP := strings.TrimSpace(forwardedForParts[i])
+		if net.ParseIP(forwardedIP) == nil {
+			break
+		}
+		remoteIP = forwardedIP
+		if !isTrustedProxy(forwardedIP) {
+			break
+		}
+	}
+	return remoteIP
+}
+
+// isTrustedProxy returns true if the ip belongs to the TRUSTED_PROXIES
+func isTrustedProxy(ip string) bool {
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return false
+	}
+	for _, proxy := range trustedProxies {
+		if proxy.Contains(parsedIP) {
+			return true
+		}
+	}
+	return false
 }
 
 // PrepareActivityInformation creates ActivityInformation with prefilled remote address
@@ -123,6 +267,7 @@ func PrepareActivityInformation(r *http.Request) *ActivityInformation {
 	}
 
 	info.RemoteAddr = remoteIP
+	info.UserAgent = r.UserAgent()
 	return info
 }
 
@@ -138,18 +283,27 @@ const (
 // SendWelcomeEmailAsync sends welcome email in goroutine
 func SendWelcomeEmailAsync(email string) {
 	// send welcome email async
-	go func() {
+	RunAsync(func() {
 		parameters := map[string]string{}
 		err := SendEmail(EmailTypeWelcome, email, parameters)
 		if err != nil {
-			fmt.Println("CreateUser: email sending error:")
-			fmt.Println(err.Error())
+			logger.Error("welcome email sending failed", "error", err)
 		}
-	}()
+	})
 }
 
 // SendEmail sends template emails
 func SendEmail(eType emailType, email string, parameters map[string]string) error {
+	return SendEmailCtx(context.Background(), eType, email, parameters)
+}
+
+// SendEmailCtx sends template emails, the Mandrill calls are traced as a child span of ctx
+func SendEmailCtx(ctx context.Context, eType emailType, email string, parameters map[string]string) (err error) {
+
+	_, span := Tracer().Start(ctx, "mandrill.send", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() {
+		EndSpan(span, err)
+	}()
 
 	mandrillClient := GetMandrill()
 
@@ -170,6 +324,7 @@ func SendEmail(eType emailType, email string, parameters map[string]string) erro
 	default:
 		return fmt.Errorf("Unsupported email type: %v", eType)
 	}
+	span.SetAttributes(attribute.String("mandrill.template", templateName))
 
 	for key, value := range parameters {
 		mVar := gochimp.Var{
@@ -190,7 +345,6 @@ func SendEmail(eType emailType, email string, parameters map[string]string) erro
 		if attempts > 5 {
 			return fmt.Errorf("Mandrill failure: unable to render template in %v attempts", attempts)
 		}
-		var err error
 		renderedTemplate, err = mandrillClient.TemplateRender(templateName, []gochimp.Var{}, mergeVars)
 		if err != nil {
 			return err
@@ -210,7 +364,7 @@ func SendEmail(eType emailType, email string, parameters map[string]string) erro
 		To:        recipients,
 	}
 
-	_, err := mandrillClient.MessageSend(message, false)
+	_, err = mandrillClient.MessageSend(message, false)
 	return err
 }
 
@@ -0,0 +1,50 @@
+package cigExchange
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRandCodeLength(t *testing.T) {
+
+	for _, n := range []int{0, 1, 6, 32} {
+		if code := RandCode(n); len(code) != n {
+			t.Errorf("expected length %d, got %q", n, code)
+		}
+	}
+	if code := RandCodeFromAlphabet(6, ""); len(code) != 0 {
+		t.Errorf("empty alphabet generated %q", code)
+	}
+}
+
+func TestRandCodeDistribution(t *testing.T) {
+
+	const samples = 20000
+	counts := make(map[rune]int)
+	for i := 0; i < samples/10; i++ {
+		for _, c := range RandNumericCode(10) {
+			if !strings.ContainsRune(digitBytes, c) {
+				t.Fatalf("character %q is not in the alphabet", c)
+			}
+			counts[c]++
+		}
+	}
+
+	// every digit is expected samples/10 times, 20% deviation is far above the random variation
+	expected := samples / len(digitBytes)
+	for _, c := range digitBytes {
+		if counts[c] < expected*8/10 || counts[c] > expected*12/10 {
+			t.Errorf("digit %q generated %d times, expected about %d", c, counts[c], expected)
+		}
+	}
+
+	// codes don't repeat
+	codes := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		code := RandCode(12)
+		if codes[code] {
+			t.Fatalf("code %q generated twice", code)
+		}
+		codes[code] = true
+	}
+}
@@ -0,0 +1,228 @@
+package cigExchange
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// ValidationRule checks the field value and returns the nested error describing the problem, nil for valid value.
+// All rules except Required accept empty values, so optional fields are checked only when set
+type ValidationRule func(field string, value interface{}) *NestedAPIError
+
+// Validator collects the validation errors of the model fields, so all problems are reported at once:
+//
+//	v := NewValidator().
+//		Field("name", user.Name, Required).
+//		Field("email", email, Required, Email)
+//	return v.Error()
+type Validator struct {
+	apiError      *APIError
+	invalidFields map[string]bool
+}
+
+// NewValidator creates the validator without errors
+func NewValidator() *Validator {
+
+	apiError := &APIError{}
+	apiError.SetErrorType(ErrorTypeBadRequest)
+	return &Validator{
+		apiError:      apiError,
+		invalidFields: make(map[string]bool),
+	}
+}
+
+// Field checks the value with the rules in order, only the first failed rule of the field is reported
+func (v *Validator) Field(field string, value interface{}, rules ...ValidationRule) *Validator {
+
+	for _, rule := range rules {
+		if nestedError := rule(field, value); nestedError != nil {
+			nestedError.Field = field
+			v.apiError.Errors = append(v.apiError.Errors, nestedError)
+			v.invalidFields[field] = true
+			break
+		}
+	}
+	return v
+}
+
+// Check adds the nested errors of the custom validation result, nil is ignored
+func (v *Validator) Check(apiError *APIError) *Validator {
+
+	if apiError == nil {
+		return v
+	}
+	for _, nestedError := range apiError.Errors {
+		v.invalidFields[nestedError.Field] = true
+	}
+	v.apiError.AppendNestedErrors(apiError)
+	return v
+}
+
+// IsValid returns true if no errors were reported for the field,
+// use it to skip the checks depending on the field
+func (v *Validator) IsValid(field string) bool {
+	return !v.invalidFields[field]
+}
+
+// Error returns the error with all reported problems or nil if all fields are valid
+func (v *Validator) Error() *APIError {
+
+	if len(v.apiError.Errors) == 0 {
+		return nil
+	}
+	return v.apiError
+}
+
+// Required rejects nil, empty and whitespace only values
+func Required(field string, value interface{}) *NestedAPIError {
+
+	if isEmptyValue(value) {
+		return &NestedAPIError{Reason: ReasonFieldMissing, Message: "Required field missing"}
+	}
+	return nil
+}
+
+// Email checks the email address with ValidateEmail
+func Email(field string, value interface{}) *NestedAPIError {
+
+	if isEmptyValue(value) {
+		return nil
+	}
+	apiError := ValidateEmail(fmt.Sprint(derefValue(value)))
+	if apiError == nil || len(apiError.Errors) == 0 {
+		return nil
+	}
+	return apiError.Errors[0]
+}
+
+// URL accepts absolute http and https urls
+func URL(field string, value interface{}) *NestedAPIError {
+
+	if isEmptyValue(value) {
+		return nil
+	}
+	parsed, err := url.Parse(fmt.Sprint(derefValue(value)))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Hostname()) == 0 {
+		return invalidFieldNestedError("Field '" + field + "' must be http or https url")
+	}
+	return nil
+}
+
+// Min returns the rule rejecting numbers below min and strings, slices and maps shorter than min
+func Min(min float64) ValidationRule {
+
+	return func(field string, value interface{}) *NestedAPIError {
+		if number, ok := numericValue(value); ok && number < min {
+			return invalidFieldNestedError(fmt.Sprintf("Field '%s' must be at least %v", field, min))
+		}
+		if length, ok := lengthValue(value); ok && length > 0 && float64(length) < min {
+			return invalidFieldNestedError(fmt.Sprintf("Field '%s' must be at least %v long", field, min))
+		}
+		return nil
+	}
+}
+
+// Max returns the rule rejecting numbers above max and strings, slices and maps longer than max
+func Max(max float64) ValidationRule {
+
+	return func(field string, value interface{}) *NestedAPIError {
+		if number, ok := numericValue(value); ok && number > max {
+			return invalidFieldNestedError(fmt.Sprintf("Field '%s' must be at most %v", field, max))
+		}
+		if length, ok := lengthValue(value); ok && float64(length) > max {
+			return invalidFieldNestedError(fmt.Sprintf("Field '%s' must be at most %v long", field, max))
+		}
+		return nil
+	}
+}
+
+// OneOf returns the rule accepting only the listed string values
+func OneOf(values ...string) ValidationRule {
+
+	return func(field string, value interface{}) *NestedAPIError {
+		if isEmptyValue(value) {
+			return nil
+		}
+		str := fmt.Sprint(derefValue(value))
+		for _, allowed := range values {
+			if str == allowed {
+				return nil
+			}
+		}
+		return invalidFieldNestedError("Field '" + field + "' must be one of '" + strings.Join(values, "', '") + "'")
+	}
+}
+
+// invalidFieldNestedError creates nested error with ReasonFieldInvalid reason
+func invalidFieldNestedError(message string) *NestedAPIError {
+	return &NestedAPIError{Reason: ReasonFieldInvalid, Message: message}
+}
+
+// derefValue returns the pointed value, nil pointer is returned as nil
+func derefValue(value interface{}) interface{} {
+
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	return rv.Interface()
+}
+
+// isEmptyValue returns true for nil, blank strings and empty slices and maps
+func isEmptyValue(value interface{}) bool {
+
+	value = derefValue(value)
+	if value == nil {
+		return true
+	}
+	if str, ok := value.(string); ok {
+		return len(strings.TrimSpace(str)) == 0
+	}
+	length, ok := lengthValue(value)
+	return ok && length == 0
+}
+
+// numericValue returns the number value of int, uint and float kinds and pointers to them
+func numericValue(value interface{}) (float64, bool) {
+
+	value = derefValue(value)
+	if value == nil {
+		return 0, false
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// lengthValue returns the length of strings (in characters), slices and maps
+func lengthValue(value interface{}) (int, bool) {
+
+	value = derefValue(value)
+	if value == nil {
+		return 0, false
+	}
+	if str, ok := value.(string); ok {
+		return len([]rune(str)), true
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len(), true
+	}
+	return 0, false
+}
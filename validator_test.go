@@ -0,0 +1,127 @@
+package cigExchange
+
+import (
+	"testing"
+)
+
+func TestValidationRules(t *testing.T) {
+
+	name := "John"
+	blank := "  "
+	var missing *string
+	amount := 50.0
+
+	tests := []struct {
+		name     string
+		rule     ValidationRule
+		value    interface{}
+		expected string
+	}{
+		{"required string", Required, "John", ""},
+		{"required pointer", Required, &name, ""},
+		{"required empty", Required, "", ReasonFieldMissing},
+		{"required blank", Required, blank, ReasonFieldMissing},
+		{"required blank pointer", Required, &blank, ReasonFieldMissing},
+		{"required nil pointer", Required, missing, ReasonFieldMissing},
+		{"required nil", Required, nil, ReasonFieldMissing},
+		{"required empty slice", Required, []string{}, ReasonFieldMissing},
+		{"required zero number", Required, 0, ""},
+
+		{"email", Email, "john@example.com", ""},
+		{"email empty", Email, "", ""},
+		{"email invalid", Email, "john.example.com", ReasonFieldInvalid},
+
+		{"url https", URL, "https://example.com/path", ""},
+		{"url http", URL, "http://example.com", ""},
+		{"url empty", URL, missing, ""},
+		{"url without scheme", URL, "example.com", ReasonFieldInvalid},
+		{"url other scheme", URL, "ftp://example.com", ReasonFieldInvalid},
+		{"url without host", URL, "https://", ReasonFieldInvalid},
+
+		{"min number", Min(10), 10, ""},
+		{"min number below", Min(10), 9.5, ReasonFieldInvalid},
+		{"min number pointer", Min(100), &amount, ReasonFieldInvalid},
+		{"min length", Min(3), "John", ""},
+		{"min length below", Min(5), "John", ReasonFieldInvalid},
+		{"min empty", Min(5), "", ""},
+		{"min nil", Min(5), missing, ""},
+
+		{"max number", Max(100), int64(100), ""},
+		{"max number above", Max(100), uint(101), ReasonFieldInvalid},
+		{"max length", Max(4), "John", ""},
+		{"max length above", Max(3), "John", ReasonFieldInvalid},
+		{"max slice above", Max(1), []string{"a", "b"}, ReasonFieldInvalid},
+
+		{"one of", OneOf("email", "phone"), "phone", ""},
+		{"one of pointer", OneOf("John"), &name, ""},
+		{"one of empty", OneOf("email", "phone"), "", ""},
+		{"one of other", OneOf("email", "phone"), "fax", ReasonFieldInvalid},
+		{"one of case", OneOf("email", "phone"), "Email", ReasonFieldInvalid},
+	}
+
+	for _, test := range tests {
+		nestedError := test.rule("field", test.value)
+		reason := ""
+		if nestedError != nil {
+			reason = nestedError.Reason
+		}
+		if reason != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, reason)
+		}
+	}
+}
+
+func TestValidatorCollectsErrors(t *testing.T) {
+
+	v := NewValidator().
+		Field("name", "", Required, Min(2)).
+		Field("email", "john.example.com", Required, Email).
+		Field("website", "https://example.com", URL).
+		Field("type", "fax", OneOf("email", "phone")).
+		Check(NewInvalidFieldError("amount", "Amount is invalid")).
+		Check(nil)
+
+	apiError := v.Error()
+	if apiError == nil {
+		t.Fatal("invalid fields accepted")
+	}
+	if apiError.Code != 400 {
+		t.Errorf("expected 400, got %d", apiError.Code)
+	}
+
+	// only the first failed rule of the field is reported
+	expected := []struct {
+		field  string
+		reason string
+	}{
+		{"name", ReasonFieldMissing},
+		{"email", ReasonFieldInvalid},
+		{"type", ReasonFieldInvalid},
+		{"amount", ReasonFieldInvalid},
+	}
+	if len(apiError.Errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), apiError.ToString())
+	}
+	for i, e := range expected {
+		if apiError.Errors[i].Field != e.field || apiError.Errors[i].Reason != e.reason {
+			t.Errorf("error %d: expected %s %s, got %+v", i, e.field, e.reason, apiError.Errors[i])
+		}
+	}
+
+	for field, valid := range map[string]bool{"name": false, "amount": false, "website": true, "unknown": true} {
+		if v.IsValid(field) != valid {
+			t.Errorf("%s: expected valid %v", field, valid)
+		}
+	}
+}
+
+func TestValidatorWithoutErrors(t *testing.T) {
+
+	v := NewValidator().
+		Field("name", "John", Required, Min(2), Max(50)).
+		Field("website", "", URL).
+		Check(nil)
+	if apiError := v.Error(); apiError != nil {
+		t.Errorf("unexpected error %v", apiError.ToString())
+	}
+}